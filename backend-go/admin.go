@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin guards operator endpoints with the ADMIN_API_KEY shared secret
+func requireAdmin(adminKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminKey == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin API disabled"})
+			return
+		}
+		provided := c.GetHeader("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin key"})
+			return
+		}
+		c.Next()
+	}
+}
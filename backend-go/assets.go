@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gin-gonic/gin"
+)
+
+// Asset is the record of an uploaded video
+type Asset struct {
+	ID              string           `json:"id"`
+	Filename        string           `json:"filename"` // original filename
+	Size            int64            `json:"size"`
+	Checksum        string           `json:"checksum"` // hex SHA-256 of the content
+	S3Key           string           `json:"s3Key"`
+	Media           *MediaInfo       `json:"media,omitempty"`
+	Owner           string           `json:"owner"`
+	CaptionVersions []CaptionVersion `json:"captionVersions,omitempty"`
+	CreatedAt       time.Time        `json:"createdAt"`
+}
+
+var (
+	errAssetNotFound = errors.New("asset not found")
+	// errCaptionVersionConflict is a caption version added since the asset was read
+	errCaptionVersionConflict = errors.New("asset captions changed concurrently")
+)
+
+// AssetStore persists upload records
+type AssetStore interface {
+	Put(asset *Asset) error
+	Get(id string) (*Asset, error)
+	List(owner string) ([]*Asset, error)
+	// FindByChecksum returns the owner's asset with the given content hash, or nil
+	FindByChecksum(owner, checksum string) (*Asset, error)
+	Delete(id string) error
+	// AddCaptionVersion appends cv if the asset still has known caption versions,
+	// otherwise it returns errCaptionVersionConflict
+	AddCaptionVersion(id string, known int, cv CaptionVersion) error
+	// RemoveCaptionVersion drops the caption version at index if it is still version,
+	// otherwise it returns errCaptionVersionConflict
+	RemoveCaptionVersion(id string, index, version int) error
+}
+
+// memoryAssetStore keeps assets in process memory
+type memoryAssetStore struct {
+	mu     sync.RWMutex
+	assets map[string]*Asset
+}
+
+func newMemoryAssetStore() *memoryAssetStore {
+	return &memoryAssetStore{assets: make(map[string]*Asset)}
+}
+
+func (s *memoryAssetStore) Put(asset *Asset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *asset
+	s.assets[asset.ID] = &copied
+	return nil
+}
+
+func (s *memoryAssetStore) Get(id string) (*Asset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	asset, ok := s.assets[id]
+	if !ok {
+		return nil, errAssetNotFound
+	}
+	copied := *asset
+	return &copied, nil
+}
+
+func (s *memoryAssetStore) List(owner string) ([]*Asset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var assets []*Asset
+	for _, asset := range s.assets {
+		if asset.Owner == owner {
+			copied := *asset
+			assets = append(assets, &copied)
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].CreatedAt.After(assets[j].CreatedAt)
+	})
+	return assets, nil
+}
+
+func (s *memoryAssetStore) FindByChecksum(owner, checksum string) (*Asset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, asset := range s.assets {
+		if asset.Owner == owner && asset.Checksum == checksum {
+			copied := *asset
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryAssetStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.assets, id)
+	return nil
+}
+
+func (s *memoryAssetStore) AddCaptionVersion(id string, known int, cv CaptionVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	asset, ok := s.assets[id]
+	if !ok || len(asset.CaptionVersions) != known {
+		return errCaptionVersionConflict
+	}
+	// Copies handed out by Get share the old backing array
+	asset.CaptionVersions = append(append([]CaptionVersion(nil), asset.CaptionVersions...), cv)
+	return nil
+}
+
+func (s *memoryAssetStore) RemoveCaptionVersion(id string, index, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	asset, ok := s.assets[id]
+	if !ok || index >= len(asset.CaptionVersions) || asset.CaptionVersions[index].Version != version {
+		return errCaptionVersionConflict
+	}
+	asset.CaptionVersions = withoutCaptionVersion(asset.CaptionVersions, index)
+	return nil
+}
+
+// dynamoAssetStore keeps assets in a DynamoDB table keyed by "id"
+// with an "OwnerIndex" GSI on owner/createdAt and a "ChecksumIndex" GSI on checksum
+type dynamoAssetStore struct {
+	client *dynamodb.DynamoDB
+	table  string
+}
+
+// Ping checks that the assets table exists and is reachable
+func (s *dynamoAssetStore) Ping(ctx context.Context) error {
+	_, err := s.client.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(s.table)})
+	return err
+}
+
+func (s *dynamoAssetStore) Put(asset *Asset) error {
+	item, err := dynamodbattribute.MarshalMap(asset)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	})
+	return err
+}
+
+func (s *dynamoAssetStore) Get(id string) (*Asset, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errAssetNotFound
+	}
+	var asset Asset
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (s *dynamoAssetStore) List(owner string) ([]*Asset, error) {
+	var assets []*Asset
+	err := s.client.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(s.table),
+		IndexName:              aws.String("OwnerIndex"),
+		KeyConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(owner)},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var asset Asset
+			if err := dynamodbattribute.UnmarshalMap(item, &asset); err != nil {
+				slog.Warn("Skipping malformed asset record", "error", err)
+				continue
+			}
+			assets = append(assets, &asset)
+		}
+		return true
+	})
+	return assets, err
+}
+
+func (s *dynamoAssetStore) FindByChecksum(owner, checksum string) (*Asset, error) {
+	result, err := s.client.Query(&dynamodb.QueryInput{
+		TableName:              aws.String(s.table),
+		IndexName:              aws.String("ChecksumIndex"),
+		KeyConditionExpression: aws.String("checksum = :checksum"),
+		FilterExpression:       aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":checksum": {S: aws.String(checksum)},
+			":owner":    {S: aws.String(owner)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		return nil, nil
+	}
+	var asset Asset
+	if err := dynamodbattribute.UnmarshalMap(result.Items[0], &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// AddCaptionVersion appends cv to captionVersions on condition that the list still has known entries
+func (s *dynamoAssetStore) AddCaptionVersion(id string, known int, cv CaptionVersion) error {
+	version, err := dynamodbattribute.MarshalMap(cv)
+	if err != nil {
+		return err
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":version": {L: []*dynamodb.AttributeValue{{M: version}}},
+		":empty":   {L: []*dynamodb.AttributeValue{}},
+	}
+	// Assets without captions have no captionVersions attribute
+	condition := "attribute_exists(id) AND attribute_not_exists(captionVersions)"
+	if known > 0 {
+		condition = "size(captionVersions) = :known"
+		values[":known"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(known))}
+	}
+	_, err = s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		UpdateExpression:          aws.String("SET captionVersions = list_append(if_not_exists(captionVersions, :empty), :version)"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errCaptionVersionConflict
+	}
+	return err
+}
+
+// RemoveCaptionVersion removes captionVersions[index] on condition that it still holds version
+func (s *dynamoAssetStore) RemoveCaptionVersion(id string, index, version int) error {
+	_, err := s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		UpdateExpression:         aws.String(fmt.Sprintf("REMOVE captionVersions[%d]", index)),
+		ConditionExpression:      aws.String(fmt.Sprintf("captionVersions[%d].#version = :version", index)),
+		ExpressionAttributeNames: map[string]*string{"#version": aws.String("version")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":version": {N: aws.String(strconv.Itoa(version))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errCaptionVersionConflict
+	}
+	return err
+}
+
+func (s *dynamoAssetStore) Delete(id string) error {
+	_, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+	})
+	return err
+}
+
+// assetIDFromS3Key derives the asset ID from an upload key (uploads/<tenant>/<id>.mp4)
+func assetIDFromS3Key(s3Key string) string {
+	base := filepath.Base(s3Key)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// getOwnedAsset loads an asset and hides it from callers that do not own it
+func (s *Server) getOwnedAsset(c *gin.Context, id string) (*Asset, bool) {
+	asset, err := s.Assets.Get(id)
+	if err != nil || asset.Owner != requestTenant(c) {
+		if err != nil && !errors.Is(err, errAssetNotFound) {
+			loggerFrom(c.Request.Context()).Error("Failed to load asset", "asset_id", id, "error", err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return nil, false
+	}
+	return asset, true
+}
+
+// getUploadAsset loads the asset record behind one of the caller's upload keys, nil
+// when there is none. A record owned by another tenant or stored under another key
+// is hidden the same way as a missing upload.
+func (s *Server) getUploadAsset(c *gin.Context, s3Key string) (*Asset, bool) {
+	asset, err := s.Assets.Get(assetIDFromS3Key(s3Key))
+	if errors.Is(err, errAssetNotFound) {
+		return nil, true
+	}
+	if err != nil || asset.Owner != requestTenant(c) || asset.S3Key != s3Key {
+		if err != nil {
+			loggerFrom(c.Request.Context()).Error("Failed to load asset", "key", s3Key, "error", err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+	return asset, true
+}
+
+// checksumShared reports whether another asset of the owner has the same content
+func (s *Server) checksumShared(asset *Asset) (bool, error) {
+	assets, err := s.Assets.List(asset.Owner)
+	if err != nil {
+		return false, err
+	}
+	for _, other := range assets {
+		if other.ID != asset.ID && other.Checksum == asset.Checksum {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// listAssetsHandler handles GET /assets
+func (s *Server) listAssetsHandler(c *gin.Context) {
+	assets, err := s.Assets.List(requestTenant(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list assets"})
+		return
+	}
+	if assets == nil {
+		assets = []*Asset{}
+	}
+	c.JSON(http.StatusOK, gin.H{"assets": assets})
+}
+
+// getAssetHandler handles GET /assets/:id
+func (s *Server) getAssetHandler(c *gin.Context) {
+	asset, ok := s.getOwnedAsset(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, asset)
+}
+
+// deleteAssetHandler handles DELETE /assets/:id, removing the video, its captions and
+// its cached transcript from S3
+func (s *Server) deleteAssetHandler(c *gin.Context) {
+	asset, ok := s.getOwnedAsset(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	keys := []string{asset.S3Key}
+	for _, v := range asset.CaptionVersions {
+		keys = append(keys, v.Key)
+	}
+	// Caption files a failed save left off the record
+	err := s.Storage.List(ctx, "captions/"+asset.ID+"/", func(obj StoredObject) {
+		if !slices.Contains(keys, obj.Key) {
+			keys = append(keys, obj.Key)
+		}
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete asset files"})
+		return
+	}
+	// The cached transcript, unless another of the tenant's uploads has the same content
+	if asset.Checksum != "" {
+		shared, err := s.checksumShared(asset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete asset files"})
+			return
+		}
+		if !shared {
+			keys = append(keys, transcriptCacheKey(asset.Owner, asset.Checksum))
+		}
+	}
+	for _, key := range keys {
+		if err := s.Storage.Delete(ctx, key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete asset files"})
+			return
+		}
+	}
+
+	if err := s.Assets.Delete(asset.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete asset"})
+		return
+	}
+
+	loggerFrom(ctx).Info("Asset deleted", "asset_id", asset.ID, "objects", len(keys))
+	c.Status(http.StatusNoContent)
+}
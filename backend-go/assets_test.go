@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestListAssetsScopedToOwner tests that GET /assets only returns the caller's uploads
+func TestListAssetsScopedToOwner(t *testing.T) {
+	ts := newTestServer(t)
+	store := ts.assets
+	keys := useTestTenants(ts, "alice", "bob")
+	now := time.Now()
+	store.Put(&Asset{ID: "a1", Owner: "alice", S3Key: "uploads/a1.mp4", CreatedAt: now.Add(-time.Minute)})
+	store.Put(&Asset{ID: "a2", Owner: "alice", S3Key: "uploads/a2.mp4", CreatedAt: now})
+	store.Put(&Asset{ID: "b1", Owner: "bob", S3Key: "uploads/b1.mp4", CreatedAt: now})
+
+	router := ts.router
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/assets", nil)
+	req.Header.Set("X-API-Key", keys["alice"])
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Assets []Asset `json:"assets"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Assets, 2)
+	assert.Equal(t, "a2", response.Assets[0].ID, "newest first")
+}
+
+// TestGetAssetHidesOtherOwners tests that assets owned by someone else look missing
+func TestGetAssetHidesOtherOwners(t *testing.T) {
+	ts := newTestServer(t)
+	store := ts.assets
+	keys := useTestTenants(ts, "alice", "bob")
+	store.Put(&Asset{ID: "a1", Owner: "alice", Filename: "talk.mp4"})
+
+	router := ts.router
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/assets/a1", nil)
+	req.Header.Set("X-API-Key", keys["alice"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "talk.mp4")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/assets/a1", nil)
+	req.Header.Set("X-API-Key", keys["bob"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestDeleteAsset tests that deleting an asset removes its upload, every caption file
+// and the cached transcript, so a re-upload is transcribed afresh
+func TestDeleteAsset(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+	var uploaded struct {
+		AssetID string `json:"assetId"`
+		S3Key   string `json:"s3Key"`
+	}
+	json.Unmarshal(ts.upload(key, "video", "talk.mp4", testVideo()).Body.Bytes(), &uploaded)
+	assert.Equal(t, http.StatusOK, ts.do("POST", "/transcribe", key, map[string]string{"s3Key": uploaded.S3Key}).Code)
+	asset, _ := ts.assets.Get(uploaded.AssetID)
+	// Left behind by a save that failed to record it
+	ts.storage.Put(context.Background(), captionKey(asset.ID, 2), "text/plain", strings.NewReader("orphan"), nil)
+
+	w := ts.do("DELETE", "/assets/"+asset.ID, key, nil)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	for _, key := range []string{asset.S3Key, captionKey(asset.ID, 1), captionKey(asset.ID, 2), transcriptCacheKey("acme", asset.Checksum)} {
+		_, found, _ := ts.storage.Get(context.Background(), key)
+		assert.False(t, found, key)
+	}
+
+	json.Unmarshal(ts.upload(key, "video", "talk.mp4", testVideo()).Body.Bytes(), &uploaded)
+	w = ts.do("POST", "/transcribe", key, map[string]string{"s3Key": uploaded.S3Key})
+	assert.Contains(t, w.Body.String(), `"cached":false`)
+	assert.Equal(t, 2, ts.transcriber.calls)
+}
+
+// TestAssetIDFromS3Key tests deriving asset IDs from upload keys
+func TestAssetIDFromS3Key(t *testing.T) {
+	assert.Equal(t, "1234-abcd", assetIDFromS3Key("uploads/tenant-1/1234-abcd.mp4"))
+	assert.Equal(t, "1234-abcd", assetIDFromS3Key("1234-abcd"))
+}
+
+// TestFindByChecksumScopedToOwner tests duplicate detection by content hash
+func TestFindByChecksumScopedToOwner(t *testing.T) {
+	store := newMemoryAssetStore()
+	store.Put(&Asset{ID: "a1", Owner: "alice", Checksum: "abc123"})
+
+	asset, err := store.FindByChecksum("alice", "abc123")
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", asset.ID)
+
+	asset, err = store.FindByChecksum("bob", "abc123")
+	assert.NoError(t, err)
+	assert.Nil(t, asset, "other owners never share asset records")
+
+	asset, err = store.FindByChecksum("alice", "def456")
+	assert.NoError(t, err)
+	assert.Nil(t, asset)
+}
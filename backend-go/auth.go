@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// apiKeyPrefix marks platform API keys so they can also be sent as bearer tokens
+const apiKeyPrefix = "cpk_"
+
+// anonymousTenant owns every request when authentication is disabled
+const anonymousTenant = "anonymous"
+
+// tenantContextKey is the gin context key holding the authenticated tenant ID
+const tenantContextKey = "tenantID"
+
+// principalContextKey identifies the credential used, for per-key rate limiting
+const principalContextKey = "principal"
+
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var errAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a hashed API key issued to a tenant. The plaintext key is never stored.
+type APIKey struct {
+	Hash      string    `json:"hash"`
+	TenantID  string    `json:"tenantId"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// APIKeyStore persists hashed API keys
+type APIKeyStore interface {
+	Put(key *APIKey) error
+	Get(hash string) (*APIKey, error)
+	Delete(hash string) error
+}
+
+// memoryAPIKeyStore keeps API keys in process memory
+type memoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+func newMemoryAPIKeyStore() *memoryAPIKeyStore {
+	return &memoryAPIKeyStore{keys: make(map[string]*APIKey)}
+}
+
+func (s *memoryAPIKeyStore) Put(key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *key
+	s.keys[key.Hash] = &copied
+	return nil
+}
+
+func (s *memoryAPIKeyStore) Get(hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, errAPIKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (s *memoryAPIKeyStore) Delete(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, hash)
+	return nil
+}
+
+// dynamoAPIKeyStore keeps API keys in the jobs table under "apikey:<hash>" items
+type dynamoAPIKeyStore struct {
+	client *dynamodb.DynamoDB
+	table  string
+}
+
+func apiKeyItemID(hash string) string {
+	return "apikey:" + hash
+}
+
+func (s *dynamoAPIKeyStore) Put(key *APIKey) error {
+	item, err := dynamodbattribute.MarshalMap(key)
+	if err != nil {
+		return err
+	}
+	item["jobId"] = &dynamodb.AttributeValue{S: aws.String(apiKeyItemID(key.Hash))}
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	})
+	return err
+}
+
+func (s *dynamoAPIKeyStore) Get(hash string) (*APIKey, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"jobId": {S: aws.String(apiKeyItemID(hash))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errAPIKeyNotFound
+	}
+	var key APIKey
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *dynamoAPIKeyStore) Delete(hash string) error {
+	_, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"jobId": {S: aws.String(apiKeyItemID(hash))},
+		},
+	})
+	return err
+}
+
+// hashAPIKey returns the hex SHA-256 of a plaintext API key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey creates a random plaintext API key
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// tenantClaims are the JWT claims accepted for bearer authentication
+type tenantClaims struct {
+	TenantID string `json:"tenant_id"`
+	jwt.RegisteredClaims
+}
+
+// parseTenantJWT validates an HS256 bearer token and returns its tenant.
+// The tenant comes from the tenant_id claim, falling back to sub.
+func parseTenantJWT(tokenString string, auth AuthConfig) (string, error) {
+	var opts []jwt.ParserOption
+	opts = append(opts, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if auth.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(auth.JWTIssuer))
+	}
+	if auth.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(auth.JWTAudience))
+	}
+
+	var claims tenantClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(auth.JWTSecret), nil
+	}, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	tenantID := claims.TenantID
+	if tenantID == "" {
+		tenantID = claims.Subject
+	}
+	if !tenantIDPattern.MatchString(tenantID) {
+		return "", fmt.Errorf("token has no valid tenant")
+	}
+	return tenantID, nil
+}
+
+// requireTenant authenticates the caller by API key (X-API-Key or a cpk_ bearer token)
+// or by bearer JWT, and attaches the tenant ID to the context
+func (s *Server) requireTenant() gin.HandlerFunc {
+	auth := s.cfg.Auth
+	return func(c *gin.Context) {
+		if auth.Disabled {
+			c.Set(tenantContextKey, anonymousTenant)
+			c.Set(principalContextKey, "ip:"+c.ClientIP())
+			c.Next()
+			return
+		}
+
+		apiKey := c.GetHeader("X-API-Key")
+		bearer := ""
+		if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			bearer = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+		if apiKey == "" && strings.HasPrefix(bearer, apiKeyPrefix) {
+			apiKey, bearer = bearer, ""
+		}
+
+		var tenantID, principal string
+		switch {
+		case apiKey != "":
+			key, err := s.APIKeys.Get(hashAPIKey(apiKey))
+			if err != nil {
+				if !errors.Is(err, errAPIKeyNotFound) {
+					loggerFrom(c.Request.Context()).Error("API key lookup failed", "error", err)
+				}
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			tenantID = key.TenantID
+			principal = "key:" + key.Hash
+		case bearer != "":
+			if auth.JWTSecret == "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Bearer tokens are not accepted"})
+				return
+			}
+			var err error
+			if tenantID, err = parseTenantJWT(bearer, auth); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				return
+			}
+			principal = "jwt:" + tenantID
+		default:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		c.Set(tenantContextKey, tenantID)
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// requestTenant returns the tenant attached by requireTenant
+func requestTenant(c *gin.Context) string {
+	if tenantID := c.GetString(tenantContextKey); tenantID != "" {
+		return tenantID
+	}
+	return anonymousTenant
+}
+
+// tenantUploadPrefix is the S3 prefix holding a tenant's uploads
+func tenantUploadPrefix(tenantID string) string {
+	return fmt.Sprintf("uploads/%s/", tenantID)
+}
+
+// tenantOwnsUpload reports whether an upload key belongs to the tenant
+func tenantOwnsUpload(tenantID, s3Key string) bool {
+	return strings.HasPrefix(s3Key, tenantUploadPrefix(tenantID)) && !strings.Contains(s3Key, "..")
+}
+
+// createAPIKeyHandler handles POST /admin/api-keys, returning the plaintext key once
+func (s *Server) createAPIKeyHandler(c *gin.Context) {
+	var req struct {
+		TenantID string `json:"tenantId"`
+		Name     string `json:"name"`
+	}
+	if err := c.BindJSON(&req); err != nil || !tenantIDPattern.MatchString(req.TenantID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid tenantId is required"})
+		return
+	}
+
+	plaintext, err := generateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	key := &APIKey{
+		Hash:      hashAPIKey(plaintext),
+		TenantID:  req.TenantID,
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+	}
+	if err := s.APIKeys.Put(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save API key"})
+		return
+	}
+
+	loggerFrom(c.Request.Context()).Info("API key issued", "key_hash_prefix", key.Hash[:12], "tenant", key.TenantID)
+	c.JSON(http.StatusCreated, gin.H{
+		"apiKey":   plaintext,
+		"tenantId": key.TenantID,
+		"name":     key.Name,
+	})
+}
+
+// revokeAPIKeyHandler handles DELETE /admin/api-keys
+func (s *Server) revokeAPIKeyHandler(c *gin.Context) {
+	var req struct {
+		APIKey string `json:"apiKey"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.APIKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "apiKey is required"})
+		return
+	}
+	if err := s.APIKeys.Delete(hashAPIKey(req.APIKey)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// useTestTenants issues an API key per tenant in the test server's key store
+func useTestTenants(ts *testServer, tenants ...string) map[string]string {
+	keys := make(map[string]string)
+	for _, tenant := range tenants {
+		keys[tenant] = ts.apiKey(tenant)
+	}
+	return keys
+}
+
+func signTestJWT(t *testing.T, secret string, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	assert.NoError(t, err)
+	return token
+}
+
+// whoami calls GET /usage with header set to value and returns the status and the tenant it ran as
+func whoami(ts *testServer, header, value string) (int, string) {
+	req, _ := http.NewRequest("GET", "/usage", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	w := ts.serve(req)
+	var usage struct {
+		TenantID string `json:"tenantId"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &usage)
+	return w.Code, usage.TenantID
+}
+
+// TestRequireTenantAPIKey tests API key authentication via header and bearer token
+func TestRequireTenantAPIKey(t *testing.T) {
+	ts := newTestServer(t)
+	keys := useTestTenants(ts, "acme")
+
+	status, _ := whoami(ts, "", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, tenant := whoami(ts, "X-API-Key", keys["acme"])
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "acme", tenant)
+
+	_, tenant = whoami(ts, "Authorization", "Bearer "+keys["acme"])
+	assert.Equal(t, "acme", tenant)
+
+	status, _ = whoami(ts, "X-API-Key", apiKeyPrefix+"unknown")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+// TestRequireTenantJWT tests bearer JWT authentication
+func TestRequireTenantJWT(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.Auth.JWTSecret = "test-secret" })
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		tenant string
+	}{
+		{"tenant claim", signTestJWT(t, "test-secret", jwt.MapClaims{"tenant_id": "acme", "exp": exp}), http.StatusOK, "acme"},
+		{"subject fallback", signTestJWT(t, "test-secret", jwt.MapClaims{"sub": "globex", "exp": exp}), http.StatusOK, "globex"},
+		{"wrong secret", signTestJWT(t, "other", jwt.MapClaims{"tenant_id": "acme", "exp": exp}), http.StatusUnauthorized, ""},
+		{"expired", signTestJWT(t, "test-secret", jwt.MapClaims{"tenant_id": "acme", "exp": time.Now().Add(-time.Hour).Unix()}), http.StatusUnauthorized, ""},
+		{"no expiry", signTestJWT(t, "test-secret", jwt.MapClaims{"tenant_id": "acme"}), http.StatusUnauthorized, ""},
+		{"unsafe tenant", signTestJWT(t, "test-secret", jwt.MapClaims{"tenant_id": "../etc", "exp": exp}), http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		status, tenant := whoami(ts, "Authorization", "Bearer "+test.token)
+		assert.Equal(t, test.status, status, test.name)
+		if test.tenant != "" {
+			assert.Equal(t, test.tenant, tenant, test.name)
+		}
+	}
+}
+
+// TestTenantOwnsUpload tests upload key scoping by tenant prefix
+func TestTenantOwnsUpload(t *testing.T) {
+	assert.True(t, tenantOwnsUpload("acme", "uploads/acme/abc.mp4"))
+	assert.False(t, tenantOwnsUpload("acme", "uploads/globex/abc.mp4"))
+	assert.False(t, tenantOwnsUpload("acme", "uploads/acme/../globex/abc.mp4"))
+	assert.False(t, tenantOwnsUpload("acme", "output/acme/video_1.mp4"))
+}
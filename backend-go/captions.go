@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CaptionVersion is one saved revision of an asset's captions
+type CaptionVersion struct {
+	Version   int       `json:"version"`
+	Key       string    `json:"key"`
+	Source    string    `json:"source"` // transcript, edited
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// captionKey is the S3 key of a caption version, derived from the source upload
+func captionKey(assetID string, version int) string {
+	return fmt.Sprintf("captions/%s/%d.srt", assetID, version)
+}
+
+// parseCaptionKey splits captions/<asset-id>/<version>.srt into its parts
+func parseCaptionKey(key string) (string, int, bool) {
+	parts := strings.Split(strings.TrimPrefix(key, "captions/"), "/")
+	if len(parts) != 2 || !strings.HasSuffix(parts[1], ".srt") {
+		return "", 0, false
+	}
+	version, err := strconv.Atoi(strings.TrimSuffix(parts[1], ".srt"))
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[0], version, true
+}
+
+// originalTranscript returns the first machine-generated caption version, if any
+func (a *Asset) originalTranscript() *CaptionVersion {
+	for i := range a.CaptionVersions {
+		if a.CaptionVersions[i].Source == "transcript" {
+			return &a.CaptionVersions[i]
+		}
+	}
+	return nil
+}
+
+// captionSaveAttempts bounds how often a save retries after losing a version to a concurrent one
+const captionSaveAttempts = 5
+
+// saveCaptionVersion uploads captions as the next SRT version of an asset and records it.
+// Earlier versions are never overwritten, so edits keep the original transcript: the
+// version is claimed on the asset record before its file is written, and a save that
+// loses the claim to a concurrent one reloads the asset and takes the next number. A
+// claim whose file could not be written is released again.
+func saveCaptionVersion(ctx context.Context, storage ObjectStorage, assets AssetStore, asset *Asset, captions []Caption, source string) (*CaptionVersion, string, error) {
+	var cv CaptionVersion
+	for attempt := 1; ; attempt++ {
+		version := 1
+		for _, v := range asset.CaptionVersions {
+			if v.Version >= version {
+				version = v.Version + 1
+			}
+		}
+		cv = CaptionVersion{
+			Version:   version,
+			Key:       captionKey(asset.ID, version),
+			Source:    source,
+			CreatedAt: time.Now(),
+		}
+
+		err := assets.AddCaptionVersion(asset.ID, len(asset.CaptionVersions), cv)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errCaptionVersionConflict) || attempt == captionSaveAttempts {
+			return nil, "", err
+		}
+		reloaded, err := assets.Get(asset.ID)
+		if err != nil {
+			return nil, "", err
+		}
+		*asset = *reloaded
+	}
+	asset.CaptionVersions = append(asset.CaptionVersions, cv)
+
+	srtURL, err := storage.Put(ctx, cv.Key, "text/plain", strings.NewReader(generateSRT(captions)), nil)
+	if err != nil {
+		if dropErr := dropCaptionVersion(assets, asset, cv.Version); dropErr != nil {
+			loggerFrom(ctx).Error("Failed to release caption version", "asset_id", asset.ID, "version", cv.Version, "error", dropErr)
+		}
+		return nil, "", err
+	}
+	return &cv, srtURL, nil
+}
+
+// dropCaptionVersion removes version from the asset record, retrying like
+// saveCaptionVersion when the versions changed since the asset was read
+func dropCaptionVersion(assets AssetStore, asset *Asset, version int) error {
+	for attempt := 1; ; attempt++ {
+		index := -1
+		for i, v := range asset.CaptionVersions {
+			if v.Version == version {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil
+		}
+
+		err := assets.RemoveCaptionVersion(asset.ID, index, version)
+		if err == nil {
+			asset.CaptionVersions = withoutCaptionVersion(asset.CaptionVersions, index)
+			return nil
+		}
+		if !errors.Is(err, errCaptionVersionConflict) || attempt == captionSaveAttempts {
+			return err
+		}
+		reloaded, err := assets.Get(asset.ID)
+		if err != nil {
+			return err
+		}
+		*asset = *reloaded
+	}
+}
+
+// withoutCaptionVersion copies versions without the entry at index, copies of an
+// asset share the backing array
+func withoutCaptionVersion(versions []CaptionVersion, index int) []CaptionVersion {
+	kept := append([]CaptionVersion(nil), versions[:index]...)
+	return append(kept, versions[index+1:]...)
+}
+
+// transcriptCacheKey is where a tenant's captions for a given content hash are cached,
+// shared across its uploads so identical videos are only transcribed once. Caches are
+// per tenant so a hit never reveals what another tenant uploaded.
+func transcriptCacheKey(tenantID, checksum string) string {
+	return fmt.Sprintf("transcripts/%s/%s.json", tenantID, checksum)
+}
+
+// getCachedTranscript returns captions the tenant previously transcribed for a content hash
+func getCachedTranscript(ctx context.Context, storage ObjectStorage, tenantID, checksum string) ([]Caption, bool) {
+	if checksum == "" {
+		return nil, false
+	}
+	data, found, err := storage.Get(ctx, transcriptCacheKey(tenantID, checksum))
+	if err != nil {
+		loggerFrom(ctx).Warn("Failed to read cached transcript", "checksum", checksum, "error", err)
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+
+	var captions []Caption
+	if err := json.Unmarshal(data, &captions); err != nil {
+		loggerFrom(ctx).Warn("Ignoring malformed cached transcript", "checksum", checksum, "error", err)
+		return nil, false
+	}
+	return captions, true
+}
+
+// cacheTranscript stores the tenant's captions for a content hash
+func cacheTranscript(ctx context.Context, storage ObjectStorage, tenantID, checksum string, captions []Caption) error {
+	if checksum == "" {
+		return nil
+	}
+	data, err := json.Marshal(captions)
+	if err != nil {
+		return err
+	}
+	_, err = storage.Put(ctx, transcriptCacheKey(tenantID, checksum), "application/json", strings.NewReader(string(data)), nil)
+	return err
+}
+
+// listCaptionVersionsHandler handles GET /assets/:id/captions
+func (s *Server) listCaptionVersionsHandler(c *gin.Context) {
+	asset, ok := s.getOwnedAsset(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	versions := asset.CaptionVersions
+	if versions == nil {
+		versions = []CaptionVersion{}
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// getCaptionVersionHandler handles GET /assets/:id/captions/:version, returning the SRT file
+func (s *Server) getCaptionVersionHandler(c *gin.Context) {
+	asset, ok := s.getOwnedAsset(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid caption version"})
+		return
+	}
+
+	var key string
+	for _, v := range asset.CaptionVersions {
+		if v.Version == version {
+			key = v.Key
+		}
+	}
+	if key == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Caption version not found"})
+		return
+	}
+
+	data, found, err := s.Storage.Get(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read captions: %v", err)})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Caption file not found"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s_v%d.srt", asset.ID, version))
+	c.Data(http.StatusOK, "application/x-subrip", data)
+}
+
+// saveCaptionVersionHandler handles POST /assets/:id/captions, storing edited captions as a new version
+func (s *Server) saveCaptionVersionHandler(c *gin.Context) {
+	asset, ok := s.getOwnedAsset(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Captions []Caption `json:"captions"`
+	}
+	if err := c.BindJSON(&req); err != nil || len(req.Captions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	version, srtURL, err := saveCaptionVersion(c.Request.Context(), s.Storage, s.Assets, asset, req.Captions, "edited")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save captions: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"version": version.Version,
+		"key":     version.Key,
+		"srtUrl":  srtURL,
+	})
+}
+
+// removeCaptionVersion drops a deleted caption file from its asset record
+func removeCaptionVersion(assets AssetStore, key string) {
+	assetID, version, ok := parseCaptionKey(key)
+	if !ok {
+		return
+	}
+	asset, err := assets.Get(assetID)
+	if err != nil {
+		return
+	}
+	if err := dropCaptionVersion(assets, asset, version); err != nil && !errors.Is(err, errAssetNotFound) {
+		slog.Error("Failed to update captions of asset", "asset_id", assetID, "error", err)
+	}
+}
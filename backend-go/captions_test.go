@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCaptionKeyRoundTrip tests caption keys derived from the asset ID and version
+func TestCaptionKeyRoundTrip(t *testing.T) {
+	key := captionKey("asset-1", 3)
+	assert.Equal(t, "captions/asset-1/3.srt", key)
+
+	assetID, version, ok := parseCaptionKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, "asset-1", assetID)
+	assert.Equal(t, 3, version)
+
+	_, _, ok = parseCaptionKey("captions/1700000000.srt")
+	assert.False(t, ok, "legacy timestamp keys are not versioned")
+}
+
+// TestOriginalTranscript tests that edits never replace the machine transcript
+func TestOriginalTranscript(t *testing.T) {
+	asset := &Asset{ID: "a1"}
+	assert.Nil(t, asset.originalTranscript())
+
+	asset.CaptionVersions = []CaptionVersion{
+		{Version: 1, Key: captionKey("a1", 1), Source: "transcript"},
+		{Version: 2, Key: captionKey("a1", 2), Source: "edited"},
+	}
+	assert.Equal(t, 1, asset.originalTranscript().Version)
+}
+
+// TestListCaptionVersions tests GET /assets/:id/captions
+func TestListCaptionVersions(t *testing.T) {
+	ts := newTestServer(t)
+	store := ts.assets
+	keys := useTestTenants(ts, "alice")
+	store.Put(&Asset{ID: "a1", Owner: "alice", CaptionVersions: []CaptionVersion{
+		{Version: 1, Key: captionKey("a1", 1), Source: "transcript"},
+		{Version: 2, Key: captionKey("a1", 2), Source: "edited"},
+	}})
+
+	router := ts.router
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/assets/a1/captions", nil)
+	req.Header.Set("X-API-Key", keys["alice"])
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Versions []CaptionVersion `json:"versions"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Versions, 2)
+	assert.Equal(t, "captions/a1/2.srt", response.Versions[1].Key)
+}
+
+// TestSaveCaptionVersionConcurrent tests that saves racing on the same asset each get
+// their own version and none is dropped from the record
+func TestSaveCaptionVersionConcurrent(t *testing.T) {
+	storage := newFakeStorage()
+	store := newMemoryAssetStore()
+	store.Put(&Asset{ID: "a1", Owner: "alice"})
+
+	// Read before another save landed
+	stale, _ := store.Get("a1")
+	_, _, err := saveCaptionVersion(context.Background(), storage, store, &Asset{ID: "a1", Owner: "alice"}, []Caption{{Text: "first"}}, "transcript")
+	assert.NoError(t, err)
+	version, _, err := saveCaptionVersion(context.Background(), storage, store, stale, []Caption{{Text: "second"}}, "edited")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version.Version)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			asset, _ := store.Get("a1")
+			_, _, err := saveCaptionVersion(context.Background(), storage, store, asset, []Caption{{Text: "edit"}}, "edited")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	asset, _ := store.Get("a1")
+	var versions []int
+	for _, v := range asset.CaptionVersions {
+		versions = append(versions, v.Version)
+	}
+	assert.ElementsMatch(t, []int{1, 2, 3, 4, 5, 6}, versions)
+	srt, _, _ := storage.Get(context.Background(), captionKey("a1", 1))
+	assert.Contains(t, string(srt), "first")
+}
+
+// brokenStorage fails every write
+type brokenStorage struct {
+	*fakeStorage
+}
+
+func (b brokenStorage) Put(ctx context.Context, key, contentType string, body io.Reader, metadata map[string]string) (string, error) {
+	return "", errors.New("storage unavailable")
+}
+
+// TestSaveCaptionVersionFailedWrite tests that a version whose file was not written
+// is released so the asset never points at a missing caption file
+func TestSaveCaptionVersionFailedWrite(t *testing.T) {
+	store := newMemoryAssetStore()
+	store.Put(&Asset{ID: "a1", Owner: "alice"})
+	asset, _ := store.Get("a1")
+
+	_, _, err := saveCaptionVersion(context.Background(), brokenStorage{newFakeStorage()}, store, asset, []Caption{{Text: "lost"}}, "transcript")
+	assert.Error(t, err)
+	assert.Empty(t, asset.CaptionVersions)
+	stored, _ := store.Get("a1")
+	assert.Empty(t, stored.CaptionVersions)
+	assert.Nil(t, stored.originalTranscript())
+
+	// The next save takes the released number
+	version, _, err := saveCaptionVersion(context.Background(), newFakeStorage(), store, stored, []Caption{{Text: "kept"}}, "transcript")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version.Version)
+}
+
+// TestRemoveCaptionVersion tests dropping an expired caption file from its asset
+func TestRemoveCaptionVersion(t *testing.T) {
+	store := newMemoryAssetStore()
+	store.Put(&Asset{ID: "a1", CaptionVersions: []CaptionVersion{
+		{Version: 1, Key: captionKey("a1", 1)},
+		{Version: 2, Key: captionKey("a1", 2)},
+	}})
+	stale, _ := store.Get("a1")
+
+	removeCaptionVersion(store, "captions/a1/1.srt")
+
+	asset, _ := store.Get("a1")
+	assert.Len(t, asset.CaptionVersions, 1)
+	assert.Equal(t, 2, asset.CaptionVersions[0].Version)
+
+	// Versions removed or added after the asset was read are kept track of
+	store.AddCaptionVersion("a1", 1, CaptionVersion{Version: 3, Key: captionKey("a1", 3)})
+	assert.NoError(t, dropCaptionVersion(store, stale, 2))
+	asset, _ = store.Get("a1")
+	assert.Equal(t, []CaptionVersion{{Version: 3, Key: captionKey("a1", 3)}}, asset.CaptionVersions)
+}
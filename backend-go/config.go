@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the backend, loaded once at startup
+type Config struct {
+	Port            string
+	ShutdownTimeout time.Duration
+	LogLevel        slog.Level
+	Tracing         TracingConfig
+	Health          HealthConfig
+
+	AWSRegion           string
+	S3Bucket            string
+	SQSQueueURL         string
+	SQSHighPriorityURL  string
+	SQSLowPriorityURL   string
+	SQSDeadLetterURL    string
+	DynamoDBTable       string
+	DynamoDBAssetsTable string
+
+	AssemblyAIKey string
+	RemotionURL   string
+	RenderAPIKey  string
+	Remotion      RemotionConfig
+	RenderRetry   RenderRetryPolicy
+	Queue         QueueConfig
+	Worker        WorkerConfig
+
+	AdminAPIKey string
+	Auth        AuthConfig
+
+	CORS       CORSConfig
+	Presign    PresignPolicy
+	Retention  RetentionPolicy
+	Reconcile  ReconcilePolicy
+	RateLimits RateLimits
+	Quotas     Quotas
+}
+
+// AuthConfig controls how callers are authenticated
+type AuthConfig struct {
+	JWTSecret   string
+	JWTIssuer   string
+	JWTAudience string
+	Disabled    bool // local development only
+}
+
+// configSource looks up a setting by its environment variable name
+type configSource func(key string) string
+
+// newConfigSource layers the process environment over .env files over an optional YAML file.
+// YAML keys are upper-cased and nested keys joined with "_", so cors: {allowed_origins: [...]}
+// sets CORS_ALLOWED_ORIGINS.
+func newConfigSource(yamlPath string) (configSource, error) {
+	layers := []map[string]string{}
+
+	// ../.env wins over .env, as with the previous godotenv.Load order
+	for _, path := range []string{"../.env", ".env"} {
+		values, err := godotenv.Read(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		layers = append(layers, values)
+	}
+
+	if yamlPath != "" {
+		file, err := os.Open(yamlPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open config file: %v", err)
+		}
+		defer file.Close()
+		values, err := readYAMLConfig(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", yamlPath, err)
+		}
+		layers = append(layers, values)
+	}
+
+	return func(key string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		for _, layer := range layers {
+			if value := layer[key]; value != "" {
+				return value
+			}
+		}
+		return ""
+	}, nil
+}
+
+// readYAMLConfig flattens a YAML document into environment-style keys
+func readYAMLConfig(r io.Reader) (map[string]string, error) {
+	var doc map[string]interface{}
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil && err != io.EOF {
+		return nil, err
+	}
+	values := make(map[string]string)
+	if err := flattenYAML("", doc, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func flattenYAML(prefix string, node map[string]interface{}, values map[string]string) error {
+	for key, value := range node {
+		name := strings.ToUpper(key)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flattenYAML(name, v, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				if _, nested := item.(map[string]interface{}); nested {
+					return fmt.Errorf("%s: lists may only hold plain values", name)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, ",")
+		case nil:
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// loadConfig reads and validates the configuration. All problems are reported together,
+// and the partially loaded config is returned alongside them.
+func loadConfig(getenv configSource) (*Config, error) {
+	var errs []error
+	withDefault := func(key, fallback string) string {
+		if value := getenv(key); value != "" {
+			return value
+		}
+		return fallback
+	}
+
+	cfg := &Config{
+		Port:                withDefault("PORT", "7070"),
+		AWSRegion:           withDefault("AWS_REGION", "us-east-1"),
+		S3Bucket:            getenv("S3_BUCKET"),
+		SQSQueueURL:         getenv("SQS_QUEUE_URL"),
+		SQSHighPriorityURL:  getenv("SQS_QUEUE_URL_HIGH"),
+		SQSLowPriorityURL:   getenv("SQS_QUEUE_URL_LOW"),
+		SQSDeadLetterURL:    getenv("SQS_DLQ_URL"),
+		DynamoDBTable:       getenv("DYNAMODB_TABLE"),
+		DynamoDBAssetsTable: getenv("DYNAMODB_ASSETS_TABLE"),
+		AssemblyAIKey:       getenv("ASSEMBLYAI_KEY"),
+		RemotionURL:         strings.TrimRight(withDefault("RENDER_REMOTION_URL", "http://localhost:3000"), "/"),
+		RenderAPIKey:        getenv("RENDER_API_KEY"),
+		AdminAPIKey:         getenv("ADMIN_API_KEY"),
+		Auth: AuthConfig{
+			JWTSecret:   getenv("JWT_SECRET"),
+			JWTIssuer:   getenv("JWT_ISSUER"),
+			JWTAudience: getenv("JWT_AUDIENCE"),
+		},
+	}
+
+	cfg.ShutdownTimeout = 25 * time.Second
+	if raw := getenv("SHUTDOWN_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			errs = append(errs, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q", raw))
+		} else {
+			cfg.ShutdownTimeout = timeout
+		}
+	}
+
+	if raw := getenv("LOG_LEVEL"); raw != "" {
+		level, err := parseLogLevel(raw)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		cfg.LogLevel = level
+	}
+
+	if raw := getenv("AUTH_DISABLED"); raw != "" {
+		disabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid AUTH_DISABLED %q", raw))
+		}
+		cfg.Auth.Disabled = disabled
+	}
+
+	var err error
+	if cfg.Tracing, err = loadTracingConfig(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Remotion, err = loadRemotionConfig(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.RenderRetry, err = loadRenderRetryPolicy(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Queue, err = loadQueueConfig(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Worker, err = loadWorkerConfig(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Health, err = loadHealthConfig(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.CORS, err = loadCORSConfig(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Presign, err = loadPresignPolicy(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Retention, err = loadRetentionPolicy(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Reconcile, err = loadReconcilePolicy(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.RateLimits, err = loadRateLimits(getenv); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Quotas, err = loadQuotas(getenv); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, cfg.validate()...)
+	return cfg, errors.Join(errs...)
+}
+
+// validate checks required settings and combinations that only fail at runtime otherwise
+func (cfg *Config) validate() []error {
+	var errs []error
+	if cfg.AssemblyAIKey == "" {
+		errs = append(errs, errors.New("ASSEMBLYAI_KEY is required"))
+	}
+	if cfg.S3Bucket == "" {
+		errs = append(errs, errors.New("S3_BUCKET is required"))
+	}
+	if cfg.SQSQueueURL != "" && cfg.DynamoDBTable == "" {
+		errs = append(errs, errors.New("SQS_QUEUE_URL requires DYNAMODB_TABLE"))
+	}
+	if cfg.Queue.Backend == "sqs" && cfg.SQSQueueURL == "" {
+		errs = append(errs, errors.New("QUEUE_BACKEND sqs requires SQS_QUEUE_URL"))
+	}
+	if cfg.Queue.Backend == "redis" && cfg.Queue.RedisURL == "" {
+		errs = append(errs, errors.New("QUEUE_BACKEND redis requires REDIS_URL"))
+	}
+	if cfg.Queue.Backend == "redis" && cfg.DynamoDBTable == "" {
+		// Workers in other processes read the jobs
+		errs = append(errs, errors.New("QUEUE_BACKEND redis requires DYNAMODB_TABLE"))
+	}
+	if cfg.SQSDeadLetterURL != "" && cfg.SQSQueueURL == "" {
+		errs = append(errs, errors.New("SQS_DLQ_URL requires SQS_QUEUE_URL"))
+	}
+	if (cfg.SQSHighPriorityURL != "" || cfg.SQSLowPriorityURL != "") && cfg.SQSQueueURL == "" {
+		errs = append(errs, errors.New("SQS_QUEUE_URL_HIGH and SQS_QUEUE_URL_LOW require SQS_QUEUE_URL"))
+	}
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid PORT %q", cfg.Port))
+	}
+	if u, err := url.Parse(cfg.RemotionURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid RENDER_REMOTION_URL %q, expected http(s)://host", cfg.RemotionURL))
+	}
+	if cfg.Remotion.CallbackURL != "" && cfg.RenderAPIKey == "" {
+		errs = append(errs, errors.New("RENDER_CALLBACK_URL requires RENDER_API_KEY"))
+	}
+	if cfg.Auth.JWTSecret == "" && (cfg.Auth.JWTIssuer != "" || cfg.Auth.JWTAudience != "") {
+		errs = append(errs, errors.New("JWT_ISSUER and JWT_AUDIENCE require JWT_SECRET"))
+	}
+	return errs
+}
+
+// configSetting is one resolved setting as printed by --print-config
+type configSetting struct {
+	Key    string
+	Value  string
+	Secret bool
+}
+
+// settings lists the resolved configuration in environment variable form
+func (cfg *Config) settings() []configSetting {
+	duration := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	minutes := func(m float64) string {
+		if m == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(m, 'f', -1, 64)
+	}
+
+	settings := []configSetting{
+		{Key: "PORT", Value: cfg.Port},
+		{Key: "SHUTDOWN_TIMEOUT", Value: duration(cfg.ShutdownTimeout)},
+		{Key: "LOG_LEVEL", Value: strings.ToLower(cfg.LogLevel.String())},
+		{Key: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: cfg.Tracing.Endpoint},
+		{Key: "OTEL_SERVICE_NAME", Value: cfg.Tracing.ServiceName},
+		{Key: "TRACE_SAMPLE_RATIO", Value: strconv.FormatFloat(cfg.Tracing.SampleRatio, 'f', -1, 64)},
+		{Key: "READYZ_TIMEOUT", Value: duration(cfg.Health.Timeout)},
+		{Key: "READYZ_CACHE_TTL", Value: duration(cfg.Health.CacheTTL)},
+		{Key: "READYZ_OPTIONAL", Value: strings.Join(cfg.Health.optionalList(), ",")},
+		{Key: "AWS_REGION", Value: cfg.AWSRegion},
+		{Key: "S3_BUCKET", Value: cfg.S3Bucket},
+		{Key: "SQS_QUEUE_URL", Value: cfg.SQSQueueURL},
+		{Key: "SQS_QUEUE_URL_HIGH", Value: cfg.SQSHighPriorityURL},
+		{Key: "SQS_QUEUE_URL_LOW", Value: cfg.SQSLowPriorityURL},
+		{Key: "SQS_DLQ_URL", Value: cfg.SQSDeadLetterURL},
+		{Key: "QUEUE_BACKEND", Value: cfg.Queue.Backend},
+		{Key: "QUEUE_CAPACITY", Value: strconv.Itoa(cfg.Queue.Capacity)},
+		{Key: "QUEUE_MAX_DELIVERIES", Value: strconv.Itoa(cfg.Queue.MaxDeliveries)},
+		{Key: "REDIS_URL", Value: cfg.Queue.RedisURL, Secret: true},
+		{Key: "REDIS_STREAM", Value: cfg.Queue.RedisStream},
+		{Key: "REDIS_GROUP", Value: cfg.Queue.RedisGroup},
+		{Key: "RENDER_PRIORITY_DEFAULT", Value: cfg.Queue.DefaultPriority},
+		{Key: "RENDER_PRIORITY_TENANTS", Value: cfg.Queue.tenantPriorityList()},
+		{Key: "WORKER_CONCURRENCY", Value: strconv.Itoa(cfg.Worker.Concurrency)},
+		{Key: "WORKER_LEASE_TIMEOUT", Value: duration(cfg.Worker.LeaseTimeout)},
+		{Key: "DYNAMODB_TABLE", Value: cfg.DynamoDBTable},
+		{Key: "DYNAMODB_ASSETS_TABLE", Value: cfg.DynamoDBAssetsTable},
+		{Key: "ASSEMBLYAI_KEY", Value: cfg.AssemblyAIKey, Secret: true},
+		{Key: "RENDER_REMOTION_URL", Value: cfg.RemotionURL},
+		{Key: "RENDER_API_KEY", Value: cfg.RenderAPIKey, Secret: true},
+		{Key: "RENDER_MAX_ATTEMPTS", Value: strconv.Itoa(cfg.RenderRetry.MaxAttempts)},
+		{Key: "RENDER_RETRY_BASE_DELAY", Value: duration(cfg.RenderRetry.BaseDelay)},
+		{Key: "RENDER_RETRY_MAX_DELAY", Value: duration(cfg.RenderRetry.MaxDelay)},
+		{Key: "REMOTION_TIMEOUT", Value: duration(cfg.Remotion.Timeout)},
+		{Key: "REMOTION_POLL_INTERVAL", Value: duration(cfg.Remotion.PollInterval)},
+		{Key: "RENDER_CALLBACK_URL", Value: cfg.Remotion.CallbackURL},
+		{Key: "REMOTION_MAX_ATTEMPTS", Value: strconv.Itoa(cfg.Remotion.MaxAttempts)},
+		{Key: "REMOTION_RETRY_BASE_DELAY", Value: duration(cfg.Remotion.RetryBaseDelay)},
+		{Key: "REMOTION_BREAKER_THRESHOLD", Value: strconv.Itoa(cfg.Remotion.BreakerThreshold)},
+		{Key: "REMOTION_BREAKER_COOLDOWN", Value: duration(cfg.Remotion.BreakerCooldown)},
+		{Key: "ADMIN_API_KEY", Value: cfg.AdminAPIKey, Secret: true},
+		{Key: "JWT_SECRET", Value: cfg.Auth.JWTSecret, Secret: true},
+		{Key: "JWT_ISSUER", Value: cfg.Auth.JWTIssuer},
+		{Key: "JWT_AUDIENCE", Value: cfg.Auth.JWTAudience},
+		{Key: "AUTH_DISABLED", Value: strconv.FormatBool(cfg.Auth.Disabled)},
+		{Key: "CORS_ALLOWED_ORIGINS", Value: strings.Join(cfg.CORS.AllowedOrigins, ",")},
+		{Key: "CORS_ALLOWED_METHODS", Value: strings.Join(cfg.CORS.AllowedMethods, ",")},
+		{Key: "CORS_ALLOWED_HEADERS", Value: strings.Join(cfg.CORS.AllowedHeaders, ",")},
+		{Key: "CORS_ALLOW_CREDENTIALS", Value: strconv.FormatBool(cfg.CORS.AllowCredentials)},
+		{Key: "CORS_MAX_AGE", Value: strconv.Itoa(cfg.CORS.MaxAge)},
+		{Key: "PRESIGN_ALLOWED_PREFIXES", Value: strings.Join(cfg.Presign.AllowedPrefixes, ",")},
+		{Key: "PRESIGN_DEFAULT_EXPIRY", Value: duration(cfg.Presign.DefaultExpiry)},
+		{Key: "PRESIGN_MAX_EXPIRY", Value: duration(cfg.Presign.MaxExpiry)},
+		{Key: "RETENTION_SWEEP_INTERVAL", Value: duration(cfg.Retention.Interval)},
+	}
+	for _, p := range retentionPrefixes {
+		var ttl time.Duration
+		for _, rule := range cfg.Retention.Rules {
+			if rule.Prefix == p.prefix {
+				ttl = rule.TTL
+			}
+		}
+		settings = append(settings, configSetting{Key: p.env, Value: duration(ttl)})
+	}
+	return append(settings,
+		configSetting{Key: "JOB_LEASE", Value: duration(cfg.Reconcile.Lease)},
+		configSetting{Key: "RECONCILE_STALE_JOBS", Value: cfg.Reconcile.action()},
+		configSetting{Key: "RATE_LIMIT_UPLOAD", Value: cfg.RateLimits.Upload.String()},
+		configSetting{Key: "RATE_LIMIT_TRANSCRIBE", Value: cfg.RateLimits.Transcribe.String()},
+		configSetting{Key: "RATE_LIMIT_RENDER", Value: cfg.RateLimits.Render.String()},
+		configSetting{Key: "QUOTA_TRANSCRIBE_MINUTES", Value: minutes(cfg.Quotas.TranscribeMinutes)},
+		configSetting{Key: "QUOTA_RENDER_MINUTES", Value: minutes(cfg.Quotas.RenderMinutes)},
+	)
+}
+
+// printConfig writes the configuration as KEY=value lines with secrets redacted
+func printConfig(w io.Writer, cfg *Config) {
+	for _, s := range cfg.settings() {
+		value := s.Value
+		if s.Secret && value != "" {
+			value = "<redacted>"
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.Key, value)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mapSource serves settings from a map instead of the environment
+func mapSource(values map[string]string) configSource {
+	return func(key string) string { return values[key] }
+}
+
+// TestLoadConfigDefaults tests defaults applied to a minimal configuration
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig(mapSource(map[string]string{
+		"ASSEMBLYAI_KEY": "aai",
+		"S3_BUCKET":      "bucket",
+	}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "7070", cfg.Port)
+	assert.Equal(t, "us-east-1", cfg.AWSRegion)
+	assert.Equal(t, "http://localhost:3000", cfg.RemotionURL)
+	assert.Equal(t, 25*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, time.Hour, cfg.Presign.MaxExpiry)
+	assert.Equal(t, 30, cfg.RateLimits.Upload.Burst)
+	assert.False(t, cfg.Auth.Disabled)
+}
+
+// TestLoadConfigValidation tests that every problem is reported at once
+func TestLoadConfigValidation(t *testing.T) {
+	_, err := loadConfig(mapSource(map[string]string{
+		"SQS_QUEUE_URL":       "https://sqs.us-east-1.amazonaws.com/1/jobs",
+		"PORT":                "http",
+		"RENDER_REMOTION_URL": "remotion:3000",
+		"RATE_LIMIT_UPLOAD":   "lots",
+		"AUTH_DISABLED":       "maybe",
+		"SHUTDOWN_TIMEOUT":    "-5s",
+		"RENDER_CALLBACK_URL": "http://backend:7070",
+	}))
+
+	assert.Error(t, err)
+	for _, problem := range []string{
+		"ASSEMBLYAI_KEY is required",
+		"S3_BUCKET is required",
+		"SQS_QUEUE_URL requires DYNAMODB_TABLE",
+		"invalid PORT",
+		"invalid RENDER_REMOTION_URL",
+		"invalid RATE_LIMIT_UPLOAD",
+		"invalid AUTH_DISABLED",
+		"invalid SHUTDOWN_TIMEOUT",
+		"RENDER_CALLBACK_URL requires RENDER_API_KEY",
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+
+	_, err = loadConfig(mapSource(map[string]string{
+		"ASSEMBLYAI_KEY": "test-key",
+		"S3_BUCKET":      "test-bucket",
+		"SQS_DLQ_URL":    "https://sqs.us-east-1.amazonaws.com/1/jobs-dlq",
+	}))
+	assert.EqualError(t, err, "SQS_DLQ_URL requires SQS_QUEUE_URL")
+
+	_, err = loadConfig(mapSource(map[string]string{
+		"ASSEMBLYAI_KEY":    "test-key",
+		"S3_BUCKET":         "test-bucket",
+		"SQS_QUEUE_URL_LOW": "https://sqs.us-east-1.amazonaws.com/1/jobs-low",
+	}))
+	assert.EqualError(t, err, "SQS_QUEUE_URL_HIGH and SQS_QUEUE_URL_LOW require SQS_QUEUE_URL")
+
+	_, err = loadConfig(mapSource(map[string]string{
+		"ASSEMBLYAI_KEY": "test-key",
+		"S3_BUCKET":      "test-bucket",
+		"QUEUE_BACKEND":  "redis",
+	}))
+	assert.EqualError(t, err, "QUEUE_BACKEND redis requires REDIS_URL\nQUEUE_BACKEND redis requires DYNAMODB_TABLE")
+}
+
+// TestReadYAMLConfig tests flattening nested YAML into environment-style keys
+func TestReadYAMLConfig(t *testing.T) {
+	values, err := readYAMLConfig(strings.NewReader(`
+s3_bucket: media
+port: 8080
+cors:
+  allowed_origins:
+    - https://app.example.com
+    - https://*.example.org
+  allow_credentials: true
+quota:
+  render_minutes: 120
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"S3_BUCKET":              "media",
+		"PORT":                   "8080",
+		"CORS_ALLOWED_ORIGINS":   "https://app.example.com,https://*.example.org",
+		"CORS_ALLOW_CREDENTIALS": "true",
+		"QUOTA_RENDER_MINUTES":   "120",
+	}, values)
+}
+
+// TestPrintConfigRedactsSecrets tests the --print-config dump
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	cfg, err := loadConfig(mapSource(map[string]string{
+		"ASSEMBLYAI_KEY":        "aai-secret",
+		"S3_BUCKET":             "bucket",
+		"JWT_SECRET":            "jwt-secret",
+		"RATE_LIMIT_RENDER":     "off",
+		"RETENTION_UPLOADS_TTL": "30d",
+	}))
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	printConfig(&out, cfg)
+
+	assert.NotContains(t, out.String(), "aai-secret")
+	assert.NotContains(t, out.String(), "jwt-secret")
+	assert.Contains(t, out.String(), "ASSEMBLYAI_KEY=<redacted>\n")
+	assert.Contains(t, out.String(), "ADMIN_API_KEY=\n")
+	assert.Contains(t, out.String(), "S3_BUCKET=bucket\n")
+	assert.Contains(t, out.String(), "RATE_LIMIT_UPLOAD=30/m\n")
+	assert.Contains(t, out.String(), "RATE_LIMIT_RENDER=off\n")
+	assert.Contains(t, out.String(), "RETENTION_UPLOADS_TTL=720h0m0s\n")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	// AllowedOrigins holds exact origins ("https://app.example.com"),
+	// wildcard subdomains ("https://*.example.com") or "*" for any origin
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int // seconds
+}
+
+// splitList parses a comma separated env value
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadCORSConfig reads CORS_ALLOWED_ORIGINS, CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS,
+// CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE
+func loadCORSConfig(getenv configSource) (CORSConfig, error) {
+	cfg := CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
+		ExposedHeaders: []string{"Retry-After"},
+		MaxAge:         86400,
+	}
+
+	if raw := getenv("CORS_ALLOWED_ORIGINS"); raw != "" {
+		cfg.AllowedOrigins = splitList(raw)
+	}
+	if raw := getenv("CORS_ALLOWED_METHODS"); raw != "" {
+		cfg.AllowedMethods = splitList(strings.ToUpper(raw))
+	}
+	if raw := getenv("CORS_ALLOWED_HEADERS"); raw != "" {
+		cfg.AllowedHeaders = splitList(raw)
+	}
+	if raw := getenv("CORS_ALLOW_CREDENTIALS"); raw != "" {
+		allow, err := strconv.ParseBool(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS %q", raw)
+		}
+		cfg.AllowCredentials = allow
+	}
+	if raw := getenv("CORS_MAX_AGE"); raw != "" {
+		maxAge, err := strconv.Atoi(raw)
+		if err != nil || maxAge < 0 {
+			return cfg, fmt.Errorf("invalid CORS_MAX_AGE %q", raw)
+		}
+		cfg.MaxAge = maxAge
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" && cfg.AllowCredentials {
+			// Any site could read responses sent with the user's cookies
+			return cfg, errors.New("CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS to list origins instead of \"*\"")
+		}
+		if origin != "*" && !strings.Contains(origin, "://") {
+			return cfg, fmt.Errorf("invalid CORS origin %q, expected scheme://host", origin)
+		}
+	}
+	return cfg, nil
+}
+
+// allowsOrigin matches an Origin header against the allow-list
+func (cfg CORSConfig) allowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// "https://*.example.com" matches any subdomain, but not example.com itself
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			continue
+		}
+		prefix := scheme + "://"
+		if strings.HasPrefix(origin, prefix) {
+			originHost := strings.ToLower(strings.TrimPrefix(origin, prefix))
+			if strings.HasSuffix(originHost, "."+strings.ToLower(host)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsMethod reports whether a preflighted method is allowed
+func (cfg CORSConfig) allowsMethod(method string) bool {
+	for _, allowed := range cfg.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether every preflighted request header is allowed
+func (cfg CORSConfig) allowsHeaders(requested string) bool {
+	for _, header := range splitList(requested) {
+		found := false
+		for _, allowed := range cfg.AllowedHeaders {
+			if strings.EqualFold(allowed, header) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// corsMiddleware applies the CORS policy and answers preflight requests
+func corsMiddleware(cfg CORSConfig) gin.HandlerFunc {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAge)
+
+	wildcardOnly := len(cfg.AllowedOrigins) == 1 && cfg.AllowedOrigins[0] == "*"
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		// The response depends on Origin unless every origin gets "*"
+		if !wildcardOnly || cfg.AllowCredentials {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+
+		if !cfg.allowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// Not a CORS request, or an origin we don't serve: no CORS headers
+			c.Next()
+			return
+		}
+
+		// Credentialed responses must echo the origin instead of "*"
+		if wildcardOnly && !cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposed != "" {
+				c.Header("Access-Control-Expose-Headers", exposed)
+			}
+			c.Next()
+			return
+		}
+
+		if !cfg.allowsMethod(c.GetHeader("Access-Control-Request-Method")) ||
+			!cfg.allowsHeaders(c.GetHeader("Access-Control-Request-Headers")) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Header("Access-Control-Allow-Methods", methods)
+		c.Header("Access-Control-Allow-Headers", headers)
+		c.Header("Access-Control-Max-Age", maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupCORSRouter creates a test server's router with the given CORS policy
+func setupCORSRouter(t *testing.T, cfg CORSConfig) *gin.Engine {
+	return newTestServer(t, func(c *Config) { c.CORS = cfg }).router
+}
+
+// preflight sends an OPTIONS request as a browser would before a cross-origin POST
+func preflight(router *gin.Engine, origin, method, headers string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "/render-job", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestLoadCORSConfig tests CORS settings from the environment
+func TestLoadCORSConfig(t *testing.T) {
+	cfg, err := loadCORSConfig(mapSource(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*"}, cfg.AllowedOrigins)
+	assert.Contains(t, cfg.AllowedHeaders, "X-API-Key")
+	assert.False(t, cfg.AllowCredentials)
+
+	cfg, err = loadCORSConfig(mapSource(map[string]string{
+		"CORS_ALLOWED_ORIGINS":   "https://app.example.com, https://*.example.org",
+		"CORS_ALLOW_CREDENTIALS": "true",
+		"CORS_ALLOWED_METHODS":   "get,post",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://app.example.com", "https://*.example.org"}, cfg.AllowedOrigins)
+	assert.Equal(t, []string{"GET", "POST"}, cfg.AllowedMethods)
+	assert.True(t, cfg.AllowCredentials)
+
+	_, err = loadCORSConfig(mapSource(map[string]string{"CORS_ALLOWED_ORIGINS": "app.example.com"}))
+	assert.Error(t, err)
+}
+
+// TestLoadCORSConfigCredentialsWithAnyOrigin tests that credentials cannot be shared with every origin
+func TestLoadCORSConfigCredentialsWithAnyOrigin(t *testing.T) {
+	_, err := loadCORSConfig(mapSource(map[string]string{"CORS_ALLOW_CREDENTIALS": "true"}))
+	assert.EqualError(t, err, `CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS to list origins instead of "*"`)
+
+	_, err = loadCORSConfig(mapSource(map[string]string{
+		"CORS_ALLOWED_ORIGINS":   "https://app.example.com,*",
+		"CORS_ALLOW_CREDENTIALS": "true",
+	}))
+	assert.Error(t, err)
+}
+
+// TestCORSAllowsOrigin tests exact and wildcard subdomain matching
+func TestCORSAllowsOrigin(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"}}
+
+	assert.True(t, cfg.allowsOrigin("https://app.example.com"))
+	assert.False(t, cfg.allowsOrigin("http://app.example.com"))
+	assert.False(t, cfg.allowsOrigin("https://evil.example.com"))
+	assert.True(t, cfg.allowsOrigin("https://studio.example.org"))
+	assert.True(t, cfg.allowsOrigin("https://a.b.example.org"))
+	assert.False(t, cfg.allowsOrigin("https://example.org"))
+	assert.False(t, cfg.allowsOrigin("https://badexample.org"))
+	assert.False(t, cfg.allowsOrigin(""))
+}
+
+// TestCORSPreflight tests preflight responses for allowed and rejected requests
+func TestCORSPreflight(t *testing.T) {
+	router := setupCORSRouter(t, CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-API-Key"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})
+
+	w := preflight(router, "https://app.example.com", "POST", "content-type, x-api-key")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "X-API-Key")
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	w = preflight(router, "https://studio.example.org", "POST", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://studio.example.org", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = preflight(router, "https://evil.example.com", "POST", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = preflight(router, "https://app.example.com", "DELETE", "")
+	assert.Equal(t, http.StatusForbidden, w.Code, "method not allowed")
+
+	w = preflight(router, "https://app.example.com", "POST", "X-Custom")
+	assert.Equal(t, http.StatusForbidden, w.Code, "header not allowed")
+}
+
+// TestCORSSimpleRequest tests headers on actual cross-origin requests
+func TestCORSSimpleRequest(t *testing.T) {
+	router := setupCORSRouter(t, CORSConfig{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"Retry-After"}})
+
+	// Errors carry CORS headers too, so browsers can read them
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/render-job", nil)
+	req.Header.Set("Origin", "https://anywhere.test")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Retry-After", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	// Disallowed origins still reach the handler but get no CORS headers
+	router = setupCORSRouter(t, CORSConfig{AllowedOrigins: []string{"https://app.example.com"}})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/render-job", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+}
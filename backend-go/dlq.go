@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/gin-gonic/gin"
+)
+
+// deadLetterVisibility is how many seconds dead letters stay hidden from other readers
+// while they are listed or redriven
+const deadLetterVisibility = 30
+
+// maxDeadLetterScan bounds how many dead letters one list or redrive reads
+const maxDeadLetterScan = 1000
+
+// DeadLetter is a render job message SQS gave up delivering to the worker
+type DeadLetter struct {
+	MessageID    string            `json:"messageId"`
+	JobID        string            `json:"jobId,omitempty"`
+	ReceiveCount int               `json:"receiveCount"` // deliveries so far, listing counts as one
+	SentAt       time.Time         `json:"sentAt"`
+	Payload      json.RawMessage   `json:"payload"` // as sent by sqsJobQueue.Enqueue
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	JobStatus    string            `json:"jobStatus,omitempty"`
+	JobError     string            `json:"jobError,omitempty"`
+}
+
+// deadLetterQueue reads the SQS dead-letter queue of the render queue and sends
+// messages back to it
+type deadLetterQueue struct {
+	client sqsiface.SQSAPI
+	url    string
+	queue  *sqsJobQueue // render queues that redriven messages go back to, by priority
+}
+
+// List returns up to limit dead letters without removing them
+func (q *deadLetterQueue) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	messages, err := q.receive(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	q.release(ctx, messages)
+
+	letters := make([]DeadLetter, 0, len(messages))
+	for _, msg := range messages {
+		letters = append(letters, deadLetterFromMessage(msg))
+	}
+	return letters, nil
+}
+
+// Redrive sends the dead letters with the given message IDs back to the render queue
+// and removes them from the dead-letter queue, calling prepare before each is sent.
+// Letters prepare returns false for stay dead-lettered and are returned as skipped.
+// IDs that were not found are left out of both.
+func (q *deadLetterQueue) Redrive(ctx context.Context, messageIDs []string, prepare func(DeadLetter) bool) (redriven, skipped []DeadLetter, err error) {
+	wanted := map[string]bool{}
+	for _, id := range messageIDs {
+		wanted[id] = true
+	}
+	messages, err := q.receive(ctx, maxDeadLetterScan)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var others []*sqs.Message
+	for i, msg := range messages {
+		if !wanted[aws.StringValue(msg.MessageId)] {
+			others = append(others, msg)
+			continue
+		}
+		letter := deadLetterFromMessage(msg)
+		if !prepare(letter) {
+			others = append(others, msg)
+			skipped = append(skipped, letter)
+			continue
+		}
+		if err := q.redrive(ctx, msg); err != nil {
+			q.release(ctx, append(others, messages[i:]...))
+			return redriven, skipped, err
+		}
+		redriven = append(redriven, letter)
+	}
+	q.release(ctx, others)
+	return redriven, skipped, nil
+}
+
+// redrive copies msg to the render queue of its priority, continuing the current trace,
+// then deletes it
+func (q *deadLetterQueue) redrive(ctx context.Context, msg *sqs.Message) error {
+	attributes := msg.MessageAttributes
+	if attributes == nil {
+		attributes = map[string]*sqs.MessageAttributeValue{}
+	}
+	for key, value := range traceMessageAttributes(ctx) {
+		attributes[key] = value
+	}
+	_, err := q.client.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(q.queue.urlFor(parseJobMessage(aws.StringValue(msg.Body)).Priority)),
+		MessageBody:       msg.Body,
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send message %s to the render queue: %v", aws.StringValue(msg.MessageId), err)
+	}
+	_, err = q.client.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.url),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		// Already back in the render queue, a later redrive would queue it twice
+		loggerFrom(ctx).Warn("Failed to delete redriven message from the dead-letter queue",
+			"message_id", aws.StringValue(msg.MessageId), "error", err)
+	}
+	return nil
+}
+
+// receive reads up to limit messages. Each stays hidden for deadLetterVisibility so
+// that later batches return new ones.
+func (q *deadLetterQueue) receive(ctx context.Context, limit int) ([]*sqs.Message, error) {
+	var messages []*sqs.Message
+	seen := map[string]bool{}
+	for len(messages) < limit {
+		batch := int64(10)
+		if remaining := limit - len(messages); remaining < 10 {
+			batch = int64(remaining)
+		}
+		result, err := q.client.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(q.url),
+			MaxNumberOfMessages:   aws.Int64(batch),
+			VisibilityTimeout:     aws.Int64(deadLetterVisibility),
+			WaitTimeSeconds:       aws.Int64(1),
+			AttributeNames:        aws.StringSlice([]string{sqs.MessageSystemAttributeNameAll}),
+			MessageAttributeNames: aws.StringSlice([]string{"All"}),
+		})
+		if err != nil {
+			q.release(ctx, messages)
+			return nil, fmt.Errorf("failed to read dead-letter queue: %v", err)
+		}
+		if len(result.Messages) == 0 {
+			break
+		}
+		for _, msg := range result.Messages {
+			if id := aws.StringValue(msg.MessageId); !seen[id] {
+				seen[id] = true
+				messages = append(messages, msg)
+			}
+		}
+	}
+	return messages, nil
+}
+
+// release makes messages visible again right away
+func (q *deadLetterQueue) release(ctx context.Context, messages []*sqs.Message) {
+	for start := 0; start < len(messages); start += 10 {
+		end := start + 10
+		if end > len(messages) {
+			end = len(messages)
+		}
+		var entries []*sqs.ChangeMessageVisibilityBatchRequestEntry
+		for i, msg := range messages[start:end] {
+			entries = append(entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     msg.ReceiptHandle,
+				VisibilityTimeout: aws.Int64(0),
+			})
+		}
+		_, err := q.client.ChangeMessageVisibilityBatchWithContext(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(q.url),
+			Entries:  entries,
+		})
+		if err != nil {
+			// They reappear once the visibility timeout passes
+			loggerFrom(ctx).Warn("Failed to release dead letters", "error", err)
+		}
+	}
+}
+
+// deadLetterFromMessage decodes the job message written by sqsJobQueue.Enqueue
+func deadLetterFromMessage(msg *sqs.Message) DeadLetter {
+	letter := DeadLetter{MessageID: aws.StringValue(msg.MessageId)}
+	body := aws.StringValue(msg.Body)
+	if json.Valid([]byte(body)) {
+		letter.Payload = json.RawMessage(body)
+		letter.JobID = parseJobMessage(body).JobID
+	} else {
+		letter.Payload, _ = json.Marshal(body)
+	}
+
+	letter.ReceiveCount, _ = strconv.Atoi(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+	if sent, err := strconv.ParseInt(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]), 10, 64); err == nil {
+		letter.SentAt = time.UnixMilli(sent).UTC()
+	}
+	for key, value := range msg.MessageAttributes {
+		if letter.Attributes == nil {
+			letter.Attributes = map[string]string{}
+		}
+		letter.Attributes[key] = aws.StringValue(value.StringValue)
+	}
+	return letter
+}
+
+// listDeadLettersHandler handles GET /admin/dead-letters, showing each dead letter
+// with the current state of its job
+func (s *Server) listDeadLettersHandler(c *gin.Context) {
+	if s.DeadLetters == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead-letter queue not configured"})
+		return
+	}
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxDeadLetterScan {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxDeadLetterScan)})
+			return
+		}
+		limit = parsed
+	}
+
+	letters, err := s.DeadLetters.List(c.Request.Context(), limit)
+	if err != nil {
+		loggerFrom(c.Request.Context()).Error("Failed to list dead letters", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read dead-letter queue"})
+		return
+	}
+	for i := range letters {
+		if job, err := s.Jobs.Get(letters[i].JobID); err == nil {
+			letters[i].JobStatus = job.Status
+			letters[i].JobError = job.Error
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"deadLetters": letters, "count": len(letters)})
+}
+
+// redriveDeadLettersHandler handles POST /admin/dead-letters/redrive, sending the
+// selected messages back to the render queue and marking their jobs pending again.
+// Messages of jobs that completed since are skipped.
+func (s *Server) redriveDeadLettersHandler(c *gin.Context) {
+	if s.DeadLetters == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead-letter queue not configured"})
+		return
+	}
+	var req struct {
+		MessageIDs []string `json:"messageIds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.MessageIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "messageIds is required"})
+		return
+	}
+
+	// Jobs are marked pending before their message is sent, so the worker's update wins
+	ctx := c.Request.Context()
+	logger := loggerFrom(ctx)
+	letters, skippedLetters, redriveErr := s.DeadLetters.Redrive(ctx, req.MessageIDs, func(letter DeadLetter) bool {
+		return s.requeueDeadLetteredJob(ctx, letter.JobID)
+	})
+
+	redriven, skipped := []string{}, []string{}
+	done := map[string]bool{}
+	for _, letter := range letters {
+		redriven = append(redriven, letter.MessageID)
+		done[letter.MessageID] = true
+	}
+	for _, letter := range skippedLetters {
+		skipped = append(skipped, letter.MessageID)
+		done[letter.MessageID] = true
+	}
+	if redriveErr != nil {
+		logger.Error("Failed to redrive dead letters", "error", redriveErr)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to redrive all messages", "redriven": redriven, "skipped": skipped})
+		return
+	}
+	notFound := []string{}
+	for _, id := range req.MessageIDs {
+		if !done[id] {
+			notFound = append(notFound, id)
+		}
+	}
+	logger.Info("Dead letters redriven", "count", len(redriven), "skipped", len(skipped), "not_found", len(notFound))
+	c.JSON(http.StatusOK, gin.H{"redriven": redriven, "skipped": skipped, "notFound": notFound})
+}
+
+// requeueDeadLetteredJob marks a redriven job pending so clients see it queued again.
+// It returns false for a job that already completed, whose output and history are kept.
+func (s *Server) requeueDeadLetteredJob(ctx context.Context, jobID string) bool {
+	job, err := s.Jobs.Get(jobID)
+	if err != nil {
+		loggerFrom(ctx).Warn("Redriven message has no job", "job_id", jobID, "error", err)
+		return true
+	}
+	if job.Status == "completed" {
+		return false
+	}
+	status := job.Status
+	job.Status = "pending"
+	job.Error = ""
+	job.Progress = 0
+	job.RenderID = ""
+	job.UpdatedAt = time.Now()
+	job.enterStage(stageQueued, job.UpdatedAt)
+	err = s.Jobs.PutIfStatus(job, status)
+	if errors.Is(err, errJobStatusChanged) {
+		// A worker updated it since it was read, its state wins
+		current, err := s.Jobs.Get(jobID)
+		return err != nil || current.Status != "completed"
+	}
+	if err != nil {
+		loggerFrom(ctx).Error("Failed to save redriven job", "job_id", jobID, "error", err)
+	}
+	return true
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSQS keeps messages per queue URL in memory and honours visibility timeouts
+type fakeSQS struct {
+	sqsiface.SQSAPI
+
+	mu        sync.Mutex
+	queues    map[string][]*fakeMessage
+	now       time.Time
+	nextID    int
+	sendErr   error
+	lastDelay int64 // DelaySeconds of the last message sent
+
+	visibilityChanges int
+}
+
+type fakeMessage struct {
+	msg          *sqs.Message
+	visibleAt    time.Time
+	receiveCount int
+}
+
+func newFakeSQS() *fakeSQS {
+	return &fakeSQS{queues: map[string][]*fakeMessage{}, now: time.Now()}
+}
+
+// add puts a message with body on queue and returns its ID
+func (f *fakeSQS) add(queue, body string, attributes map[string]string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("msg-%d", f.nextID)
+	msg := &sqs.Message{
+		MessageId:  aws.String(id),
+		Body:       aws.String(body),
+		Attributes: map[string]*string{sqs.MessageSystemAttributeNameSentTimestamp: aws.String(strconv.FormatInt(f.now.UnixMilli(), 10))},
+	}
+	for key, value := range attributes {
+		if msg.MessageAttributes == nil {
+			msg.MessageAttributes = map[string]*sqs.MessageAttributeValue{}
+		}
+		msg.MessageAttributes[key] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+	}
+	f.queues[queue] = append(f.queues[queue], &fakeMessage{msg: msg})
+	return id
+}
+
+// bodies returns the bodies of all messages on queue, visible or not
+func (f *fakeSQS) bodies(queue string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var bodies []string
+	for _, m := range f.queues[queue] {
+		bodies = append(bodies, aws.StringValue(m.msg.Body))
+	}
+	return bodies
+}
+
+// visible counts the messages on queue that can be received now
+func (f *fakeSQS) visible(queue string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, m := range f.queues[queue] {
+		if !f.now.Before(m.visibleAt) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, in *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	out := f.receive(in)
+	if len(out.Messages) == 0 && aws.Int64Value(in.WaitTimeSeconds) > 0 {
+		// Stand in for a long poll without slowing tests down
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) receive(in *sqs.ReceiveMessageInput) *sqs.ReceiveMessageOutput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &sqs.ReceiveMessageOutput{}
+	for _, m := range f.queues[aws.StringValue(in.QueueUrl)] {
+		if int64(len(out.Messages)) >= aws.Int64Value(in.MaxNumberOfMessages) {
+			break
+		}
+		if f.now.Before(m.visibleAt) {
+			continue
+		}
+		m.receiveCount++
+		m.visibleAt = f.now.Add(time.Duration(aws.Int64Value(in.VisibilityTimeout)) * time.Second)
+		received := *m.msg
+		received.ReceiptHandle = aws.String(fmt.Sprintf("%s-%d", aws.StringValue(m.msg.MessageId), m.receiveCount))
+		received.Attributes = map[string]*string{sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(strconv.Itoa(m.receiveCount))}
+		for key, value := range m.msg.Attributes {
+			received.Attributes[key] = value
+		}
+		out.Messages = append(out.Messages, &received)
+	}
+	return out
+}
+
+// find returns the message a current receipt handle refers to
+func (f *fakeSQS) find(queue, handle string) (int, *fakeMessage) {
+	for i, m := range f.queues[queue] {
+		if fmt.Sprintf("%s-%d", aws.StringValue(m.msg.MessageId), m.receiveCount) == handle {
+			return i, m
+		}
+	}
+	return -1, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibilityBatchWithContext(ctx aws.Context, in *sqs.ChangeMessageVisibilityBatchInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, entry := range in.Entries {
+		if _, m := f.find(aws.StringValue(in.QueueUrl), aws.StringValue(entry.ReceiptHandle)); m != nil {
+			m.visibleAt = f.now.Add(time.Duration(aws.Int64Value(entry.VisibilityTimeout)) * time.Second)
+		}
+	}
+	return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibilityWithContext(ctx aws.Context, in *sqs.ChangeMessageVisibilityInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.visibilityChanges++
+	_, m := f.find(aws.StringValue(in.QueueUrl), aws.StringValue(in.ReceiptHandle))
+	if m == nil {
+		return nil, errors.New("ReceiptHandleIsInvalid")
+	}
+	m.visibleAt = f.now.Add(time.Duration(aws.Int64Value(in.VisibilityTimeout)) * time.Second)
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (f *fakeSQS) DeleteMessageWithContext(ctx aws.Context, in *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queue := aws.StringValue(in.QueueUrl)
+	i, m := f.find(queue, aws.StringValue(in.ReceiptHandle))
+	if m == nil {
+		return nil, errors.New("ReceiptHandleIsInvalid")
+	}
+	f.queues[queue] = append(f.queues[queue][:i], f.queues[queue][i+1:]...)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) SendMessageWithContext(ctx aws.Context, in *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+	attributes := map[string]string{}
+	for key, value := range in.MessageAttributes {
+		attributes[key] = aws.StringValue(value.StringValue)
+	}
+	queue := aws.StringValue(in.QueueUrl)
+	id := f.add(queue, aws.StringValue(in.MessageBody), attributes)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastDelay = aws.Int64Value(in.DelaySeconds)
+	sent := f.queues[queue][len(f.queues[queue])-1]
+	sent.visibleAt = f.now.Add(time.Duration(f.lastDelay) * time.Second)
+	return &sqs.SendMessageOutput{MessageId: aws.String(id)}, nil
+}
+
+const (
+	testQueueURL     = "https://sqs.local/render-queue"
+	testHighQueueURL = "https://sqs.local/render-queue-high"
+	testDLQURL       = "https://sqs.local/render-dlq"
+)
+
+// deadLetterServer builds a test server with a dead-letter queue holding one message per job
+func deadLetterServer(t *testing.T, jobIDs ...string) (*testServer, *fakeSQS, []string) {
+	client := newFakeSQS()
+	var messageIDs []string
+	for _, id := range jobIDs {
+		body, _ := json.Marshal(map[string]interface{}{"jobId": id, "s3Key": "uploads/acme/a1.mp4", "style": "bottom", "tenantId": "acme"})
+		messageIDs = append(messageIDs, client.add(testDLQURL, string(body), map[string]string{"requestId": "req-" + id}))
+	}
+
+	ts := newTestServer(t, func(cfg *Config) { cfg.AdminAPIKey = "s3cret" })
+	deps := ts.deps()
+	deps.DeadLetters = &deadLetterQueue{client: client, url: testDLQURL, queue: testSQSQueue(client)}
+	ts.router = NewServer(ts.cfg, deps)
+	return ts, client, messageIDs
+}
+
+// admin sends a JSON request with the test admin key
+func (ts *testServer) admin(method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Key", "s3cret")
+	return ts.serve(req)
+}
+
+// TestDeadLetterFromMessage tests decoding job messages and SQS attributes
+func TestDeadLetterFromMessage(t *testing.T) {
+	letter := deadLetterFromMessage(&sqs.Message{
+		MessageId: aws.String("msg-1"),
+		Body:      aws.String(`{"jobId":"job-1","style":"bottom"}`),
+		Attributes: map[string]*string{
+			sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String("4"),
+			sqs.MessageSystemAttributeNameSentTimestamp:           aws.String("1700000000000"),
+		},
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{"requestId": {StringValue: aws.String("req-1")}},
+	})
+
+	assert.Equal(t, "job-1", letter.JobID)
+	assert.Equal(t, 4, letter.ReceiveCount)
+	assert.Equal(t, time.UnixMilli(1700000000000).UTC(), letter.SentAt)
+	assert.JSONEq(t, `{"jobId":"job-1","style":"bottom"}`, string(letter.Payload))
+	assert.Equal(t, map[string]string{"requestId": "req-1"}, letter.Attributes)
+
+	letter = deadLetterFromMessage(&sqs.Message{MessageId: aws.String("msg-2"), Body: aws.String("not json")})
+	assert.Empty(t, letter.JobID)
+	assert.Equal(t, `"not json"`, string(letter.Payload))
+}
+
+// TestListDeadLetters tests listing dead letters with their jobs without removing them
+func TestListDeadLetters(t *testing.T) {
+	ts, client, messageIDs := deadLetterServer(t, "job-1", "job-2")
+	ts.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "failed", Error: "Render request timed out"})
+
+	w := ts.admin("GET", "/admin/dead-letters", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		DeadLetters []DeadLetter `json:"deadLetters"`
+		Count       int          `json:"count"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.Count)
+	if assert.Len(t, response.DeadLetters, 2) {
+		first := response.DeadLetters[0]
+		assert.Equal(t, messageIDs[0], first.MessageID)
+		assert.Equal(t, "job-1", first.JobID)
+		assert.Equal(t, "failed", first.JobStatus)
+		assert.Equal(t, "Render request timed out", first.JobError)
+		assert.Equal(t, "req-job-1", first.Attributes["requestId"])
+		assert.Contains(t, string(first.Payload), `"s3Key":"uploads/acme/a1.mp4"`)
+		assert.Empty(t, response.DeadLetters[1].JobStatus, "job no longer stored")
+	}
+	assert.Equal(t, 2, client.visible(testDLQURL), "listed messages are released")
+
+	w = ts.admin("GET", "/admin/dead-letters?limit=1", nil)
+	assert.Contains(t, w.Body.String(), `"count":1`)
+	w = ts.admin("GET", "/admin/dead-letters?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestRedriveDeadLetters tests sending selected dead letters back and requeueing their jobs
+func TestRedriveDeadLetters(t *testing.T) {
+	ts, client, messageIDs := deadLetterServer(t, "job-1", "job-2")
+	ts.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "failed", Error: "Render request timed out", RenderID: "render-1"})
+	ts.jobs.Put(&RenderJob{ID: "job-2", TenantID: "acme", Status: "failed"})
+
+	w := ts.admin("POST", "/admin/dead-letters/redrive", map[string]interface{}{"messageIds": []string{messageIDs[0], "msg-missing"}})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, fmt.Sprintf(`{"redriven":[%q],"skipped":[],"notFound":["msg-missing"]}`, messageIDs[0]), w.Body.String())
+	if bodies := client.bodies(testQueueURL); assert.Len(t, bodies, 1) {
+		assert.Contains(t, bodies[0], `"jobId":"job-1"`)
+	}
+	assert.Len(t, client.bodies(testDLQURL), 1)
+	assert.Equal(t, 1, client.visible(testDLQURL), "unselected messages are released")
+
+	job, _ := ts.jobs.Get("job-1")
+	assert.Equal(t, "pending", job.Status)
+	assert.Equal(t, stageQueued, job.Stage)
+	assert.Empty(t, job.Error)
+	assert.Empty(t, job.RenderID)
+	job, _ = ts.jobs.Get("job-2")
+	assert.Equal(t, "failed", job.Status)
+}
+
+// TestRedriveDeadLettersCompletedJob tests that a job that completed since it was
+// dead-lettered keeps its output and its message is not sent again
+func TestRedriveDeadLettersCompletedJob(t *testing.T) {
+	ts, client, messageIDs := deadLetterServer(t, "job-1")
+	ts.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "completed", Progress: 100, OutputURL: "https://bucket/output/job-1.mp4",
+		Attempts: []RenderAttempt{{StartedAt: time.Now()}}})
+
+	w := ts.admin("POST", "/admin/dead-letters/redrive", map[string]interface{}{"messageIds": messageIDs})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, fmt.Sprintf(`{"redriven":[],"skipped":[%q],"notFound":[]}`, messageIDs[0]), w.Body.String())
+	assert.Empty(t, client.bodies(testQueueURL))
+	assert.Equal(t, 1, client.visible(testDLQURL))
+	job, _ := ts.jobs.Get("job-1")
+	assert.Equal(t, "completed", job.Status)
+	assert.Equal(t, "https://bucket/output/job-1.mp4", job.OutputURL)
+	assert.Len(t, job.Attempts, 1)
+}
+
+// TestRedriveDeadLettersSendFailure tests that messages stay dead-lettered when the render queue is unreachable
+func TestRedriveDeadLettersSendFailure(t *testing.T) {
+	ts, client, messageIDs := deadLetterServer(t, "job-1")
+	client.sendErr = errors.New("AccessDenied")
+
+	w := ts.admin("POST", "/admin/dead-letters/redrive", map[string]interface{}{"messageIds": messageIDs})
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), `"redriven":[]`)
+	assert.Equal(t, 1, client.visible(testDLQURL))
+}
+
+// TestDeadLettersNotConfigured tests the admin endpoints without SQS_DLQ_URL
+func TestDeadLettersNotConfigured(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.AdminAPIKey = "s3cret" })
+
+	assert.Equal(t, http.StatusNotFound, ts.admin("GET", "/admin/dead-letters", nil).Code)
+	assert.Equal(t, http.StatusNotFound, ts.admin("POST", "/admin/dead-letters/redrive", map[string]interface{}{"messageIds": []string{"msg-1"}}).Code)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthConfig controls how /readyz probes dependencies
+type HealthConfig struct {
+	Timeout  time.Duration   // per-dependency probe timeout
+	CacheTTL time.Duration   // how long probe results are reused
+	Optional map[string]bool // dependencies reported but not required for readiness
+}
+
+// dependencyNames are the dependencies /readyz can probe when configured
+var dependencyNames = []string{"s3", "dynamodb", "dynamodb-assets", "sqs", "redis", "remotion"}
+
+// loadHealthConfig reads READYZ_TIMEOUT, READYZ_CACHE_TTL and READYZ_OPTIONAL
+func loadHealthConfig(getenv configSource) (HealthConfig, error) {
+	cfg := HealthConfig{Timeout: 2 * time.Second, CacheTTL: 5 * time.Second, Optional: map[string]bool{}}
+
+	if raw := getenv("READYZ_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return cfg, fmt.Errorf("invalid READYZ_TIMEOUT %q", raw)
+		}
+		cfg.Timeout = timeout
+	}
+	if raw := getenv("READYZ_CACHE_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl < 0 {
+			return cfg, fmt.Errorf("invalid READYZ_CACHE_TTL %q", raw)
+		}
+		cfg.CacheTTL = ttl
+	}
+	for _, name := range splitList(getenv("READYZ_OPTIONAL")) {
+		known := false
+		for _, dependency := range dependencyNames {
+			known = known || name == dependency
+		}
+		if !known {
+			return cfg, fmt.Errorf("invalid READYZ_OPTIONAL dependency %q, expected one of %s", name, strings.Join(dependencyNames, ", "))
+		}
+		cfg.Optional[name] = true
+	}
+	return cfg, nil
+}
+
+// optionalList returns the optional dependencies in a stable order
+func (h HealthConfig) optionalList() []string {
+	var names []string
+	for _, name := range dependencyNames {
+		if h.Optional[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// pinger is implemented by stores and queues that can check their backing service
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// dependencyProbe checks one downstream dependency
+type dependencyProbe struct {
+	name     string
+	required bool
+	check    func(ctx context.Context) error
+}
+
+// DependencyStatus is the last probe result for one dependency
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"` // up or down
+	Required  bool   `json:"required"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// readinessChecker probes dependencies concurrently and caches the results
+type readinessChecker struct {
+	probes  []dependencyProbe
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	results   []DependencyStatus
+	checkedAt time.Time
+}
+
+// probes lists the configured dependencies. Stores and queues held in memory have nothing to probe.
+func (s *Server) probes() []dependencyProbe {
+	var probes []dependencyProbe
+	add := func(name string, dependency interface{}) {
+		if p, ok := dependency.(pinger); ok {
+			probes = append(probes, dependencyProbe{name: name, required: !s.cfg.Health.Optional[name], check: p.Ping})
+		}
+	}
+	add("s3", s.Storage)
+	add("dynamodb", s.Jobs)
+	add("dynamodb-assets", s.Assets)
+	add(s.cfg.Queue.Backend, s.Queue)
+	if s.cfg.RemotionURL != "" {
+		probes = append(probes, dependencyProbe{
+			name:     "remotion",
+			required: !s.cfg.Health.Optional["remotion"],
+			check:    func(ctx context.Context) error { return pingRemotion(ctx, s.cfg.RemotionURL) },
+		})
+	}
+	return probes
+}
+
+// pingRemotion checks the Remotion service's own health endpoint
+func pingRemotion(ctx context.Context, remotionURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", remotionURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// check returns the dependency statuses, probing again once the cached ones are older than the TTL.
+// Concurrent callers wait for a single probe round instead of each hitting the dependencies.
+func (r *readinessChecker) check(ctx context.Context) ([]DependencyStatus, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.results != nil && time.Since(r.checkedAt) < r.ttl {
+		return r.results, r.checkedAt
+	}
+
+	results := make([]DependencyStatus, len(r.probes))
+	var wg sync.WaitGroup
+	for i, probe := range r.probes {
+		wg.Add(1)
+		go func(i int, probe dependencyProbe) {
+			defer wg.Done()
+			// A caller hanging up must not cache its cancellation as an outage
+			probeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := probe.check(probeCtx)
+			results[i] = DependencyStatus{
+				Name:      probe.name,
+				Status:    "up",
+				Required:  probe.required,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			dependencyUp.WithLabelValues(probe.name).Set(1)
+			if err != nil {
+				results[i].Status = "down"
+				results[i].Error = redactString(err.Error())
+				dependencyUp.WithLabelValues(probe.name).Set(0)
+				loggerFrom(ctx).Warn("Dependency check failed", "dependency", probe.name, "error", err)
+			}
+		}(i, probe)
+	}
+	wg.Wait()
+
+	r.results, r.checkedAt = results, time.Now()
+	return r.results, r.checkedAt
+}
+
+// livezHandler handles GET /livez. It never probes dependencies, so an outage
+// downstream does not get healthy tasks restarted.
+func (s *Server) livezHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler handles GET /readyz, returning 503 while a required dependency is down
+func (s *Server) readyzHandler(c *gin.Context) {
+	results, checkedAt := s.ready.check(c.Request.Context())
+
+	status, code := "ready", http.StatusOK
+	for _, result := range results {
+		if result.Status == "up" {
+			continue
+		}
+		if result.Required {
+			status, code = "not ready", http.StatusServiceUnavailable
+			break
+		}
+		status = "degraded"
+	}
+	c.JSON(code, gin.H{
+		"status":       status,
+		"dependencies": results,
+		"checkedAt":    checkedAt.UTC(),
+	})
+}
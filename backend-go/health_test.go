@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pingingStorage is fake storage that answers readiness probes with err
+type pingingStorage struct {
+	*fakeStorage
+	err error
+}
+
+func (p *pingingStorage) Ping(ctx context.Context) error {
+	return p.err
+}
+
+// readyzResponse is the body of GET /readyz
+type readyzResponse struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// readyServer builds a router whose S3 probe fails with storageErr and whose Remotion health returns remotionStatus
+func readyServer(t *testing.T, storageErr error, remotionStatus int, optional ...string) http.Handler {
+	remotion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		w.WriteHeader(remotionStatus)
+	}))
+	t.Cleanup(remotion.Close)
+
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.RemotionURL = remotion.URL
+		for _, name := range optional {
+			cfg.Health.Optional[name] = true
+		}
+	})
+	deps := ts.deps()
+	deps.Storage = &pingingStorage{fakeStorage: ts.storage, err: storageErr}
+	return NewServer(ts.cfg, deps)
+}
+
+func getReadyz(t *testing.T, router http.Handler) (int, readyzResponse) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	var response readyzResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w.Code, response
+}
+
+// TestLoadHealthConfig tests readiness defaults and validation
+func TestLoadHealthConfig(t *testing.T) {
+	cfg, err := loadHealthConfig(mapSource(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, cfg.Timeout)
+	assert.Equal(t, 5*time.Second, cfg.CacheTTL)
+	assert.Empty(t, cfg.Optional)
+
+	cfg, err = loadHealthConfig(mapSource(map[string]string{
+		"READYZ_TIMEOUT":   "500ms",
+		"READYZ_CACHE_TTL": "0s",
+		"READYZ_OPTIONAL":  "remotion, sqs",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, cfg.Timeout)
+	assert.Equal(t, time.Duration(0), cfg.CacheTTL)
+	assert.Equal(t, []string{"sqs", "remotion"}, cfg.optionalList())
+
+	_, err = loadHealthConfig(mapSource(map[string]string{"READYZ_OPTIONAL": "kafka"}))
+	assert.EqualError(t, err, `invalid READYZ_OPTIONAL dependency "kafka", expected one of s3, dynamodb, dynamodb-assets, sqs, redis, remotion`)
+	_, err = loadHealthConfig(mapSource(map[string]string{"READYZ_TIMEOUT": "0s"}))
+	assert.EqualError(t, err, `invalid READYZ_TIMEOUT "0s"`)
+}
+
+// TestLivezEndpoint tests that liveness does not depend on downstream services
+func TestLivezEndpoint(t *testing.T) {
+	router := readyServer(t, errors.New("bucket unreachable"), http.StatusInternalServerError)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/livez", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+// TestReadyzEndpoint tests per-dependency status reporting
+func TestReadyzEndpoint(t *testing.T) {
+	code, response := getReadyz(t, readyServer(t, nil, http.StatusOK))
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", response.Status)
+	if assert.Len(t, response.Dependencies, 2) {
+		assert.Equal(t, "s3", response.Dependencies[0].Name)
+		assert.Equal(t, "up", response.Dependencies[0].Status)
+		assert.True(t, response.Dependencies[0].Required)
+		assert.Equal(t, "remotion", response.Dependencies[1].Name)
+		assert.Equal(t, "up", response.Dependencies[1].Status)
+	}
+}
+
+// TestReadyzRequiredDependencyDown tests that a required outage fails readiness
+func TestReadyzRequiredDependencyDown(t *testing.T) {
+	code, response := getReadyz(t, readyServer(t, errors.New("bucket unreachable"), http.StatusOK))
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", response.Status)
+	assert.Equal(t, "down", response.Dependencies[0].Status)
+	assert.Equal(t, "bucket unreachable", response.Dependencies[0].Error)
+}
+
+// TestReadyzOptionalDependencyDown tests that an optional outage only degrades readiness
+func TestReadyzOptionalDependencyDown(t *testing.T) {
+	code, response := getReadyz(t, readyServer(t, nil, http.StatusBadGateway, "remotion"))
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "degraded", response.Status)
+	assert.Equal(t, "down", response.Dependencies[1].Status)
+	assert.False(t, response.Dependencies[1].Required)
+	assert.Equal(t, "health check returned 502", response.Dependencies[1].Error)
+}
+
+// TestReadinessCheckerCachesResults tests that probes run at most once per TTL
+func TestReadinessCheckerCachesResults(t *testing.T) {
+	calls := 0
+	checker := &readinessChecker{
+		probes:  []dependencyProbe{{name: "s3", required: true, check: func(ctx context.Context) error { calls++; return nil }}},
+		timeout: time.Second,
+		ttl:     time.Minute,
+	}
+
+	checker.check(context.Background())
+	results, _ := checker.check(context.Background())
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "up", results[0].Status)
+
+	checker.ttl = 0
+	checker.check(context.Background())
+	assert.Equal(t, 2, calls)
+}
+
+// TestReadinessCheckerTimeout tests that a hanging dependency is reported down after the timeout
+func TestReadinessCheckerTimeout(t *testing.T) {
+	checker := &readinessChecker{
+		probes: []dependencyProbe{{name: "sqs", required: true, check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}},
+		timeout: 20 * time.Millisecond,
+	}
+
+	results, _ := checker.check(context.Background())
+
+	assert.Equal(t, "down", results[0].Status)
+	assert.Equal(t, "context deadline exceeded", results[0].Error)
+	assert.GreaterOrEqual(t, results[0].LatencyMs, int64(20))
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var (
+	errJobNotFound = errors.New("job not found")
+	// errJobStatusChanged is a job whose status changed since it was read
+	errJobStatusChanged = errors.New("job status changed concurrently")
+)
+
+// JobStore persists render jobs
+type JobStore interface {
+	Put(job *RenderJob) error
+	Get(jobID string) (*RenderJob, error)
+	// ListByStatus returns the jobs in any of the statuses, oldest first
+	ListByStatus(statuses ...string) ([]*RenderJob, error)
+	// UpdateProgress raises the progress of a job that is processing renderID, leaving
+	// the job unchanged if it moved on or already got further
+	UpdateProgress(jobID, renderID string, progress int) error
+	// PutIfStatus saves job if the stored job still has status, otherwise it returns
+	// errJobStatusChanged
+	PutIfStatus(job *RenderJob, status string) error
+}
+
+// memoryJobStore keeps jobs in process memory
+type memoryJobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*RenderJob
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{jobs: make(map[string]*RenderJob)}
+}
+
+// copyJob copies job so callers never share its stage times or attempts with the store
+func copyJob(job *RenderJob) *RenderJob {
+	copied := *job
+	if job.StageTimes != nil {
+		copied.StageTimes = make(map[string]time.Time, len(job.StageTimes))
+		for stage, at := range job.StageTimes {
+			copied.StageTimes[stage] = at
+		}
+	}
+	copied.Attempts = append([]RenderAttempt(nil), job.Attempts...)
+	return &copied
+}
+
+func (s *memoryJobStore) Put(job *RenderJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+func (s *memoryJobStore) Get(jobID string) (*RenderJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	return copyJob(job), nil
+}
+
+func (s *memoryJobStore) ListByStatus(statuses ...string) ([]*RenderJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var jobs []*RenderJob
+	for _, job := range s.jobs {
+		for _, status := range statuses {
+			if job.Status == status {
+				jobs = append(jobs, copyJob(job))
+				break
+			}
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+func (s *memoryJobStore) UpdateProgress(jobID, renderID string, progress int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return errJobNotFound
+	}
+	if job.Status == "processing" && job.RenderID == renderID && job.Progress < progress {
+		job.Progress = progress
+		job.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *memoryJobStore) PutIfStatus(job *RenderJob, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.jobs[job.ID]
+	if !ok || stored.Status != status {
+		return errJobStatusChanged
+	}
+	s.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+// dynamoJobStore keeps jobs in the jobs table keyed by "jobId"
+type dynamoJobStore struct {
+	client *dynamodb.DynamoDB
+	table  string
+}
+
+// Ping checks that the jobs table exists and is reachable
+func (s *dynamoJobStore) Ping(ctx context.Context) error {
+	_, err := s.client.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(s.table)})
+	return err
+}
+
+// Put saves job to DynamoDB
+func (s *dynamoJobStore) Put(job *RenderJob) error {
+	_, err := s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      itemFromJob(job),
+	})
+	return err
+}
+
+// itemFromJob converts a RenderJob to a jobs table item. The ETA is computed when read and not stored.
+func itemFromJob(job *RenderJob) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"jobId":     {S: aws.String(job.ID)},
+		"status":    {S: aws.String(job.Status)},
+		"videoUrl":  {S: aws.String(job.VideoURL)},
+		"s3Key":     {S: aws.String(job.S3Key)},
+		"style":     {S: aws.String(job.Style)},
+		"tenantId":  {S: aws.String(job.TenantID)},
+		"progress":  {N: aws.String(strconv.Itoa(job.Progress))},
+		"createdAt": {S: aws.String(job.CreatedAt.Format(time.RFC3339))},
+		"updatedAt": {S: aws.String(job.UpdatedAt.Format(time.RFC3339))},
+	}
+	if job.OutputURL != "" {
+		item["outputUrl"] = &dynamodb.AttributeValue{S: aws.String(job.OutputURL)}
+	}
+	if job.Error != "" {
+		item["error"] = &dynamodb.AttributeValue{S: aws.String(job.Error)}
+	}
+	if job.RenderID != "" {
+		item["renderId"] = &dynamodb.AttributeValue{S: aws.String(job.RenderID)}
+	}
+	if job.RequestID != "" {
+		item["requestId"] = &dynamodb.AttributeValue{S: aws.String(job.RequestID)}
+	}
+	if job.Priority != "" {
+		item["priority"] = &dynamodb.AttributeValue{S: aws.String(job.Priority)}
+	}
+	if job.ScheduledAt != nil {
+		item["scheduledAt"] = &dynamodb.AttributeValue{S: aws.String(job.ScheduledAt.Format(time.RFC3339))}
+	}
+
+	if job.Stage != "" {
+		item["stage"] = &dynamodb.AttributeValue{S: aws.String(job.Stage)}
+	}
+	if len(job.StageTimes) > 0 {
+		stageTimes := map[string]*dynamodb.AttributeValue{}
+		for stage, at := range job.StageTimes {
+			stageTimes[stage] = &dynamodb.AttributeValue{S: aws.String(at.Format(time.RFC3339Nano))}
+		}
+		item["stageTimes"] = &dynamodb.AttributeValue{M: stageTimes}
+	}
+	if job.VideoDuration > 0 {
+		item["videoDuration"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatFloat(job.VideoDuration, 'f', -1, 64))}
+	}
+
+	if len(job.Attempts) > 0 {
+		attemptsJSON, _ := json.Marshal(job.Attempts)
+		item["attempts"] = &dynamodb.AttributeValue{S: aws.String(string(attemptsJSON))}
+	}
+
+	// Add captions as JSON
+	captionsJSON, _ := json.Marshal(job.Captions)
+	item["captions"] = &dynamodb.AttributeValue{S: aws.String(string(captionsJSON))}
+	return item
+}
+
+// Get retrieves job from DynamoDB
+func (s *dynamoJobStore) Get(jobID string) (*RenderJob, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"jobId": {S: aws.String(jobID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Items without a status share the table but are not render jobs
+	if result.Item == nil || result.Item["status"] == nil {
+		return nil, errJobNotFound
+	}
+
+	return jobFromItem(result.Item), nil
+}
+
+// ListByStatus scans the table for jobs in any of the statuses
+func (s *dynamoJobStore) ListByStatus(statuses ...string) ([]*RenderJob, error) {
+	values := map[string]*dynamodb.AttributeValue{}
+	var placeholders []string
+	for i, status := range statuses {
+		placeholder := fmt.Sprintf(":status%d", i)
+		placeholders = append(placeholders, placeholder)
+		values[placeholder] = &dynamodb.AttributeValue{S: aws.String(status)}
+	}
+
+	var jobs []*RenderJob
+	err := s.client.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String(s.table),
+		FilterExpression: aws.String("#status IN (" + strings.Join(placeholders, ", ") + ")"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			jobs = append(jobs, jobFromItem(item))
+		}
+		return true
+	})
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, err
+}
+
+// UpdateProgress sets progress only while the stored job is still processing renderID
+// with less progress, so it never overwrites what the worker saved
+func (s *dynamoJobStore) UpdateProgress(jobID, renderID string, progress int) error {
+	_, err := s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"jobId": {S: aws.String(jobID)},
+		},
+		UpdateExpression:    aws.String("SET progress = :progress, updatedAt = :updatedAt"),
+		ConditionExpression: aws.String("#status = :processing AND renderId = :renderId AND progress < :progress"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":progress":   {N: aws.String(strconv.Itoa(progress))},
+			":updatedAt":  {S: aws.String(time.Now().Format(time.RFC3339))},
+			":processing": {S: aws.String("processing")},
+			":renderId":   {S: aws.String(renderID)},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
+
+// PutIfStatus saves job on condition that the stored item still has status
+func (s *dynamoJobStore) PutIfStatus(job *RenderJob, status string) error {
+	_, err := s.client.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(s.table),
+		Item:                itemFromJob(job),
+		ConditionExpression: aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status": {S: aws.String(status)},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errJobStatusChanged
+	}
+	return err
+}
+
+// jobFromItem converts a jobs table item to a RenderJob
+func jobFromItem(item map[string]*dynamodb.AttributeValue) *RenderJob {
+	job := &RenderJob{
+		ID:     *item["jobId"].S,
+		Status: *item["status"].S,
+	}
+	if item["videoUrl"] != nil {
+		job.VideoURL = *item["videoUrl"].S
+	}
+	if item["s3Key"] != nil {
+		job.S3Key = *item["s3Key"].S
+	}
+	if item["style"] != nil {
+		job.Style = *item["style"].S
+	}
+	if item["tenantId"] != nil {
+		job.TenantID = *item["tenantId"].S
+	}
+	if item["outputUrl"] != nil {
+		job.OutputURL = *item["outputUrl"].S
+	}
+	if item["error"] != nil {
+		job.Error = *item["error"].S
+	}
+	if item["renderId"] != nil {
+		job.RenderID = *item["renderId"].S
+	}
+	if item["progress"] != nil {
+		job.Progress, _ = strconv.Atoi(*item["progress"].N)
+	}
+	if item["stage"] != nil {
+		job.Stage = *item["stage"].S
+	}
+	if item["stageTimes"] != nil {
+		job.StageTimes = map[string]time.Time{}
+		for stage, at := range item["stageTimes"].M {
+			job.StageTimes[stage], _ = time.Parse(time.RFC3339Nano, aws.StringValue(at.S))
+		}
+	}
+	if item["videoDuration"] != nil {
+		job.VideoDuration, _ = strconv.ParseFloat(*item["videoDuration"].N, 64)
+	}
+	if item["requestId"] != nil {
+		job.RequestID = *item["requestId"].S
+	}
+	if item["priority"] != nil {
+		job.Priority = *item["priority"].S
+	}
+	if item["scheduledAt"] != nil {
+		if scheduledAt, err := time.Parse(time.RFC3339, *item["scheduledAt"].S); err == nil {
+			job.ScheduledAt = &scheduledAt
+		}
+	}
+	if item["attempts"] != nil {
+		json.Unmarshal([]byte(*item["attempts"].S), &job.Attempts)
+	}
+	if item["captions"] != nil {
+		json.Unmarshal([]byte(*item["captions"].S), &job.Captions)
+	}
+	if item["createdAt"] != nil {
+		job.CreatedAt, _ = time.Parse(time.RFC3339, *item["createdAt"].S)
+	}
+	if item["updatedAt"] != nil {
+		job.UpdatedAt, _ = time.Parse(time.RFC3339, *item["updatedAt"].S)
+	}
+
+	return job
+}
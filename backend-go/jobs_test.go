@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMemoryJobStore tests that stored jobs are copied in and out
+func TestMemoryJobStore(t *testing.T) {
+	store := newMemoryJobStore()
+
+	_, err := store.Get("missing")
+	assert.ErrorIs(t, err, errJobNotFound)
+
+	job := &RenderJob{ID: "job-1", Status: "pending"}
+	assert.NoError(t, store.Put(job))
+	job.Status = "changed"
+
+	stored, err := store.Get("job-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", stored.Status, "callers cannot mutate stored jobs")
+
+	stored.Status = "completed"
+	stored.enterStage(stageRendering, time.Now())
+	again, _ := store.Get("job-1")
+	assert.Equal(t, "pending", again.Status)
+	assert.Empty(t, again.StageTimes, "stage times are copied too")
+}
+
+// TestMemoryJobStoreUpdateProgress tests that progress only rises on a job still processing the render
+func TestMemoryJobStoreUpdateProgress(t *testing.T) {
+	store := newMemoryJobStore()
+	store.Put(&RenderJob{ID: "job-1", Status: "processing", RenderID: "render-1", Progress: 40})
+
+	assert.NoError(t, store.UpdateProgress("job-1", "render-1", 60))
+	assert.NoError(t, store.UpdateProgress("job-1", "render-1", 50))
+	assert.NoError(t, store.UpdateProgress("job-1", "render-0", 80))
+	job, _ := store.Get("job-1")
+	assert.Equal(t, 60, job.Progress)
+
+	job.Status, job.Progress, job.OutputURL = "completed", 100, "https://bucket/renders/job-1.mp4"
+	store.Put(job)
+	assert.NoError(t, store.UpdateProgress("job-1", "render-1", 90))
+	job, _ = store.Get("job-1")
+	assert.Equal(t, "completed", job.Status)
+	assert.Equal(t, 100, job.Progress)
+
+	assert.ErrorIs(t, store.UpdateProgress("missing", "render-1", 10), errJobNotFound)
+}
+
+// TestMemoryJobStorePutIfStatus tests that a job is only replaced while it keeps the expected status
+func TestMemoryJobStorePutIfStatus(t *testing.T) {
+	store := newMemoryJobStore()
+	store.Put(&RenderJob{ID: "job-1", Status: "failed"})
+
+	assert.NoError(t, store.PutIfStatus(&RenderJob{ID: "job-1", Status: "pending"}, "failed"))
+	assert.ErrorIs(t, store.PutIfStatus(&RenderJob{ID: "job-1", Status: "pending"}, "failed"), errJobStatusChanged)
+	assert.ErrorIs(t, store.PutIfStatus(&RenderJob{ID: "missing", Status: "pending"}, "failed"), errJobStatusChanged)
+	job, _ := store.Get("job-1")
+	assert.Equal(t, "pending", job.Status)
+}
+
+// TestJobItemRoundTrip tests that every stored field survives a DynamoDB item
+func TestJobItemRoundTrip(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	job := &RenderJob{
+		ID:            "job-1",
+		TenantID:      "acme",
+		Status:        "processing",
+		S3Key:         "uploads/acme/a1.mp4",
+		Captions:      []Caption{{Start: 0, End: 1.5, Text: "Hello"}},
+		Style:         "karaoke",
+		RenderID:      "render-1",
+		Progress:      45,
+		VideoDuration: 12.5,
+		RequestID:     "req-1",
+		Priority:      "high",
+		ScheduledAt:   &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Attempts:      []RenderAttempt{{StartedAt: now.Add(-time.Minute), EndedAt: &now, Error: "remotion unavailable: busy"}, {StartedAt: now}},
+	}
+	job.enterStage(stageQueued, now.Add(-time.Minute))
+	job.enterStage(stageRendering, now.Add(250*time.Millisecond))
+
+	assert.Equal(t, job, jobFromItem(itemFromJob(job)))
+}
+
+// TestMemoryJobStoreListByStatus tests listing jobs by status, oldest first
+func TestMemoryJobStoreListByStatus(t *testing.T) {
+	store := newMemoryJobStore()
+	now := time.Now()
+	store.Put(&RenderJob{ID: "new", Status: "pending", CreatedAt: now})
+	store.Put(&RenderJob{ID: "old", Status: "processing", CreatedAt: now.Add(-time.Hour)})
+	store.Put(&RenderJob{ID: "done", Status: "completed", CreatedAt: now})
+
+	jobs, err := store.ListByStatus("pending", "processing")
+
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "old", jobs[0].ID)
+	assert.Equal(t, "new", jobs[1].ID)
+}
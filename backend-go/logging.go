@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader carries the request ID in and out of the API and to downstream services
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// validRequestID limits caller-supplied IDs to something safe to log and forward
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// withRequestID returns ctx carrying the request ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom returns the request ID carried by ctx, if any
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// loggerFrom returns the default logger tagged with the request ID carried by ctx
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if id := requestIDFrom(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// requestID reuses a well-formed X-Request-ID from the caller or generates one,
+// echoes it in the response and puts it in the request context
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.New().String()
+		}
+		c.Header(requestIDHeader, id)
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request.id", id))
+		c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// accessLog logs one line per request with its route, status and latency
+func accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		loggerFrom(c.Request.Context()).Log(c.Request.Context(), level, "request",
+			"method", c.Request.Method,
+			"route", route,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"bytes", c.Writer.Size(),
+			"tenant", c.GetString(tenantContextKey),
+			"ip", c.ClientIP(),
+		)
+	}
+}
+
+// newLogger writes JSON logs at the given level with secrets and URL signatures redacted
+func newLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}))
+}
+
+// parseLogLevel parses LOG_LEVEL (debug, info, warn or error)
+func parseLogLevel(raw string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(raw)); err != nil {
+		return level, fmt.Errorf("invalid LOG_LEVEL %q, expected debug, info, warn or error", raw)
+	}
+	return level, nil
+}
+
+// fatal logs an error and exits, replacing log.Fatalf
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// secretAttr matches attribute names whose values are never logged
+var secretAttr = regexp.MustCompile(`(?i)(secret|password|token|api_?key|authorization|credential)`)
+
+// signedQueryParams are query parameters that grant access on their own
+var signedQueryParams = []string{
+	"x-amz-signature", "x-amz-credential", "x-amz-security-token",
+	"signature", "sig", "token", "access_token", "api_key", "apikey", "key",
+}
+
+var (
+	urlPattern    = regexp.MustCompile(`https?://[^\s"'<>]+`)
+	apiKeyPattern = regexp.MustCompile(apiKeyPrefix + `[A-Za-z0-9_-]+`)
+)
+
+// redactAttr hides secret-named attributes and signed URLs in every logged string,
+// including errors that embed a request URL
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey || a.Key == slog.LevelKey {
+		return a
+	}
+	if secretAttr.MatchString(a.Key) {
+		return slog.String(a.Key, "<redacted>")
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+	return a
+}
+
+// redactString masks API keys and the signed query parameters of any URL in s
+func redactString(s string) string {
+	s = apiKeyPattern.ReplaceAllString(s, apiKeyPrefix+"<redacted>")
+	return urlPattern.ReplaceAllStringFunc(s, redactURL)
+}
+
+// redactURL keeps the URL's location but replaces signed query values
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.RawQuery == "" {
+		return raw
+	}
+	query := u.Query()
+	redacted := false
+	for name := range query {
+		for _, signed := range signedQueryParams {
+			if strings.EqualFold(name, signed) {
+				query.Set(name, "REDACTED")
+				redacted = true
+			}
+		}
+	}
+	if !redacted {
+		return raw
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
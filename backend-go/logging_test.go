@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogs sends the default logger to a buffer for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(newLogger(&buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// TestRedactString tests masking of signed URLs and API keys
+func TestRedactString(t *testing.T) {
+	signed := "https://bucket.s3.amazonaws.com/uploads/a.mp4?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKIA%2F20240101&X-Amz-Signature=abc123"
+	redacted := redactString("fetching " + signed + " failed")
+
+	assert.NotContains(t, redacted, "abc123")
+	assert.NotContains(t, redacted, "AKIA")
+	assert.Contains(t, redacted, "https://bucket.s3.amazonaws.com/uploads/a.mp4?")
+	assert.Contains(t, redacted, "X-Amz-Algorithm=AWS4-HMAC-SHA256")
+
+	assert.Equal(t, "https://example.com/a?page=2", redactString("https://example.com/a?page=2"))
+	assert.Equal(t, "key cpk_<redacted> rejected", redactString("key "+apiKeyPrefix+"abcDEF123 rejected"))
+}
+
+// TestLoggerRedactsAttributes tests redaction of secret attributes and errors
+func TestLoggerRedactsAttributes(t *testing.T) {
+	logs := captureLogs(t)
+
+	slog.Info("calling service",
+		"api_key", "secret-value",
+		"url", "https://s3.example.com/a.mp4?X-Amz-Signature=abc123",
+		"error", errors.New(`Get "https://s3.example.com/a.mp4?X-Amz-Signature=abc123": timeout`),
+	)
+
+	assert.NotContains(t, logs.String(), "secret-value")
+	assert.NotContains(t, logs.String(), "abc123")
+	assert.Contains(t, logs.String(), `"api_key":"<redacted>"`)
+}
+
+// TestRequestIDMiddleware tests that request IDs are reused when valid and generated otherwise
+func TestRequestIDMiddleware(t *testing.T) {
+	ts := newTestServer(t)
+	logs := captureLogs(t)
+
+	req, _ := http.NewRequest("GET", "/livez", nil)
+	req.Header.Set(requestIDHeader, "trace-42")
+	w := ts.serve(req)
+	assert.Equal(t, "trace-42", w.Header().Get(requestIDHeader))
+	assert.Contains(t, logs.String(), `"request_id":"trace-42"`)
+
+	req, _ = http.NewRequest("GET", "/livez", nil)
+	req.Header.Set(requestIDHeader, "bad id\nwith newline")
+	w = ts.serve(req)
+	generated := w.Header().Get(requestIDHeader)
+	assert.Len(t, generated, 36, "invalid IDs are replaced with a UUID")
+	assert.Contains(t, logs.String(), `"request_id":"`+generated+`"`)
+}
+
+// TestTranscribeLogsRedactPresignedURL tests that the transcription URL is logged without its signature
+func TestTranscribeLogsRedactPresignedURL(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+	var uploaded struct {
+		S3Key string `json:"s3Key"`
+	}
+	w := ts.upload(key, "video", "talk.mp4", testVideo())
+	json.Unmarshal(w.Body.Bytes(), &uploaded)
+	logs := captureLogs(t)
+
+	req, _ := http.NewRequest("POST", "/transcribe", bytes.NewBufferString(`{"s3Key": "`+uploaded.S3Key+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	req.Header.Set(requestIDHeader, "req-transcribe")
+	w = ts.serve(req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, logs.String(), "Generated presigned URL for transcription")
+	assert.Contains(t, logs.String(), `"request_id":"req-transcribe"`)
+	assert.NotContains(t, logs.String(), "test-signature")
+	assert.NotContains(t, logs.String(), key)
+}
@@ -1,16 +1,18 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -19,8 +21,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"github.com/joho/godotenv"
 )
 
 // Caption represents a single caption with timing
@@ -32,27 +32,29 @@ type Caption struct {
 
 // RenderJob represents a video rendering job
 type RenderJob struct {
-	ID        string    `json:"id"`
-	Status    string    `json:"status"` // pending, processing, completed, failed
-	VideoURL  string    `json:"videoUrl"`
-	S3Key     string    `json:"s3Key"`
-	Captions  []Caption `json:"captions"`
-	Style     string    `json:"style"`
-	OutputURL string    `json:"outputUrl"`
-	Error     string    `json:"error,omitempty"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID            string               `json:"id"`
+	TenantID      string               `json:"tenantId"`
+	Status        string               `json:"status"` // pending, processing, completed, failed, expired, requeueable
+	VideoURL      string               `json:"videoUrl"`
+	S3Key         string               `json:"s3Key"`
+	Captions      []Caption            `json:"captions"`
+	Style         string               `json:"style"`
+	Priority      string               `json:"priority,omitempty"`    // high, normal or low
+	ScheduledAt   *time.Time           `json:"scheduledAt,omitempty"` // not rendered before
+	OutputURL     string               `json:"outputUrl"`
+	Error         string               `json:"error,omitempty"`
+	RenderID      string               `json:"renderId,omitempty"`      // Remotion's ID for the submitted render
+	Progress      int                  `json:"progress"`                // 0-100
+	Stage         string               `json:"stage,omitempty"`         // queued, fetching-video, rendering, uploading, finalizing
+	StageTimes    map[string]time.Time `json:"stageTimes,omitempty"`    // when each stage started
+	VideoDuration float64              `json:"videoDuration,omitempty"` // seconds, for the ETA
+	Attempts      []RenderAttempt      `json:"attempts,omitempty"`      // each run of the job, oldest first
+	ETA           *time.Time           `json:"eta,omitempty"`           // expected completion, computed when read
+	RequestID     string               `json:"requestId,omitempty"`     // request that created the job, for log correlation
+	CreatedAt     time.Time            `json:"createdAt"`
+	UpdatedAt     time.Time            `json:"updatedAt"`
 }
 
-var (
-	renderJobs    = make(map[string]*RenderJob)
-	sqsQueueURL   string
-	dynamoDBTable string
-	awsSession    *session.Session
-	sqsClient     *sqs.SQS
-	dynamoClient  *dynamodb.DynamoDB
-)
-
 // AssemblyAI response structures
 type AssemblyAIUploadResponse struct {
 	UploadURL string `json:"upload_url"`
@@ -66,642 +68,237 @@ type AssemblyAITranscriptResponse struct {
 	ID     string `json:"id"`
 	Status string `json:"status"`
 	Words  []struct {
-		Text  string  `json:"text"`
-		Start int     `json:"start"`
-		End   int     `json:"end"`
+		Text  string `json:"text"`
+		Start int    `json:"start"`
+		End   int    `json:"end"`
 	} `json:"words"`
 }
 
-// uploadToS3FromReader uploads data from an io.Reader to S3 bucket
-func uploadToS3FromReader(reader io.Reader, bucketName, key, contentType string) (string, error) {
-	awsRegion := os.Getenv("AWS_REGION")
-	if awsRegion == "" {
-		awsRegion = "us-east-1"
-	}
-	
-	// Create AWS session using IAM role (no credentials needed)
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(awsRegion),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create AWS session: %v", err)
-	}
-	
-	// Create S3 service client
-	svc := s3.New(sess)
-	
-	// Read all data into memory for upload
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return "", fmt.Errorf("failed to read data: %v", err)
-	}
-	
-	// Upload to S3
-	_, err = svc.PutObject(&s3.PutObjectInput{
-		Bucket:      aws.String(bucketName),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(data),
-		ContentType: aws.String(contentType),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload to S3: %v", err)
-	}
-	
-	// Generate public URL
-	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, awsRegion, key)
-	return url, nil
-}
-
-// getPresignedURL generates a presigned URL for S3 object access
-func getPresignedURL(bucketName, key string, expiration time.Duration) (string, error) {
-	awsRegion := os.Getenv("AWS_REGION")
-	if awsRegion == "" {
-		awsRegion = "us-east-1"
-	}
-	
-	// Create AWS session using IAM role (no credentials needed)
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(awsRegion),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create AWS session: %v", err)
-	}
-	
-	// Create S3 service client
-	svc := s3.New(sess)
-	
-	// Create presigned URL request
-	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(key),
-	})
-	
-	// Generate presigned URL
-	urlStr, err := req.Presign(expiration)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL: %v", err)
-	}
-	
-	return urlStr, nil
+// renderOutputKey is the S3 key of a job's rendered video
+func renderOutputKey(job *RenderJob) string {
+	return fmt.Sprintf("output/%s/video_%s.mp4", job.TenantID, job.ID)
 }
 
-// uploadToS3 uploads a file to S3 bucket (kept for backward compatibility)
-func uploadToS3(filePath, bucketName, key string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
-	}
-	defer file.Close()
-	
-	contentType := "video/mp4"
-	if strings.HasSuffix(key, ".srt") {
-		contentType = "text/plain"
-	}
-	
-	return uploadToS3FromReader(file, bucketName, key, contentType)
-}
+func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	showConfig := flag.Bool("print-config", false, "print the resolved configuration with secrets redacted and exit")
+	flag.Parse()
 
-// saveToDynamoDB saves job to DynamoDB
-func saveToDynamoDB(job *RenderJob) error {
-	item := map[string]*dynamodb.AttributeValue{
-		"jobId":     {S: aws.String(job.ID)},
-		"status":    {S: aws.String(job.Status)},
-		"videoUrl":  {S: aws.String(job.VideoURL)},
-		"s3Key":     {S: aws.String(job.S3Key)},
-		"style":     {S: aws.String(job.Style)},
-		"createdAt": {S: aws.String(job.CreatedAt.Format(time.RFC3339))},
-		"updatedAt": {S: aws.String(job.UpdatedAt.Format(time.RFC3339))},
+	// JSON logs on stderr, the level is applied once the configuration is loaded
+	logLevel := new(slog.LevelVar)
+	slog.SetDefault(newLogger(os.Stderr, logLevel))
+	if os.Getenv(gin.EnvGinMode) == "" {
+		// gin's debug route dump is plain text, keep stderr pure JSON
+		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Add captions as JSON
-	captionsJSON, _ := json.Marshal(job.Captions)
-	item["captions"] = &dynamodb.AttributeValue{S: aws.String(string(captionsJSON))}
-
-	_, err := dynamoClient.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String(dynamoDBTable),
-		Item:      item,
-	})
-	return err
-}
-
-// sendToSQS sends job to SQS queue
-func sendToSQS(job *RenderJob) error {
-	messageBody, _ := json.Marshal(map[string]interface{}{
-		"jobId":    job.ID,
-		"videoUrl": job.VideoURL,
-		"s3Key":    job.S3Key,
-		"captions": job.Captions,
-		"style":    job.Style,
-	})
-
-	_, err := sqsClient.SendMessage(&sqs.SendMessageInput{
-		QueueUrl:    aws.String(sqsQueueURL),
-		MessageBody: aws.String(string(messageBody)),
-	})
-	return err
-}
-
-// getFromDynamoDB retrieves job from DynamoDB
-func getFromDynamoDB(jobID string) (*RenderJob, error) {
-	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String(dynamoDBTable),
-		Key: map[string]*dynamodb.AttributeValue{
-			"jobId": {S: aws.String(jobID)},
-		},
-	})
+	// Settings come from the environment, then .env files (optional in Docker), then the YAML file
+	source, err := newConfigSource(*configPath)
 	if err != nil {
-		return nil, err
-	}
-	if result.Item == nil {
-		return nil, fmt.Errorf("job not found")
-	}
-
-	job := &RenderJob{
-		ID:     *result.Item["jobId"].S,
-		Status: *result.Item["status"].S,
-	}
-	if result.Item["videoUrl"] != nil {
-		job.VideoURL = *result.Item["videoUrl"].S
-	}
-	if result.Item["s3Key"] != nil {
-		job.S3Key = *result.Item["s3Key"].S
-	}
-	if result.Item["style"] != nil {
-		job.Style = *result.Item["style"].S
-	}
-	if result.Item["outputUrl"] != nil {
-		job.OutputURL = *result.Item["outputUrl"].S
-	}
-	if result.Item["error"] != nil {
-		job.Error = *result.Item["error"].S
-	}
-	if result.Item["captions"] != nil {
-		json.Unmarshal([]byte(*result.Item["captions"].S), &job.Captions)
-	}
-	if result.Item["createdAt"] != nil {
-		job.CreatedAt, _ = time.Parse(time.RFC3339, *result.Item["createdAt"].S)
+		fatal("Failed to load configuration", "error", err)
 	}
-	if result.Item["updatedAt"] != nil {
-		job.UpdatedAt, _ = time.Parse(time.RFC3339, *result.Item["updatedAt"].S)
-	}
-
-	return job, nil
-}
-
-// processRenderJob processes a render job asynchronously using ECS Fargate
-func processRenderJob(jobID string) {
-	job, exists := renderJobs[jobID]
-	if !exists {
-		return
-	}
-
-	job.Status = "processing"
-	job.UpdatedAt = time.Now()
-
-	bucketName := os.Getenv("S3_BUCKET")
-	
-	// Generate presigned URL for video access
-	var videoURLForRender string
-	if job.S3Key != "" {
-		presignedURL, err := getPresignedURL(bucketName, job.S3Key, 2*time.Hour)
+	cfg, err := loadConfig(source)
+	if *showConfig {
+		printConfig(os.Stdout, cfg)
 		if err != nil {
-			job.Status = "failed"
-			job.Error = fmt.Sprintf("Failed to generate presigned URL: %v", err)
-			job.UpdatedAt = time.Now()
-			return
+			fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+			os.Exit(1)
 		}
-		videoURLForRender = presignedURL
-	} else {
-		videoURLForRender = job.VideoURL
+		return
 	}
-
-	// Trigger ECS Fargate task for rendering
-	err := triggerFargateRenderTask(jobID, videoURLForRender, job.Captions, job.Style, bucketName)
 	if err != nil {
-		job.Status = "failed"
-		job.Error = fmt.Sprintf("Failed to trigger render task: %v", err)
-		job.UpdatedAt = time.Now()
-		log.Printf("Job %s failed: %v", jobID, err)
-	}
-}
-
-// triggerFargateRenderTask triggers rendering via Remotion service
-func triggerFargateRenderTask(jobID, videoURL string, captions []Caption, style, bucketName string) error {
-	remotionURL := os.Getenv("RENDER_REMOTION_URL")
-	if remotionURL == "" {
-		remotionURL = "http://localhost:3000"
+		fatal("Invalid configuration", "error", err)
 	}
+	logLevel.Set(cfg.LogLevel)
 
-	renderReq := map[string]interface{}{
-		"videoUrl": videoURL,
-		"captions": captions,
-		"style":    style,
-		"outPath":  fmt.Sprintf("out/video_%s.mp4", jobID),
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Failed to initialize tracing", "error", err)
 	}
 
-	jsonData, _ := json.Marshal(renderReq)
-	
-	httpReq, err := http.NewRequest("POST", remotionURL+"/render", bytes.NewBuffer(jsonData))
+	deps, err := newDeps(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create render request: %v", err)
+		fatal("Failed to initialize dependencies", "error", err)
 	}
-	
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", os.Getenv("RENDER_API_KEY"))
-	
-	client := &http.Client{Timeout: 10 * time.Minute}
-	resp, err := client.Do(httpReq)
-	
-	if err != nil {
-		return fmt.Errorf("remotion service unavailable: %v", err)
+
+	// `main worker` renders jobs from SQS or Redis instead of serving the API
+	if flag.Arg(0) == "worker" {
+		runWorker(cfg, deps)
+	} else {
+		runServer(cfg, deps)
 	}
-	defer resp.Body.Close()
 
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-	
-	job := renderJobs[jobID]
-	
-	if success, ok := result["success"].(bool); ok && success {
-		if outPath, ok := result["outPath"].(string); ok {
-			filename := filepath.Base(outPath)
-			downloadURL := remotionURL + "/download/" + filename
-			
-			resp, err := http.Get(downloadURL)
-			if err != nil {
-				job.Status = "failed"
-				job.Error = fmt.Sprintf("Failed to download rendered video: %v", err)
-				job.UpdatedAt = time.Now()
-				return err
-			}
-			defer resp.Body.Close()
-			
-			if resp.StatusCode == http.StatusOK {
-				s3Key := fmt.Sprintf("output/%s", filename)
-				s3URL, err := uploadToS3FromReader(resp.Body, bucketName, s3Key, "video/mp4")
-				if err != nil {
-					job.Status = "failed"
-					job.Error = fmt.Sprintf("Failed to upload to S3: %v", err)
-					job.UpdatedAt = time.Now()
-					return err
-				}
-				
-				log.Printf("Video uploaded to S3: %s", s3URL)
-				
-				presignedDownloadURL, err := getPresignedURL(bucketName, s3Key, 24*time.Hour)
-				if err != nil {
-					presignedDownloadURL = s3URL
-				}
-				
-				job.Status = "completed"
-				job.OutputURL = presignedDownloadURL
-				job.UpdatedAt = time.Now()
-				
-				log.Printf("Job %s completed successfully", jobID)
-				return nil
-			}
-		}
+	// Export spans buffered during the drain
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
 	}
-	
-	job.Status = "failed"
-	job.Error = "Render failed"
-	job.UpdatedAt = time.Now()
-	return fmt.Errorf("render failed")
+	slog.Info("Server stopped")
 }
 
-func main() {
-	// Load environment variables (optional in Docker, uses env vars directly)
-	godotenv.Load("../.env")
-	godotenv.Load(".env")
-	
-	apiKey := os.Getenv("ASSEMBLYAI_KEY")
-	if apiKey == "" {
-		log.Fatal("ASSEMBLYAI_KEY environment variable is required")
+// runServer serves the API until SIGINT or SIGTERM, then drains
+func runServer(cfg *Config, deps Deps) {
+	if cfg.Auth.Disabled {
+		slog.Warn("AUTH_DISABLED is set, all requests run as the anonymous tenant")
 	}
 
-	// Initialize AWS clients
-	sqsQueueURL = os.Getenv("SQS_QUEUE_URL")
-	dynamoDBTable = os.Getenv("DYNAMODB_TABLE")
-	
-	if sqsQueueURL != "" && dynamoDBTable != "" {
-		awsRegion := os.Getenv("AWS_REGION")
-		if awsRegion == "" {
-			awsRegion = "us-east-1"
-		}
-		
-		var err error
-		// Use IAM role credentials (no static credentials needed)
-		awsSession, err = session.NewSession(&aws.Config{
-			Region: aws.String(awsRegion),
-		})
-		if err != nil {
-			log.Printf("Warning: Failed to create AWS session: %v", err)
-		} else {
-			sqsClient = sqs.New(awsSession)
-			dynamoClient = dynamodb.New(awsSession)
-			log.Printf("AWS clients initialized - SQS: %s, DynamoDB: %s", sqsQueueURL, dynamoDBTable)
-		}
+	// Delete expired uploads, captions and outputs in the background
+	startRetentionSweeper(deps, cfg.Retention)
+
+	// Pick up jobs a previous process left pending or processing
+	reconcile := cfg.Reconcile
+	reconcile.Durable = cfg.Queue.Backend != "memory"
+	startJobReconciler(deps, reconcile)
+
+	// Jobs in the memory queue can only be rendered by this process
+	var worker *queueWorker
+	if cfg.Queue.Backend == "memory" {
+		worker = newQueueWorker(deps.Queue, cfg.Worker, deps.Jobs, newRenderWorker(cfg, deps).processRenderJob)
+		worker.Start()
 	}
 
 	// Create necessary directories (minimal, only for static assets)
 	os.MkdirAll("static", 0755)
 
-	r := gin.Default()
-	
-	// CORS middleware - must be before routes
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: NewServer(cfg, deps)}
+	go func() {
+		slog.Info("Server starting", "port", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server failed", "error", err)
 		}
-		
-		c.Next()
-	})
-	
-	// Handle OPTIONS for all routes
-	r.OPTIONS("/*path", func(c *gin.Context) {
-		c.Status(http.StatusNoContent)
-	})
-	
-	// Serve static files
-	r.Static("/static", "./static")
+	}()
 
-	// Load HTML templates
-	r.LoadHTMLGlob("templates/*")
+	sig := waitForStop()
+	slog.Info("Draining before shutdown", "signal", sig.String(), "timeout", cfg.ShutdownTimeout.String())
 
-	// GET / - Upload page
-	r.GET("/", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "upload.html", nil)
-	})
+	shutdown(srv, deps.Queue, worker, cfg.ShutdownTimeout)
+}
 
-	// GET /health - Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "ok",
-			"service": "captioning-backend",
-		})
-	})
+// runWorker renders jobs from the SQS or Redis queue until SIGINT or SIGTERM, then
+// lets running renders finish within the shutdown timeout
+func runWorker(cfg *Config, deps Deps) {
+	if cfg.Queue.Backend == "memory" {
+		fatal("Worker mode requires QUEUE_BACKEND sqs or redis")
+	}
+	worker := newQueueWorker(deps.Queue, cfg.Worker, deps.Jobs, newRenderWorker(cfg, deps).processRenderJob)
+	worker.Start()
+	slog.Info("Worker polling for render jobs", "backend", cfg.Queue.Backend, "concurrency", cfg.Worker.Concurrency)
 
-	// GET /download/:filename - Proxy download from Remotion service
-	r.GET("/download/:filename", func(c *gin.Context) {
-		filename := c.Param("filename")
-		remotionURL := os.Getenv("RENDER_REMOTION_URL")
-		if remotionURL == "" {
-			remotionURL = "http://localhost:3000"
-		}
-		
-		// Proxy the download request to Remotion service
-		resp, err := http.Get(remotionURL + "/download/" + filename)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Download failed"})
-			return
-		}
-		defer resp.Body.Close()
-		
-		if resp.StatusCode != http.StatusOK {
-			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-			return
-		}
-		
-		// Set headers for file download
-		c.Header("Content-Type", "video/mp4")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-		
-		// Stream the file
-		io.Copy(c.Writer, resp.Body)
-	})
+	sig := waitForStop()
+	slog.Info("Draining before shutdown", "signal", sig.String(), "timeout", cfg.ShutdownTimeout.String())
 
-	// POST /upload - Handle video upload and store in S3
-	r.POST("/upload", func(c *gin.Context) {
-		// Enforce max upload size (200MB)
-		const maxUploadSize = 200 * 1024 * 1024 // 200MB
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
-		
-		if err := c.Request.ParseMultipartForm(maxUploadSize); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "File too large (max 200MB)"})
-			return
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := worker.Close(ctx); err != nil {
+		slog.Warn("Render worker shutdown incomplete", "error", err)
+	}
+	if err := deps.Queue.Close(ctx); err != nil {
+		slog.Warn("Failed to close render queue", "error", err)
+	}
+}
 
-		file, header, err := c.Request.FormFile("video")
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
-			return
-		}
-		defer file.Close()
+// waitForStop blocks until SIGINT or SIGTERM. ECS sends SIGTERM on deploys and
+// scale-in, then SIGKILL after its stop timeout.
+func waitForStop() os.Signal {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	return <-stop
+}
 
-		// Validate MIME type using first 512 bytes
-		buffer := make([]byte, 512)
-		_, err = file.Read(buffer)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
-			return
-		}
-		file.Seek(0, 0) // Reset file pointer
+// shutdown stops accepting connections and render jobs, then waits for in-flight
+// requests and, when rendering in-process, renders until timeout. Renders still
+// running are marked requeueable.
+func shutdown(srv *http.Server, queue JobQueue, worker *queueWorker, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-		mimeType := http.DetectContentType(buffer)
-		if mimeType != "video/mp4" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Only MP4 files are allowed"})
-			return
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Warn("HTTP shutdown incomplete", "error", err)
 		}
+	}()
 
-		// Generate secure filename with UUID
-		ext := filepath.Ext(header.Filename)
-		if ext == "" {
-			ext = ".mp4"
-		}
-		filename := uuid.New().String() + ext
-		
-		// Upload directly to S3
-		bucketName := os.Getenv("S3_BUCKET")
-		if bucketName == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "S3_BUCKET not configured"})
-			return
-		}
-		
-		s3Key := fmt.Sprintf("uploads/%s", filename)
-		s3URL, err := uploadToS3FromReader(file, bucketName, s3Key, "video/mp4")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload to S3: %v", err)})
-			return
+	if err := queue.Close(ctx); err != nil {
+		slog.Warn("Failed to close render queue", "error", err)
+	}
+	if worker != nil {
+		if err := worker.Close(ctx); err != nil {
+			slog.Warn("Render worker shutdown incomplete", "error", err)
 		}
+	}
+	wg.Wait()
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"fileUrl": s3URL,
-			"s3Key": s3Key,
-		})
-	})
-
-	// POST /get-presigned-url - Get presigned URL for preview
-	r.POST("/get-presigned-url", func(c *gin.Context) {
-		var req struct {
-			S3Key string `json:"s3Key"`
-		}
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-			return
-		}
-		bucketName := os.Getenv("S3_BUCKET")
-		if bucketName == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "S3_BUCKET not configured"})
-			return
-		}
-		// Generate presigned URL valid for 1 hour
-		presignedURL, err := getPresignedURL(bucketName, req.S3Key, 1*time.Hour)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate presigned URL: %v", err)})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"url": presignedURL})
+// newDeps connects to AWS using IAM role credentials and picks DynamoDB backed stores
+// when configured, in-memory ones otherwise, and the queue named by QUEUE_BACKEND
+func newDeps(cfg *Config) (Deps, error) {
+	awsSession, err := session.NewSession(&aws.Config{
+		Region: aws.String(cfg.AWSRegion),
 	})
-
-	// POST /transcribe - Transcribe video using AssemblyAI
-	r.POST("/transcribe", func(c *gin.Context) {
-		var req struct {
-			FileURL string `json:"fileUrl"`
-			S3Key   string `json:"s3Key"`
-		}
-		
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-			return
-		}
-
-		// Step 1: Generate presigned URL for AssemblyAI to access the video
-		bucketName := os.Getenv("S3_BUCKET")
-		if bucketName == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "S3_BUCKET not configured"})
-			return
-		}
-		
-		// Generate presigned URL valid for 1 hour
-		presignedURL, err := getPresignedURL(bucketName, req.S3Key, 1*time.Hour)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate presigned URL: %v", err)})
-			return
-		}
-		
-		log.Printf("Generated presigned URL for transcription: %s", presignedURL)
-
-		// Step 2: Request transcription using presigned URL
-		transcriptID, err := requestTranscription(presignedURL, apiKey)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Transcription request failed: %v", err)})
-			return
-		}
-
-		// Step 3: Poll for completion
-		transcript, err := pollTranscription(transcriptID, apiKey)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Transcription failed: %v", err)})
-			return
-		}
-
-		// Step 4: Convert to captions
-		captions := convertToCaptions(transcript.Words)
-		
-		// Step 5: Generate SRT file and upload to S3
-		srtContent := generateSRT(captions)
-		
-		srtKey := fmt.Sprintf("captions/%d.srt", time.Now().Unix())
-		srtURL, err := uploadToS3FromReader(strings.NewReader(srtContent), bucketName, srtKey, "text/plain")
+	if err != nil {
+		return Deps{}, fmt.Errorf("failed to create AWS session: %v", err)
+	}
+
+	deps := Deps{
+		Storage:     newS3Storage(s3.New(awsSession), cfg.S3Bucket),
+		Transcriber: newAssemblyAITranscriber(cfg.AssemblyAIKey),
+		Assets:      newMemoryAssetStore(),
+		APIKeys:     newMemoryAPIKeyStore(),
+		Usage:       newMemoryUsageStore(),
+	}
+
+	// Persist jobs in DynamoDB if configured, otherwise keep them in memory.
+	// API keys and usage counters live in the jobs table alongside render jobs.
+	deps.Jobs = newMemoryJobStore()
+	if cfg.DynamoDBTable != "" {
+		dynamoClient := dynamodb.New(awsSession)
+		deps.Jobs = &dynamoJobStore{client: dynamoClient, table: cfg.DynamoDBTable}
+		deps.APIKeys = &dynamoAPIKeyStore{client: dynamoClient, table: cfg.DynamoDBTable}
+		deps.Usage = &dynamoUsageStore{client: dynamoClient, table: cfg.DynamoDBTable}
+		slog.Info("Jobs stored in DynamoDB", "table", cfg.DynamoDBTable)
+	}
+
+	// SQS jobs are rendered by the Lambda or `main worker`, Redis jobs by `main worker`
+	// and memory jobs by this process
+	switch cfg.Queue.Backend {
+	case "sqs":
+		sqsClient := sqs.New(awsSession)
+		queue := &sqsJobQueue{client: sqsClient, url: cfg.SQSQueueURL, priorityURLs: map[string]string{
+			"high": cfg.SQSHighPriorityURL,
+			"low":  cfg.SQSLowPriorityURL,
+		}}
+		deps.Queue = queue
+		slog.Info("Render jobs queued in SQS", "queue_urls", queue.urls())
+		if cfg.SQSDeadLetterURL != "" {
+			deps.DeadLetters = &deadLetterQueue{client: sqsClient, url: cfg.SQSDeadLetterURL, queue: queue}
+		}
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		queue, err := newRedisJobQueue(ctx, cfg.Queue)
 		if err != nil {
-			log.Printf("Failed to upload SRT to S3: %v", err)
-			// Continue anyway, captions are in response
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"captions": captions,
-			"srtUrl":   srtURL,
-		})
-	})
-
-	// POST /render-job - Create async render job
-	r.POST("/render-job", func(c *gin.Context) {
-		var req struct {
-			VideoURL string    `json:"videoUrl"`
-			Captions []Caption `json:"captions"`
-			Style    string    `json:"style"`
-			S3Key    string    `json:"s3Key"`
-		}
-		
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-			return
-		}
-
-		// Create job
-		jobID := uuid.New().String()
-		job := &RenderJob{
-			ID:        jobID,
-			Status:    "pending",
-			VideoURL:  req.VideoURL,
-			S3Key:     req.S3Key,
-			Captions:  req.Captions,
-			Style:     req.Style,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-
-		// Use SQS + DynamoDB if configured, otherwise use in-memory
-		if sqsClient != nil && dynamoClient != nil {
-			// Save to DynamoDB
-			err := saveToDynamoDB(job)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save job"})
-				return
-			}
-
-			// Send to SQS
-			err = sendToSQS(job)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
-				return
-			}
-
-			log.Printf("Job %s queued to SQS", jobID)
-		} else {
-			// Fallback to in-memory processing
-			renderJobs[jobID] = job
-			go processRenderJob(jobID)
-			log.Printf("Job %s processing in-memory", jobID)
+			return Deps{}, err
 		}
+		deps.Queue = queue
+		slog.Info("Render jobs queued in Redis", "stream", cfg.Queue.RedisStream, "group", cfg.Queue.RedisGroup)
+	default:
+		queue := newMemoryJobQueue(cfg.Queue.Capacity, cfg.Queue.MaxDeliveries)
+		queue.jobs = deps.Jobs
+		deps.Queue = queue
+		slog.Info("Render jobs processed in-process", "capacity", cfg.Queue.Capacity)
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"jobId":  jobID,
-			"status": "pending",
-			"message": "Render job created successfully",
-		})
-	})
-
-	// GET /render-job/:id - Get job status
-	r.GET("/render-job/:id", func(c *gin.Context) {
-		jobID := c.Param("id")
-		
-		// Try DynamoDB first if configured
-		if dynamoClient != nil {
-			job, err := getFromDynamoDB(jobID)
-			if err == nil {
-				c.JSON(http.StatusOK, job)
-				return
-			}
-		}
-		
-		// Fallback to in-memory
-		job, exists := renderJobs[jobID]
-		if !exists {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
-			return
-		}
-		c.JSON(http.StatusOK, job)
-	})
+	// Persist asset records in DynamoDB when a table is configured
+	if cfg.DynamoDBAssetsTable != "" {
+		deps.Assets = &dynamoAssetStore{client: dynamodb.New(awsSession), table: cfg.DynamoDBAssetsTable}
+		slog.Info("Asset records stored in DynamoDB", "table", cfg.DynamoDBAssetsTable)
+	}
 
-	log.Println("Server starting on :7070")
-	r.Run(":7070")
+	return deps, nil
 }
 
 // uploadToAssemblyAI uploads a local file to AssemblyAI
@@ -716,7 +313,7 @@ func uploadToAssemblyAI(filePath, apiKey string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	
+
 	req.Header.Set("authorization", apiKey)
 	req.Header.Set("content-type", "application/octet-stream")
 
@@ -735,87 +332,6 @@ func uploadToAssemblyAI(filePath, apiKey string) (string, error) {
 	return uploadResp.UploadURL, nil
 }
 
-// requestTranscription starts a transcription job
-func requestTranscription(audioURL, apiKey string) (string, error) {
-	reqBody := AssemblyAITranscriptRequest{AudioURL: audioURL}
-	jsonData, _ := json.Marshal(reqBody)
-
-	req, err := http.NewRequest("POST", "https://api.assemblyai.com/v2/transcript", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-	
-	req.Header.Set("authorization", apiKey)
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	var transcriptResp AssemblyAITranscriptResponse
-	if err := json.NewDecoder(resp.Body).Decode(&transcriptResp); err != nil {
-		return "", err
-	}
-
-	return transcriptResp.ID, nil
-}
-
-// pollTranscription polls until transcription is complete
-// FIX #3: Add timeout, max attempts, and exponential backoff
-func pollTranscription(transcriptID, apiKey string) (*AssemblyAITranscriptResponse, error) {
-	url := fmt.Sprintf("https://api.assemblyai.com/v2/transcript/%s", transcriptID)
-	
-	// Create context with 10-minute timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-	
-	maxAttempts := 40
-	backoff := 1 * time.Second
-	
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		// Check if context is done
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("transcription timed out after 10 minutes")
-		default:
-		}
-		
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("authorization", apiKey)
-
-		client := &http.Client{Timeout: 30 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		var transcript AssemblyAITranscriptResponse
-		json.NewDecoder(resp.Body).Decode(&transcript)
-		resp.Body.Close()
-
-		if transcript.Status == "completed" {
-			return &transcript, nil
-		} else if transcript.Status == "error" {
-			return nil, fmt.Errorf("transcription failed")
-		}
-
-		// Exponential backoff: 1s → 2s → 4s → 8s → 16s → max 30s
-		time.Sleep(backoff)
-		backoff *= 2
-		if backoff > 30*time.Second {
-			backoff = 30 * time.Second
-		}
-	}
-	
-	return nil, fmt.Errorf("transcription timed out after %d attempts", maxAttempts)
-}
-
 // convertToCaptions converts AssemblyAI words to caption segments
 func convertToCaptions(words []struct {
 	Text  string `json:"text"`
@@ -836,7 +352,7 @@ func convertToCaptions(words []struct {
 		} else {
 			currentCaption.Text += " " + word.Text
 		}
-		
+
 		currentCaption.End = float64(word.End) / 1000.0
 		wordCount++
 
@@ -856,13 +372,13 @@ func convertToCaptions(words []struct {
 // generateSRT creates SRT format from captions
 func generateSRT(captions []Caption) string {
 	var srt strings.Builder
-	
+
 	for i, caption := range captions {
 		srt.WriteString(fmt.Sprintf("%d\n", i+1))
 		srt.WriteString(fmt.Sprintf("%s --> %s\n", formatSRTTime(caption.Start), formatSRTTime(caption.End)))
 		srt.WriteString(fmt.Sprintf("%s\n\n", caption.Text))
 	}
-	
+
 	return srt.String()
 }
 
@@ -872,7 +388,7 @@ func formatSRTTime(seconds float64) string {
 	minutes := (int(seconds) % 3600) / 60
 	secs := int(seconds) % 60
 	millis := int((seconds - float64(int(seconds))) * 1000)
-	
+
 	return fmt.Sprintf("%02d:%02d:%02d,%03d", hours, minutes, secs, millis)
 }
 
@@ -880,6 +396,6 @@ func formatSRTTime(seconds float64) string {
 func generateCLICommand(videoURL string, captions []Caption, style string) string {
 	captionsJSON, _ := json.Marshal(captions)
 	propsJSON := fmt.Sprintf(`{"videoUrl":"%s","captions":%s,"style":"%s"}`, videoURL, captionsJSON, style)
-	
+
 	return fmt.Sprintf(`cd remotion-app && npx remotion render src/index.tsx CaptionedVideo out/final.mp4 --props '%s'`, propsJSON)
 }
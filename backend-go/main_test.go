@@ -2,45 +2,268 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupTestRouter() *gin.Engine {
+// fakeStorage keeps objects in memory
+type fakeStorage struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+	modified map[string]time.Time
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		objects:  make(map[string][]byte),
+		metadata: make(map[string]map[string]string),
+		modified: make(map[string]time.Time),
+	}
+}
+
+func (f *fakeStorage) Put(ctx context.Context, key, contentType string, body io.Reader, metadata map[string]string) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = data
+	f.metadata[key] = metadata
+	f.modified[key] = time.Now()
+	return f.URL(key), nil
+}
+
+func (f *fakeStorage) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[key]
+	return data, ok, nil
+}
+
+func (f *fakeStorage) Metadata(ctx context.Context, key string) (map[string]*string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.objects[key]; !ok {
+		return nil, fmt.Errorf("no such key %s", key)
+	}
+	metadata := make(map[string]*string)
+	for k, v := range f.metadata[key] {
+		v := v
+		metadata[k] = &v
+	}
+	return metadata, nil
+}
+
+func (f *fakeStorage) Delete(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, key)
+	return nil
+}
+
+func (f *fakeStorage) List(ctx context.Context, prefix string, fn func(obj StoredObject)) error {
+	f.mu.Lock()
+	var objects []StoredObject
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, StoredObject{Key: key, Size: int64(len(data)), LastModified: f.modified[key]})
+		}
+	}
+	f.mu.Unlock()
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	for _, obj := range objects {
+		fn(obj)
+	}
+	return nil
+}
+
+func (f *fakeStorage) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("%s?X-Amz-Expires=%d&X-Amz-Signature=test-signature", f.URL(key), int(expiry.Seconds())), nil
+}
+
+func (f *fakeStorage) URL(key string) string {
+	return "https://test-bucket.local/" + key
+}
+
+// fakeQueue records enqueued jobs instead of processing them
+type fakeQueue struct {
+	JobQueue // consumer methods are not used by the API
+	mu       sync.Mutex
+	jobIDs   []string
+	closed   bool
+}
+
+func (q *fakeQueue) Enqueue(ctx context.Context, job *RenderJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errQueueClosed
+	}
+	q.jobIDs = append(q.jobIDs, job.ID)
+	return nil
+}
+
+func (q *fakeQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	return nil
+}
+
+// fakeTranscriber returns fixed captions and counts calls
+type fakeTranscriber struct {
+	captions []Caption
+	err      error
+	calls    int
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, mediaURL string) ([]Caption, error) {
+	f.calls++
+	return f.captions, f.err
+}
+
+// testServer is the real router built by NewServer around in-memory fakes
+type testServer struct {
+	t           *testing.T
+	cfg         *Config
+	server      *Server
+	router      *gin.Engine
+	storage     *fakeStorage
+	jobs        *memoryJobStore
+	queue       *fakeQueue
+	transcriber *fakeTranscriber
+	assets      *memoryAssetStore
+	apiKeys     *memoryAPIKeyStore
+	usage       *memoryUsageStore
+}
+
+// newTestServer builds a server with a valid config, adjusted by configure
+func newTestServer(t *testing.T, configure ...func(cfg *Config)) *testServer {
 	gin.SetMode(gin.TestMode)
-	r := gin.Default()
-	
-	// Create test directories
-	os.MkdirAll("uploads", 0755)
-	os.MkdirAll("captions", 0755)
-	
-	return r
+	cfg, err := loadConfig(mapSource(map[string]string{
+		"ASSEMBLYAI_KEY": "test-key",
+		"S3_BUCKET":      "test-bucket",
+	}))
+	if err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	ts := &testServer{
+		t:           t,
+		cfg:         cfg,
+		storage:     newFakeStorage(),
+		jobs:        newMemoryJobStore(),
+		queue:       &fakeQueue{},
+		transcriber: &fakeTranscriber{captions: []Caption{{Start: 0, End: 1.5, Text: "Hello world"}}},
+		assets:      newMemoryAssetStore(),
+		apiKeys:     newMemoryAPIKeyStore(),
+		usage:       newMemoryUsageStore(),
+	}
+	ts.server = &Server{cfg: cfg, Deps: ts.deps()}
+	ts.router = NewServer(cfg, ts.deps())
+	return ts
+}
+
+func (ts *testServer) deps() Deps {
+	return Deps{
+		Storage:     ts.storage,
+		Jobs:        ts.jobs,
+		Queue:       ts.queue,
+		Transcriber: ts.transcriber,
+		Assets:      ts.assets,
+		APIKeys:     ts.apiKeys,
+		Usage:       ts.usage,
+	}
+}
+
+// apiKey issues an API key for tenant
+func (ts *testServer) apiKey(tenant string) string {
+	plaintext, err := generateAPIKey()
+	assert.NoError(ts.t, err)
+	ts.apiKeys.Put(&APIKey{Hash: hashAPIKey(plaintext), TenantID: tenant, CreatedAt: time.Now()})
+	return plaintext
+}
+
+// serve runs a request through the router
+func (ts *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+// do sends a request with an API key, JSON-encoding body unless it is a string
+func (ts *testServer) do(method, path, apiKey string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		data, _ := json.Marshal(b)
+		reader = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	return ts.serve(req)
+}
+
+// upload posts an MP4 file to /upload
+func (ts *testServer) upload(apiKey, field, filename string, content []byte) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile(field, filename)
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-API-Key", apiKey)
+	return ts.serve(req)
+}
+
+// testVideo is a small MP4 with a 10 second video and audio track
+func testVideo() []byte {
+	data := testMP4(
+		testTrack("vide", "avc1", 1280, 720, 15360, 153600, 300),
+		testTrack("soun", "mp4a", 0, 0, 44100, 441000, 431),
+	)
+	// Content sniffing only recognizes "mp4*" major brands
+	copy(data[8:12], "mp42")
+	return data
 }
 
 // TestHealthEndpoint tests the health check endpoint
 func TestHealthEndpoint(t *testing.T) {
-	router := setupTestRouter()
-	
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "ok",
-			"service": "captioning-backend",
-		})
-	})
-	
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/health", nil)
-	router.ServeHTTP(w, req)
-	
+	ts := newTestServer(t)
+
+	w := ts.do("GET", "/health", "", nil)
+
 	assert.Equal(t, http.StatusOK, w.Code)
-	
+
 	var response map[string]string
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
@@ -50,63 +273,63 @@ func TestHealthEndpoint(t *testing.T) {
 
 // TestUploadEndpoint tests video upload
 func TestUploadEndpoint(t *testing.T) {
-	router := setupTestRouter()
-	
-	router.POST("/upload", func(c *gin.Context) {
-		file, err := c.FormFile("video")
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
-			return
-		}
-		
-		c.JSON(http.StatusOK, gin.H{"fileUrl": "uploads/" + file.Filename})
-	})
-	
-	// Create test file
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, _ := writer.CreateFormFile("video", "test.mp4")
-	part.Write([]byte("fake video content"))
-	writer.Close()
-	
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/upload", body)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	router.ServeHTTP(w, req)
-	
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+
+	w := ts.upload(key, "video", "test.mp4", testVideo())
+
 	assert.Equal(t, http.StatusOK, w.Code)
-	
-	var response map[string]string
+
+	var response struct {
+		AssetID string     `json:"assetId"`
+		FileURL string     `json:"fileUrl"`
+		S3Key   string     `json:"s3Key"`
+		Media   *MediaInfo `json:"media"`
+	}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Contains(t, response["fileUrl"], "uploads/test.mp4")
+	assert.Equal(t, "uploads/acme/"+response.AssetID+".mp4", response.S3Key)
+	assert.Contains(t, response.FileURL, response.S3Key)
+	assert.Equal(t, 10.0, response.Media.Duration)
+
+	_, stored, _ := ts.storage.Get(context.Background(), response.S3Key)
+	assert.True(t, stored)
+	asset, err := ts.assets.Get(response.AssetID)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", asset.Owner)
+	assert.Equal(t, "test.mp4", asset.Filename)
+
+	// The same content is not stored twice
+	w = ts.upload(key, "video", "copy.mp4", testVideo())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"duplicate":true`)
+	assert.Contains(t, w.Body.String(), response.AssetID)
 }
 
 // TestUploadEndpointNoFile tests upload without file
 func TestUploadEndpointNoFile(t *testing.T) {
-	router := setupTestRouter()
-	
-	router.POST("/upload", func(c *gin.Context) {
-		_, err := c.FormFile("video")
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"fileUrl": "uploads/test.mp4"})
-	})
-	
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/upload", nil)
-	router.ServeHTTP(w, req)
-	
+	ts := newTestServer(t)
+
+	w := ts.upload(ts.apiKey("acme"), "document", "test.mp4", testVideo())
+
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	
+
 	var response map[string]string
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Equal(t, "No file uploaded", response["error"])
 }
 
+// TestUploadEndpointRejectsNonMP4 tests MIME sniffing of uploads
+func TestUploadEndpointRejectsNonMP4(t *testing.T) {
+	ts := newTestServer(t)
+
+	w := ts.upload(ts.apiKey("acme"), "video", "test.mp4", []byte("fake video content"))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Only MP4 files are allowed")
+}
+
 // TestConvertToCaptions tests caption conversion logic
 func TestConvertToCaptions(t *testing.T) {
 	words := []struct {
@@ -121,9 +344,9 @@ func TestConvertToCaptions(t *testing.T) {
 		{Text: "a", Start: 2000, End: 2200},
 		{Text: "test", Start: 2200, End: 2700},
 	}
-	
+
 	captions := convertToCaptions(words)
-	
+
 	assert.NotEmpty(t, captions)
 	assert.Equal(t, 0.0, captions[0].Start)
 	assert.Contains(t, captions[0].Text, "Hello")
@@ -136,9 +359,9 @@ func TestGenerateSRT(t *testing.T) {
 		{Start: 0.0, End: 2.5, Text: "Hello world"},
 		{Start: 2.5, End: 5.0, Text: "This is a test"},
 	}
-	
+
 	srt := generateSRT(captions)
-	
+
 	assert.Contains(t, srt, "1\n")
 	assert.Contains(t, srt, "00:00:00,000 --> 00:00:02,500")
 	assert.Contains(t, srt, "Hello world")
@@ -158,7 +381,7 @@ func TestFormatSRTTime(t *testing.T) {
 		{65.123, "00:01:05,123"},
 		{3661.456, "01:01:01,456"},
 	}
-	
+
 	for _, test := range tests {
 		result := formatSRTTime(test.input)
 		assert.Equal(t, test.expected, result, "Failed for input %f", test.input)
@@ -170,9 +393,9 @@ func TestGenerateCLICommand(t *testing.T) {
 	captions := []Caption{
 		{Start: 0.0, End: 2.5, Text: "Test caption"},
 	}
-	
+
 	cmd := generateCLICommand("uploads/test.mp4", captions, "bottom")
-	
+
 	assert.Contains(t, cmd, "cd remotion-app")
 	assert.Contains(t, cmd, "npx remotion render")
 	assert.Contains(t, cmd, "CaptionedVideo")
@@ -182,77 +405,153 @@ func TestGenerateCLICommand(t *testing.T) {
 
 // TestTranscribeEndpointInvalidRequest tests transcribe with invalid request
 func TestTranscribeEndpointInvalidRequest(t *testing.T) {
-	router := setupTestRouter()
-	
-	router.POST("/transcribe", func(c *gin.Context) {
-		var req struct {
-			FileURL string `json:"fileUrl"`
-		}
-		
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-			return
-		}
-		
-		if req.FileURL == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "fileUrl is required"})
-			return
-		}
-		
-		c.JSON(http.StatusOK, gin.H{"captions": []Caption{}})
-	})
-	
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/transcribe", bytes.NewBufferString("invalid json"))
-	req.Header.Set("Content-Type", "application/json")
-	router.ServeHTTP(w, req)
-	
+	ts := newTestServer(t)
+
+	w := ts.do("POST", "/transcribe", ts.apiKey("acme"), "invalid json")
+
 	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 0, ts.transcriber.calls)
+}
+
+// TestTranscribeEndpoint tests transcription, caption versioning and the transcript cache
+func TestTranscribeEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+
+	w := ts.upload(key, "video", "talk.mp4", testVideo())
+	var uploaded struct {
+		AssetID string `json:"assetId"`
+		S3Key   string `json:"s3Key"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &uploaded)
+
+	w = ts.do("POST", "/transcribe", key, map[string]string{"s3Key": uploaded.S3Key})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Captions []Caption `json:"captions"`
+		SrtURL   string    `json:"srtUrl"`
+		Cached   bool      `json:"cached"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world", response.Captions[0].Text)
+	assert.False(t, response.Cached)
+	assert.Contains(t, response.SrtURL, captionKey(uploaded.AssetID, 1))
+
+	srt, found, _ := ts.storage.Get(context.Background(), captionKey(uploaded.AssetID, 1))
+	assert.True(t, found)
+	assert.Contains(t, string(srt), "Hello world")
+
+	// A second request reuses the cached transcript
+	w = ts.do("POST", "/transcribe", key, map[string]string{"s3Key": uploaded.S3Key})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"cached":true`)
+	assert.Equal(t, 1, ts.transcriber.calls)
+
+	// Other tenants cannot transcribe the upload
+	globex := ts.apiKey("globex")
+	w = ts.do("POST", "/transcribe", globex, map[string]string{"s3Key": uploaded.S3Key})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// even through a key under their own prefix naming the asset
+	forged := tenantUploadPrefix("globex") + uploaded.AssetID + ".mp4"
+	w = ts.do("POST", "/transcribe", globex, map[string]string{"s3Key": forged})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = ts.do("POST", "/render-job", globex, map[string]interface{}{"s3Key": forged, "captions": []Caption{{Start: 0, End: 2, Text: "Hi"}}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	asset, _ := ts.assets.Get(uploaded.AssetID)
+	assert.Len(t, asset.CaptionVersions, 1)
+
+	// nor learn from the cache that someone else uploaded the same video
+	w = ts.upload(globex, "video", "talk.mp4", testVideo())
+	json.Unmarshal(w.Body.Bytes(), &uploaded)
+	w = ts.do("POST", "/transcribe", globex, map[string]string{"s3Key": uploaded.S3Key})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"cached":false`)
+	assert.Equal(t, 2, ts.transcriber.calls)
 }
 
 // TestRenderJobEndpoint tests render job endpoint
 func TestRenderJobEndpoint(t *testing.T) {
-	router := setupTestRouter()
-	
-	router.POST("/render-job", func(c *gin.Context) {
-		var req struct {
-			VideoURL string    `json:"videoUrl"`
-			Captions []Caption `json:"captions"`
-			Style    string    `json:"style"`
-		}
-		
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-			return
-		}
-		
-		// Simulate CLI fallback
-		cliCommand := generateCLICommand(req.VideoURL, req.Captions, req.Style)
-		c.JSON(http.StatusOK, gin.H{
-			"success":    false,
-			"message":    "Remotion service unavailable. Use CLI fallback:",
-			"cliCommand": cliCommand,
-		})
-	})
-	
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+
 	reqBody := map[string]interface{}{
 		"videoUrl": "uploads/test.mp4",
 		"captions": []Caption{{Start: 0, End: 2, Text: "Test"}},
 		"style":    "bottom",
 	}
-	jsonData, _ := json.Marshal(reqBody)
-	
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/render-job", bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	router.ServeHTTP(w, req)
-	
+	w := ts.do("POST", "/render-job", key, reqBody)
+
 	assert.Equal(t, http.StatusOK, w.Code)
-	
+
 	var response map[string]interface{}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Contains(t, response, "cliCommand")
+	assert.Equal(t, "pending", response["status"])
+	jobID, _ := response["jobId"].(string)
+	assert.Equal(t, []string{jobID}, ts.queue.jobIDs)
+
+	w = ts.do("GET", "/render-job/"+jobID, key, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var job RenderJob
+	json.Unmarshal(w.Body.Bytes(), &job)
+	assert.Equal(t, "acme", job.TenantID)
+	assert.Equal(t, "bottom", job.Style)
+
+	w = ts.do("GET", "/render-job/"+jobID, ts.apiKey("globex"), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "jobs are scoped to their tenant")
+}
+
+// TestRenderJobEndpointPriority tests requested priorities, tenant defaults and scheduling
+func TestRenderJobEndpointPriority(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Queue.TenantPriorities = map[string]string{"trial": "low"}
+	})
+	scheduledAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	w := ts.do("POST", "/render-job", ts.apiKey("acme"), map[string]interface{}{
+		"videoUrl":    "uploads/test.mp4",
+		"priority":    "high",
+		"scheduledAt": scheduledAt,
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "high", response["priority"])
+	job, _ := ts.jobs.Get(response["jobId"].(string))
+	assert.Equal(t, "high", job.Priority)
+	if assert.NotNil(t, job.ScheduledAt) {
+		assert.True(t, scheduledAt.Equal(*job.ScheduledAt))
+	}
+
+	for tenant, priority := range map[string]string{"trial": "low", "acme": "normal"} {
+		w = ts.do("POST", "/render-job", ts.apiKey(tenant), map[string]interface{}{"videoUrl": "uploads/test.mp4"})
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, priority, response["priority"], tenant)
+	}
+
+	w = ts.do("POST", "/render-job", ts.apiKey("acme"), map[string]interface{}{"videoUrl": "uploads/test.mp4", "priority": "urgent"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = ts.do("POST", "/render-job", ts.apiKey("acme"), map[string]interface{}{
+		"videoUrl":    "uploads/test.mp4",
+		"scheduledAt": time.Now().Add(60 * 24 * time.Hour),
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, ts.queue.jobIDs, 3)
+}
+
+// TestRenderJobEndpointDraining tests that new jobs are refused while shutting down
+func TestRenderJobEndpointDraining(t *testing.T) {
+	ts := newTestServer(t)
+	ts.queue.Close(context.Background())
+
+	w := ts.do("POST", "/render-job", ts.apiKey("acme"), map[string]interface{}{"videoUrl": "uploads/test.mp4"})
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+	assert.Empty(t, ts.queue.jobIDs)
 }
 
 // Cleanup test directories
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "captioning_http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	uploadBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "captioning_upload_size_bytes",
+		Help:    "Size of stored video uploads.",
+		Buckets: prometheus.ExponentialBuckets(1<<20, 2, 9), // 1MB to 256MB
+	})
+
+	transcriptionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "captioning_transcriptions_total",
+		Help: "Transcription requests by outcome (success, error, cached).",
+	}, []string{"outcome"})
+
+	transcriptionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "captioning_transcription_duration_seconds",
+		Help:    "Time spent transcribing with AssemblyAI by outcome.",
+		Buckets: []float64{5, 10, 20, 30, 60, 120, 300, 600},
+	}, []string{"outcome"})
+
+	assemblyAIPollAttempts = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "captioning_assemblyai_poll_attempts",
+		Help:    "Status polls needed per AssemblyAI transcript.",
+		Buckets: []float64{1, 2, 3, 5, 8, 13, 20, 30, 40},
+	})
+
+	renderQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "captioning_render_queue_depth",
+		Help: "Render jobs queued or running, as reported by the job queue.",
+	})
+
+	renderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "captioning_render_duration_seconds",
+		Help:    "Render time by caption style and outcome.",
+		Buckets: []float64{10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"style", "outcome"})
+
+	remotionCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "captioning_remotion_circuit_open",
+		Help: "Whether the Remotion circuit breaker is open (1) or closed (0).",
+	})
+
+	dependencyUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "captioning_dependency_up",
+		Help: "Whether the last readiness probe of a dependency succeeded (1) or failed (0).",
+	}, []string{"dependency"})
+
+	s3ErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "captioning_s3_errors_total",
+		Help: "Failed S3 operations by operation.",
+	}, []string{"operation"})
+)
+
+// renderStyles are the caption styles Remotion accepts, anything else is labeled "invalid"
+var renderStyles = map[string]bool{"bottom": true, "top-bar": true, "karaoke": true}
+
+// styleLabel bounds the style label to known values since styles come from clients
+func styleLabel(style string) string {
+	if renderStyles[style] {
+		return style
+	}
+	return "invalid"
+}
+
+// queueDepther is implemented by queues that can report how many jobs are waiting or running
+type queueDepther interface {
+	Depth() (int, error)
+}
+
+// httpMetrics records request latency by route template, never by raw path
+func httpMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.
+			WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// metricsHandler handles GET /metrics, refreshing the queue depth before each scrape
+func (s *Server) metricsHandler() gin.HandlerFunc {
+	handler := promhttp.Handler()
+	return func(c *gin.Context) {
+		if queue, ok := s.Queue.(queueDepther); ok {
+			if depth, err := queue.Depth(); err == nil {
+				renderQueueDepth.Set(float64(depth))
+			} else {
+				loggerFrom(c.Request.Context()).Warn("Failed to read render queue depth", "error", err)
+			}
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
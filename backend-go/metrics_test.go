@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMetricsEndpoint tests that request latency is exported per route template
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+	ts.do("GET", "/health", "", nil)
+	ts.do("GET", "/render-job/some-unknown-id", key, nil)
+
+	w := ts.do("GET", "/metrics", "", nil)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `captioning_http_request_duration_seconds_count{method="GET",route="/health",status="200"}`)
+	assert.Contains(t, w.Body.String(), `route="/render-job/:id",status="404"`)
+	assert.NotContains(t, w.Body.String(), "some-unknown-id", "raw paths are never labels")
+}
+
+// TestTranscriptionMetrics tests transcription outcomes, including cache hits
+func TestTranscriptionMetrics(t *testing.T) {
+	success := testutil.ToFloat64(transcriptionsTotal.WithLabelValues("success"))
+	cached := testutil.ToFloat64(transcriptionsTotal.WithLabelValues("cached"))
+	uploads := histogramCount(t, uploadBytes)
+
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+	w := ts.upload(key, "video", "talk.mp4", testVideo())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assets, _ := ts.assets.List("acme")
+	s3Key := assets[0].S3Key
+
+	ts.do("POST", "/transcribe", key, map[string]string{"s3Key": s3Key})
+	ts.do("POST", "/transcribe", key, map[string]string{"s3Key": s3Key})
+
+	assert.Equal(t, success+1, testutil.ToFloat64(transcriptionsTotal.WithLabelValues("success")))
+	assert.Equal(t, cached+1, testutil.ToFloat64(transcriptionsTotal.WithLabelValues("cached")))
+	assert.Equal(t, uploads+1, histogramCount(t, uploadBytes))
+}
+
+// histogramCount returns the number of observations of a histogram
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	var m dto.Metric
+	assert.NoError(t, h.Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+// TestStyleLabel tests that client-supplied styles cannot grow label cardinality
+func TestStyleLabel(t *testing.T) {
+	assert.Equal(t, "karaoke", styleLabel("karaoke"))
+	assert.Equal(t, "invalid", styleLabel("<script>"))
+	assert.Equal(t, "invalid", styleLabel(""))
+}
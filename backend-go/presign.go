@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PresignPolicy limits which objects can be presigned and for how long
+type PresignPolicy struct {
+	AllowedPrefixes []string
+	DefaultExpiry   time.Duration
+	MaxExpiry       time.Duration
+}
+
+// loadPresignPolicy reads PRESIGN_ALLOWED_PREFIXES (comma separated),
+// PRESIGN_DEFAULT_EXPIRY and PRESIGN_MAX_EXPIRY
+func loadPresignPolicy(getenv configSource) (PresignPolicy, error) {
+	policy := PresignPolicy{
+		AllowedPrefixes: []string{"uploads/", "captions/", "output/"},
+		DefaultExpiry:   time.Hour,
+		MaxExpiry:       time.Hour,
+	}
+
+	if raw := getenv("PRESIGN_ALLOWED_PREFIXES"); raw != "" {
+		policy.AllowedPrefixes = nil
+		for _, prefix := range strings.Split(raw, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" {
+				policy.AllowedPrefixes = append(policy.AllowedPrefixes, prefix)
+			}
+		}
+	}
+	if raw := getenv("PRESIGN_MAX_EXPIRY"); raw != "" {
+		expiry, err := time.ParseDuration(raw)
+		if err != nil || expiry <= 0 {
+			return policy, fmt.Errorf("invalid PRESIGN_MAX_EXPIRY %q", raw)
+		}
+		policy.MaxExpiry = expiry
+	}
+	if raw := getenv("PRESIGN_DEFAULT_EXPIRY"); raw != "" {
+		expiry, err := time.ParseDuration(raw)
+		if err != nil || expiry <= 0 {
+			return policy, fmt.Errorf("invalid PRESIGN_DEFAULT_EXPIRY %q", raw)
+		}
+		policy.DefaultExpiry = expiry
+	}
+	if policy.DefaultExpiry > policy.MaxExpiry {
+		policy.DefaultExpiry = policy.MaxExpiry
+	}
+	return policy, nil
+}
+
+// allowsPrefix reports whether key falls under an allow-listed prefix
+func (p PresignPolicy) allowsPrefix(key string) bool {
+	if strings.Contains(key, "..") {
+		return false
+	}
+	for _, prefix := range p.AllowedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantOwnsObject checks the asset or job record behind an S3 key
+func (s *Server) tenantOwnsObject(tenantID, key string) bool {
+	switch {
+	case strings.HasPrefix(key, "uploads/"):
+		asset, err := s.Assets.Get(assetIDFromS3Key(key))
+		return err == nil && asset.Owner == tenantID && asset.S3Key == key
+	case strings.HasPrefix(key, "captions/"):
+		assetID, _, ok := parseCaptionKey(key)
+		if !ok {
+			return false
+		}
+		asset, err := s.Assets.Get(assetID)
+		return err == nil && asset.Owner == tenantID
+	case strings.HasPrefix(key, "output/"):
+		jobID, ok := renderJobIDFromOutputKey(key)
+		if !ok {
+			return false
+		}
+		job, err := s.Jobs.Get(jobID)
+		return err == nil && job.TenantID == tenantID && key == renderOutputKey(job)
+	}
+	return false
+}
+
+// auditPresign records every presign decision, with the expiry asked for in seconds
+func auditPresign(c *gin.Context, key string, expiresIn int, outcome string) {
+	loggerFrom(c.Request.Context()).Info("AUDIT presign",
+		"tenant", requestTenant(c),
+		"key", key,
+		"expires_in", expiresIn,
+		"outcome", outcome,
+		"ip", c.ClientIP(),
+	)
+}
+
+// presignHandler handles POST /get-presigned-url for objects owned by the caller
+func (s *Server) presignHandler(c *gin.Context) {
+	policy := s.cfg.Presign
+	var req struct {
+		S3Key     string `json:"s3Key"`
+		ExpiresIn int    `json:"expiresIn"` // seconds, optional
+	}
+	if err := c.BindJSON(&req); err != nil || req.S3Key == "" || req.ExpiresIn < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Compared in seconds, huge values would overflow a Duration
+	expiresIn := req.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = int(policy.DefaultExpiry / time.Second)
+	}
+	maxSeconds := int(policy.MaxExpiry / time.Second)
+	if expiresIn > maxSeconds {
+		auditPresign(c, req.S3Key, expiresIn, "denied:expiry")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expiresIn exceeds maximum of %d seconds", maxSeconds)})
+		return
+	}
+	expiry := time.Duration(expiresIn) * time.Second
+
+	if !policy.allowsPrefix(req.S3Key) {
+		auditPresign(c, req.S3Key, expiresIn, "denied:prefix")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Key is not allowed"})
+		return
+	}
+
+	// Unowned keys look the same as missing ones
+	if !s.tenantOwnsObject(requestTenant(c), req.S3Key) {
+		auditPresign(c, req.S3Key, expiresIn, "denied:owner")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Object not found"})
+		return
+	}
+
+	presignedURL, err := s.Storage.PresignGet(c.Request.Context(), req.S3Key, expiry)
+	if err != nil {
+		auditPresign(c, req.S3Key, expiresIn, "error")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate presigned URL: %v", err)})
+		return
+	}
+
+	auditPresign(c, req.S3Key, expiresIn, "granted")
+	c.JSON(http.StatusOK, gin.H{
+		"url":       presignedURL,
+		"expiresIn": int(expiry.Seconds()),
+	})
+}
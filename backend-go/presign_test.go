@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoadPresignPolicy tests presign limits from the environment
+func TestLoadPresignPolicy(t *testing.T) {
+	policy, err := loadPresignPolicy(mapSource(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, policy.MaxExpiry)
+	assert.True(t, policy.allowsPrefix("output/acme/video_1.mp4"))
+	assert.False(t, policy.allowsPrefix("transcripts/abc.json"))
+
+	policy, err = loadPresignPolicy(mapSource(map[string]string{
+		"PRESIGN_ALLOWED_PREFIXES": "output/",
+		"PRESIGN_MAX_EXPIRY":       "10m",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, policy.MaxExpiry)
+	assert.Equal(t, 10*time.Minute, policy.DefaultExpiry, "default is capped to the maximum")
+	assert.False(t, policy.allowsPrefix("uploads/acme/a.mp4"))
+	assert.False(t, policy.allowsPrefix("output/../uploads/a.mp4"))
+}
+
+// TestTenantOwnsObject tests ownership through asset and job records
+func TestTenantOwnsObject(t *testing.T) {
+	ts := newTestServer(t)
+	ts.assets.Put(&Asset{ID: "a1", Owner: "acme", S3Key: "uploads/acme/a1.mp4"})
+	ts.jobs.Put(&RenderJob{ID: "job-presign", TenantID: "acme"})
+	tenantOwnsObject := ts.server.tenantOwnsObject
+
+	assert.True(t, tenantOwnsObject("acme", "uploads/acme/a1.mp4"))
+	assert.False(t, tenantOwnsObject("globex", "uploads/acme/a1.mp4"))
+	assert.False(t, tenantOwnsObject("acme", "uploads/acme/unknown.mp4"))
+	assert.True(t, tenantOwnsObject("acme", "captions/a1/1.srt"))
+	assert.False(t, tenantOwnsObject("globex", "captions/a1/1.srt"))
+	assert.True(t, tenantOwnsObject("acme", "output/acme/video_job-presign.mp4"))
+	assert.False(t, tenantOwnsObject("globex", "output/acme/video_job-presign.mp4"))
+	assert.False(t, tenantOwnsObject("acme", "static/logo.png"))
+}
+
+// TestPresignHandlerDenials tests that only allowed requests reach S3
+func TestPresignHandlerDenials(t *testing.T) {
+	ts := newTestServer(t)
+	ts.assets.Put(&Asset{ID: "a1", Owner: "acme", S3Key: "uploads/acme/a1.mp4"})
+	keys := useTestTenants(ts, "acme", "globex")
+	router := ts.router
+
+	tests := []struct {
+		name   string
+		tenant string
+		body   map[string]interface{}
+		status int
+	}{
+		{"missing key", "acme", map[string]interface{}{}, http.StatusBadRequest},
+		{"expiry too long", "acme", map[string]interface{}{"s3Key": "uploads/acme/a1.mp4", "expiresIn": 86400}, http.StatusBadRequest},
+		{"expiry overflowing a duration", "acme", map[string]interface{}{"s3Key": "uploads/acme/a1.mp4", "expiresIn": 100000000000}, http.StatusBadRequest},
+		{"prefix not allowed", "acme", map[string]interface{}{"s3Key": "transcripts/abc.json"}, http.StatusForbidden},
+		{"other tenant", "globex", map[string]interface{}{"s3Key": "uploads/acme/a1.mp4"}, http.StatusNotFound},
+		{"owner", "acme", map[string]interface{}{"s3Key": "uploads/acme/a1.mp4"}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		body, _ := json.Marshal(test.body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/get-presigned-url", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", keys[test.tenant])
+		router.ServeHTTP(w, req)
+		assert.Equal(t, test.status, w.Code, test.name)
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MediaInfo holds the metadata extracted from an MP4 container
+type MediaInfo struct {
+	Duration   float64 `json:"duration"` // seconds
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	FPS        float64 `json:"fps"`
+	VideoCodec string  `json:"videoCodec,omitempty"`
+	AudioCodec string  `json:"audioCodec,omitempty"`
+	HasAudio   bool    `json:"hasAudio"`
+}
+
+var errNoMoov = errors.New("moov box not found")
+
+// boxHeader is the size/type prefix of an ISO-BMFF box
+type boxHeader struct {
+	Type       string
+	Size       int64 // total size including header
+	HeaderSize int64
+}
+
+// readBoxHeader reads a box header at offset, limited to the parent's end
+func readBoxHeader(r io.ReaderAt, offset, end int64) (boxHeader, error) {
+	var buf [16]byte
+	if _, err := r.ReadAt(buf[:8], offset); err != nil {
+		return boxHeader{}, err
+	}
+
+	h := boxHeader{
+		Type:       string(buf[4:8]),
+		Size:       int64(binary.BigEndian.Uint32(buf[0:4])),
+		HeaderSize: 8,
+	}
+
+	switch h.Size {
+	case 0:
+		// Box extends to the end of the parent
+		h.Size = end - offset
+	case 1:
+		// 64-bit largesize follows the type
+		if _, err := r.ReadAt(buf[8:16], offset+8); err != nil {
+			return boxHeader{}, err
+		}
+		large := binary.BigEndian.Uint64(buf[8:16])
+		if large > math.MaxInt64 {
+			return boxHeader{}, fmt.Errorf("box %q too large", h.Type)
+		}
+		h.Size = int64(large)
+		h.HeaderSize = 16
+	}
+
+	if h.Size < h.HeaderSize || offset+h.Size > end {
+		return boxHeader{}, fmt.Errorf("invalid size for box %q", h.Type)
+	}
+	return h, nil
+}
+
+// findBox scans the children of [start, end) for the first box of the given type
+// and returns the offset and end of its payload
+func findBox(r io.ReaderAt, start, end int64, boxType string) (int64, int64, bool, error) {
+	for offset := start; offset+8 <= end; {
+		h, err := readBoxHeader(r, offset, end)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if h.Type == boxType {
+			return offset + h.HeaderSize, offset + h.Size, true, nil
+		}
+		offset += h.Size
+	}
+	return 0, 0, false, nil
+}
+
+// eachBox calls fn for every child box of the given type within [start, end)
+func eachBox(r io.ReaderAt, start, end int64, boxType string, fn func(start, end int64) error) error {
+	for offset := start; offset+8 <= end; {
+		h, err := readBoxHeader(r, offset, end)
+		if err != nil {
+			return err
+		}
+		if h.Type == boxType {
+			if err := fn(offset+h.HeaderSize, offset+h.Size); err != nil {
+				return err
+			}
+		}
+		offset += h.Size
+	}
+	return nil
+}
+
+// readPayload reads an entire box payload, capped to avoid huge allocations
+func readPayload(r io.ReaderAt, start, end int64) ([]byte, error) {
+	const maxPayload = 1 << 20 // 1MB is plenty for header boxes
+	size := end - start
+	if size > maxPayload {
+		size = maxPayload
+	}
+	buf := make([]byte, size)
+	if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// probeMP4 parses the moov box of an MP4 file and extracts media information
+func probeMP4(r io.ReaderAt, size int64) (*MediaInfo, error) {
+	moovStart, moovEnd, ok, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MP4: %v", err)
+	}
+	if !ok {
+		return nil, errNoMoov
+	}
+
+	info := &MediaInfo{}
+
+	// mvhd: movie-level timescale and duration
+	if start, end, ok, err := findBox(r, moovStart, moovEnd, "mvhd"); err != nil {
+		return nil, err
+	} else if ok {
+		payload, err := readPayload(r, start, end)
+		if err != nil {
+			return nil, err
+		}
+		timescale, duration, err := parseTimescaleDuration(payload, "mvhd")
+		if err != nil {
+			return nil, err
+		}
+		if timescale > 0 {
+			info.Duration = float64(duration) / float64(timescale)
+		}
+	}
+
+	err = eachBox(r, moovStart, moovEnd, "trak", func(start, end int64) error {
+		return probeTrack(r, start, end, info)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse track: %v", err)
+	}
+
+	return info, nil
+}
+
+// probeTrack reads tkhd/mdia of a single track and merges it into info
+func probeTrack(r io.ReaderAt, trakStart, trakEnd int64, info *MediaInfo) error {
+	mdiaStart, mdiaEnd, ok, err := findBox(r, trakStart, trakEnd, "mdia")
+	if err != nil || !ok {
+		return err
+	}
+
+	handler, err := readHandlerType(r, mdiaStart, mdiaEnd)
+	if err != nil {
+		return err
+	}
+	if handler != "vide" && handler != "soun" {
+		return nil
+	}
+
+	// mdhd: media timescale and duration, needed for frame rate
+	var timescale, duration uint64
+	if start, end, ok, err := findBox(r, mdiaStart, mdiaEnd, "mdhd"); err != nil {
+		return err
+	} else if ok {
+		payload, err := readPayload(r, start, end)
+		if err != nil {
+			return err
+		}
+		if timescale, duration, err = parseTimescaleDuration(payload, "mdhd"); err != nil {
+			return err
+		}
+	}
+
+	stblStart, stblEnd, err := findSampleTable(r, mdiaStart, mdiaEnd)
+	if err != nil {
+		return err
+	}
+
+	codec := ""
+	if stblEnd > 0 {
+		if codec, err = readSampleEntryFormat(r, stblStart, stblEnd); err != nil {
+			return err
+		}
+	}
+
+	if handler == "soun" {
+		if !info.HasAudio {
+			info.HasAudio = true
+			info.AudioCodec = codec
+		}
+		return nil
+	}
+
+	// Only the first video track is reported
+	if info.VideoCodec != "" || info.Width > 0 {
+		return nil
+	}
+	info.VideoCodec = codec
+
+	if start, end, ok, err := findBox(r, trakStart, trakEnd, "tkhd"); err != nil {
+		return err
+	} else if ok {
+		payload, err := readPayload(r, start, end)
+		if err != nil {
+			return err
+		}
+		if info.Width, info.Height, err = parseTrackDimensions(payload); err != nil {
+			return err
+		}
+	}
+
+	if stblEnd > 0 && timescale > 0 && duration > 0 {
+		samples, err := readSampleCount(r, stblStart, stblEnd)
+		if err != nil {
+			return err
+		}
+		fps := float64(samples) * float64(timescale) / float64(duration)
+		info.FPS = math.Round(fps*100) / 100
+	}
+
+	if info.Duration == 0 && timescale > 0 {
+		info.Duration = float64(duration) / float64(timescale)
+	}
+	return nil
+}
+
+// readHandlerType returns the handler_type of the hdlr box (vide, soun, ...)
+func readHandlerType(r io.ReaderAt, mdiaStart, mdiaEnd int64) (string, error) {
+	start, end, ok, err := findBox(r, mdiaStart, mdiaEnd, "hdlr")
+	if err != nil || !ok {
+		return "", err
+	}
+	payload, err := readPayload(r, start, end)
+	if err != nil {
+		return "", err
+	}
+	// version/flags (4) + pre_defined (4) + handler_type (4)
+	if len(payload) < 12 {
+		return "", fmt.Errorf("hdlr box too short")
+	}
+	return string(payload[8:12]), nil
+}
+
+// findSampleTable locates mdia/minf/stbl, returning a zero end if absent
+func findSampleTable(r io.ReaderAt, mdiaStart, mdiaEnd int64) (int64, int64, error) {
+	minfStart, minfEnd, ok, err := findBox(r, mdiaStart, mdiaEnd, "minf")
+	if err != nil || !ok {
+		return 0, 0, err
+	}
+	stblStart, stblEnd, ok, err := findBox(r, minfStart, minfEnd, "stbl")
+	if err != nil || !ok {
+		return 0, 0, err
+	}
+	return stblStart, stblEnd, nil
+}
+
+// readSampleEntryFormat returns the fourcc of the first stsd entry (avc1, mp4a, ...)
+func readSampleEntryFormat(r io.ReaderAt, stblStart, stblEnd int64) (string, error) {
+	start, end, ok, err := findBox(r, stblStart, stblEnd, "stsd")
+	if err != nil || !ok {
+		return "", err
+	}
+	payload, err := readPayload(r, start, end)
+	if err != nil {
+		return "", err
+	}
+	// version/flags (4) + entry_count (4) + first entry: size (4) + format (4)
+	if len(payload) < 16 || binary.BigEndian.Uint32(payload[4:8]) == 0 {
+		return "", nil
+	}
+	return string(payload[12:16]), nil
+}
+
+// readSampleCount sums the sample counts in the stts box
+func readSampleCount(r io.ReaderAt, stblStart, stblEnd int64) (uint64, error) {
+	start, end, ok, err := findBox(r, stblStart, stblEnd, "stts")
+	if err != nil || !ok {
+		return 0, err
+	}
+	payload, err := readPayload(r, start, end)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) < 8 {
+		return 0, fmt.Errorf("stts box too short")
+	}
+	entries := int(binary.BigEndian.Uint32(payload[4:8]))
+	var total uint64
+	for i := 0; i < entries; i++ {
+		offset := 8 + i*8
+		if offset+8 > len(payload) {
+			break
+		}
+		total += uint64(binary.BigEndian.Uint32(payload[offset : offset+4]))
+	}
+	return total, nil
+}
+
+// parseTimescaleDuration decodes the version-dependent mvhd/mdhd header
+func parseTimescaleDuration(payload []byte, boxType string) (uint64, uint64, error) {
+	if len(payload) < 4 {
+		return 0, 0, fmt.Errorf("%s box too short", boxType)
+	}
+	if payload[0] == 1 {
+		// version (1) + flags (3) + creation (8) + modification (8) + timescale (4) + duration (8)
+		if len(payload) < 32 {
+			return 0, 0, fmt.Errorf("%s box too short", boxType)
+		}
+		return uint64(binary.BigEndian.Uint32(payload[20:24])), binary.BigEndian.Uint64(payload[24:32]), nil
+	}
+	// version (1) + flags (3) + creation (4) + modification (4) + timescale (4) + duration (4)
+	if len(payload) < 20 {
+		return 0, 0, fmt.Errorf("%s box too short", boxType)
+	}
+	return uint64(binary.BigEndian.Uint32(payload[12:16])), uint64(binary.BigEndian.Uint32(payload[16:20])), nil
+}
+
+// parseTrackDimensions reads the 16.16 fixed-point width and height from tkhd
+func parseTrackDimensions(payload []byte) (int, int, error) {
+	// width and height are the last 8 bytes for both versions
+	size := 84
+	if len(payload) > 0 && payload[0] == 1 {
+		size = 96
+	}
+	if len(payload) < size {
+		return 0, 0, fmt.Errorf("tkhd box too short")
+	}
+	width := binary.BigEndian.Uint32(payload[size-8 : size-4])
+	height := binary.BigEndian.Uint32(payload[size-4 : size])
+	return int(width >> 16), int(height >> 16), nil
+}
+
+// s3Metadata converts media info into S3 user metadata
+func (m *MediaInfo) s3Metadata() map[string]string {
+	return map[string]string{
+		"duration":    strconv.FormatFloat(m.Duration, 'f', 3, 64),
+		"width":       strconv.Itoa(m.Width),
+		"height":      strconv.Itoa(m.Height),
+		"fps":         strconv.FormatFloat(m.FPS, 'f', 2, 64),
+		"video-codec": m.VideoCodec,
+		"audio-codec": m.AudioCodec,
+		"has-audio":   strconv.FormatBool(m.HasAudio),
+	}
+}
+
+// mediaInfoFromS3Metadata rebuilds media info stored with an uploaded object
+func mediaInfoFromS3Metadata(meta map[string]*string) *MediaInfo {
+	get := func(key string) string {
+		// The SDK canonicalizes user metadata keys (e.g. "Has-Audio")
+		for k, v := range meta {
+			if v != nil && strings.EqualFold(k, key) {
+				return *v
+			}
+		}
+		return ""
+	}
+
+	hasAudio := get("has-audio")
+	if hasAudio == "" {
+		return nil
+	}
+
+	info := &MediaInfo{
+		VideoCodec: get("video-codec"),
+		AudioCodec: get("audio-codec"),
+	}
+	info.HasAudio, _ = strconv.ParseBool(hasAudio)
+	info.Duration, _ = strconv.ParseFloat(get("duration"), 64)
+	info.FPS, _ = strconv.ParseFloat(get("fps"), 64)
+	info.Width, _ = strconv.Atoi(get("width"))
+	info.Height, _ = strconv.Atoi(get("height"))
+	return info
+}
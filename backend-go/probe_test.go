@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// box builds an ISO-BMFF box from a type and payload
+func box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	buf := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(8+len(body)))
+	copy(buf[4:8], boxType)
+	return append(buf, body...)
+}
+
+func u32(values ...uint32) []byte {
+	buf := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(buf[i*4:], v)
+	}
+	return buf
+}
+
+// testTrack builds a minimal trak box with the given handler and codec
+func testTrack(handler, codec string, width, height, timescale, duration, samples uint32) []byte {
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:80], width<<16)
+	binary.BigEndian.PutUint32(tkhd[80:84], height<<16)
+
+	hdlr := append(u32(0, 0), []byte(handler)...)
+	hdlr = append(hdlr, make([]byte, 12)...)
+
+	stsd := append(u32(0, 1, 16), []byte(codec)...)
+	stts := u32(0, 1, samples, duration/samples)
+
+	return box("trak",
+		box("tkhd", tkhd),
+		box("mdia",
+			box("mdhd", u32(0, 0, 0, timescale, duration, 0)),
+			box("hdlr", hdlr),
+			box("minf", box("stbl", box("stsd", stsd), box("stts", stts))),
+		),
+	)
+}
+
+func testMP4(tracks ...[]byte) []byte {
+	ftyp := box("ftyp", []byte("isom"), u32(512), []byte("isomavc1"))
+	mvhd := box("mvhd", u32(0, 0, 0, 1000, 10000), make([]byte, 80))
+	moov := box("moov", append([][]byte{mvhd}, tracks...)...)
+	return append(append(ftyp, box("mdat", make([]byte, 32))...), moov...)
+}
+
+// TestProbeMP4 tests metadata extraction from a video with audio
+func TestProbeMP4(t *testing.T) {
+	data := testMP4(
+		testTrack("vide", "avc1", 1920, 1080, 15360, 153600, 300),
+		testTrack("soun", "mp4a", 0, 0, 44100, 441000, 431),
+	)
+
+	info, err := probeMP4(bytes.NewReader(data), int64(len(data)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, info.Duration)
+	assert.Equal(t, 1920, info.Width)
+	assert.Equal(t, 1080, info.Height)
+	assert.Equal(t, 30.0, info.FPS)
+	assert.Equal(t, "avc1", info.VideoCodec)
+	assert.Equal(t, "mp4a", info.AudioCodec)
+	assert.True(t, info.HasAudio)
+}
+
+// TestProbeMP4NoAudio tests that a video-only file reports no audio
+func TestProbeMP4NoAudio(t *testing.T) {
+	data := testMP4(testTrack("vide", "hvc1", 1280, 720, 25000, 250000, 250))
+
+	info, err := probeMP4(bytes.NewReader(data), int64(len(data)))
+
+	assert.NoError(t, err)
+	assert.False(t, info.HasAudio)
+	assert.Equal(t, "hvc1", info.VideoCodec)
+	assert.Equal(t, 25.0, info.FPS)
+}
+
+// TestProbeMP4Invalid tests files without a moov box or with corrupt sizes
+func TestProbeMP4Invalid(t *testing.T) {
+	noMoov := box("ftyp", []byte("isom"))
+	_, err := probeMP4(bytes.NewReader(noMoov), int64(len(noMoov)))
+	assert.ErrorIs(t, err, errNoMoov)
+
+	corrupt := box("ftyp", []byte("isom"))
+	binary.BigEndian.PutUint32(corrupt[0:4], 4096)
+	_, err = probeMP4(bytes.NewReader(corrupt), int64(len(corrupt)))
+	assert.Error(t, err)
+}
+
+// TestMediaInfoS3MetadataRoundTrip tests storing media info as S3 metadata
+func TestMediaInfoS3MetadataRoundTrip(t *testing.T) {
+	info := &MediaInfo{Duration: 12.5, Width: 640, Height: 360, FPS: 29.97, VideoCodec: "avc1", HasAudio: false}
+
+	meta := map[string]*string{}
+	for k, v := range info.s3Metadata() {
+		v := v
+		// S3 returns canonicalized header-style keys
+		meta[http.CanonicalHeaderKey(k)] = &v
+	}
+
+	assert.Equal(t, info, mediaInfoFromS3Metadata(meta))
+	assert.Nil(t, mediaInfoFromS3Metadata(map[string]*string{}))
+}
@@ -0,0 +1,711 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errQueueClosed  = errors.New("job queue is closed")
+	errQueueFull    = errors.New("job queue is full")
+	errLeaseExpired = errors.New("job lease expired")
+)
+
+// interruptGrace is how long cancelled jobs get to record that they can be requeued
+const interruptGrace = 5 * time.Second
+
+// queueBackends are the supported QUEUE_BACKEND values
+var queueBackends = []string{"memory", "sqs", "redis"}
+
+// jobPriorities are the render priorities, highest first
+var jobPriorities = []string{"high", "normal", "low"}
+
+// maxScheduleAhead bounds how far in the future a render can be scheduled
+const maxScheduleAhead = 30 * 24 * time.Hour
+
+// validPriority reports whether p is one of jobPriorities
+func validPriority(p string) bool {
+	for _, priority := range jobPriorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
+// QueueConfig selects where render jobs are queued
+type QueueConfig struct {
+	Backend       string // memory (consumed by this process), sqs or redis (consumed by `main worker`)
+	Capacity      int    // jobs the memory queue holds before refusing new ones
+	MaxDeliveries int    // memory and redis: deliveries before a job is dead-lettered, SQS uses its redrive policy
+	RedisURL      string
+	RedisStream   string
+	RedisGroup    string
+
+	DefaultPriority  string            // priority of jobs that don't ask for one
+	TenantPriorities map[string]string // per-tenant DefaultPriority overrides
+}
+
+// loadQueueConfig reads QUEUE_BACKEND, QUEUE_CAPACITY, QUEUE_MAX_DELIVERIES, REDIS_URL,
+// REDIS_STREAM, REDIS_GROUP, RENDER_PRIORITY_DEFAULT and RENDER_PRIORITY_TENANTS
+// (tenant=priority pairs, comma-separated). The backend defaults to sqs when
+// SQS_QUEUE_URL is set.
+func loadQueueConfig(getenv configSource) (QueueConfig, error) {
+	cfg := QueueConfig{
+		Backend:       getenv("QUEUE_BACKEND"),
+		Capacity:      1000,
+		MaxDeliveries: 3,
+		RedisURL:      getenv("REDIS_URL"),
+		RedisStream:   getenv("REDIS_STREAM"),
+		RedisGroup:    getenv("REDIS_GROUP"),
+
+		DefaultPriority:  getenv("RENDER_PRIORITY_DEFAULT"),
+		TenantPriorities: map[string]string{},
+	}
+	if cfg.DefaultPriority == "" {
+		cfg.DefaultPriority = "normal"
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "memory"
+		if getenv("SQS_QUEUE_URL") != "" {
+			cfg.Backend = "sqs"
+		}
+	}
+	if cfg.RedisStream == "" {
+		cfg.RedisStream = "render-jobs"
+	}
+	if cfg.RedisGroup == "" {
+		cfg.RedisGroup = "render-workers"
+	}
+
+	var errs []error
+	valid := false
+	for _, backend := range queueBackends {
+		valid = valid || cfg.Backend == backend
+	}
+	if !valid {
+		errs = append(errs, fmt.Errorf("invalid QUEUE_BACKEND %q, expected memory, sqs or redis", cfg.Backend))
+	}
+	for _, n := range []struct {
+		env   string
+		value *int
+	}{
+		{"QUEUE_CAPACITY", &cfg.Capacity},
+		{"QUEUE_MAX_DELIVERIES", &cfg.MaxDeliveries},
+	} {
+		if raw := getenv(n.env); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 {
+				errs = append(errs, fmt.Errorf("invalid %s %q, expected a positive integer", n.env, raw))
+				continue
+			}
+			*n.value = parsed
+		}
+	}
+	if cfg.RedisURL != "" {
+		if u, err := url.Parse(cfg.RedisURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+			errs = append(errs, errors.New("invalid REDIS_URL, expected redis://[user:password@]host:port[/db]"))
+		}
+	}
+	if !validPriority(cfg.DefaultPriority) {
+		errs = append(errs, fmt.Errorf("invalid RENDER_PRIORITY_DEFAULT %q, expected high, normal or low", cfg.DefaultPriority))
+	}
+	for _, entry := range strings.Split(getenv("RENDER_PRIORITY_TENANTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tenant, priority, ok := strings.Cut(entry, "=")
+		tenant, priority = strings.TrimSpace(tenant), strings.TrimSpace(priority)
+		if !ok || tenant == "" || !validPriority(priority) {
+			errs = append(errs, fmt.Errorf("invalid RENDER_PRIORITY_TENANTS entry %q, expected tenant=high, normal or low", entry))
+			continue
+		}
+		cfg.TenantPriorities[tenant] = priority
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// priorityFor returns requested if set, otherwise the tenant's default priority
+func (cfg QueueConfig) priorityFor(tenantID, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	if priority, ok := cfg.TenantPriorities[tenantID]; ok {
+		return priority
+	}
+	return cfg.DefaultPriority
+}
+
+// tenantPriorityList renders TenantPriorities in RENDER_PRIORITY_TENANTS form
+func (cfg QueueConfig) tenantPriorityList() string {
+	var entries []string
+	for tenant, priority := range cfg.TenantPriorities {
+		entries = append(entries, tenant+"="+priority)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// JobQueue hands saved render jobs to consumers. Delivery is at least once: a job whose
+// lease runs out before it is acked is delivered again, and a job delivered too often
+// is dead-lettered.
+type JobQueue interface {
+	Enqueue(ctx context.Context, job *RenderJob) error
+	// Dequeue waits until a job is available or ctx is done and leases it for leaseFor
+	Dequeue(ctx context.Context, leaseFor time.Duration) (*Lease, error)
+	// Extend keeps a lease for another leaseFor from now
+	Extend(ctx context.Context, lease *Lease, leaseFor time.Duration) error
+	// Ack removes a finished job from the queue
+	Ack(ctx context.Context, lease *Lease) error
+	// Nack gives the job back to be delivered again after delay
+	Nack(ctx context.Context, lease *Lease, delay time.Duration) error
+	// Close stops accepting jobs
+	Close(ctx context.Context) error
+}
+
+// Lease is a job handed to one consumer by Dequeue
+type Lease struct {
+	JobID      string
+	Priority   string
+	Deliveries int               // times the job was handed out, including this one
+	Attributes map[string]string // requestId and trace context of the request that queued the job
+	handle     string            // SQS receipt handle, stream entry ID or memory token
+	source     string            // SQS queue URL the message was received from
+}
+
+// Context continues the trace of the request that queued the job
+func (l *Lease) Context(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(l.Attributes))
+}
+
+// jobMessage is the body every backend stores for a job
+func jobMessage(job *RenderJob) string {
+	message := map[string]interface{}{
+		"jobId":    job.ID,
+		"videoUrl": job.VideoURL,
+		"s3Key":    job.S3Key,
+		"captions": job.Captions,
+		"style":    job.Style,
+		"tenantId": job.TenantID,
+		"priority": job.Priority,
+	}
+	if job.ScheduledAt != nil {
+		message["scheduledAt"] = job.ScheduledAt.UTC().Format(time.RFC3339)
+	}
+	body, _ := json.Marshal(message)
+	return string(body)
+}
+
+// queuedJob is the part of a job message consumers need before loading the job
+type queuedJob struct {
+	JobID       string     `json:"jobId"`
+	Priority    string     `json:"priority"`
+	ScheduledAt *time.Time `json:"scheduledAt"`
+}
+
+// parseJobMessage reads a job message body, JobID is empty if there is none
+func parseJobMessage(body string) queuedJob {
+	var job queuedJob
+	json.Unmarshal([]byte(body), &job)
+	return job
+}
+
+// jobAttributes carries the trace context of ctx and the job's request ID alongside its message
+func jobAttributes(ctx context.Context, job *RenderJob) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if job.RequestID != "" {
+		carrier["requestId"] = job.RequestID
+	}
+	return carrier
+}
+
+// maxSQSDelay is the longest delay SQS accepts on a message
+const maxSQSDelay = 15 * time.Minute
+
+// sqsPriorityWait is how long an idle consumer long-polls the highest priority queue
+// before checking the others again
+const sqsPriorityWait = 2
+
+// sqsJobQueue queues jobs in SQS for the render worker Lambda or `main worker`. Leases
+// are visibility timeouts and dead-lettering follows the queue's redrive policy. Jobs
+// scheduled further out than SQS can delay a message are sent again until they are due.
+type sqsJobQueue struct {
+	client       sqsiface.SQSAPI
+	url          string            // normal priority, and any priority without its own queue
+	priorityURLs map[string]string // SQS_QUEUE_URL_HIGH and SQS_QUEUE_URL_LOW when set
+}
+
+// urlFor returns the queue jobs of priority are sent to
+func (q *sqsJobQueue) urlFor(priority string) string {
+	if url := q.priorityURLs[priority]; url != "" {
+		return url
+	}
+	return q.url
+}
+
+// urls lists the distinct queues, highest priority first
+func (q *sqsJobQueue) urls() []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, priority := range jobPriorities {
+		if url := q.urlFor(priority); !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// Enqueue sends job to the SQS queue of its priority
+func (q *sqsJobQueue) Enqueue(ctx context.Context, job *RenderJob) error {
+	ctx, span := tracer().Start(ctx, "sqs.SendMessage", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("render.job_id", job.ID), attribute.String("render.priority", job.Priority)))
+
+	// The worker continues the trace and tags its logs and Remotion calls with the originating request
+	attributes := map[string]*sqs.MessageAttributeValue{}
+	for key, value := range jobAttributes(ctx, job) {
+		attributes[key] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+	}
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(q.urlFor(job.Priority)),
+		MessageBody:       aws.String(jobMessage(job)),
+		MessageAttributes: attributes,
+	}
+	if job.ScheduledAt != nil {
+		input.DelaySeconds = aws.Int64(sqsDelaySeconds(time.Until(*job.ScheduledAt)))
+	}
+	_, err := q.client.SendMessageWithContext(ctx, input)
+	endSpan(span, err)
+	return err
+}
+
+// sqsDelaySeconds converts the time until a job is due into a message delay SQS accepts
+func sqsDelaySeconds(until time.Duration) int64 {
+	if until <= 0 {
+		return 0
+	}
+	if until > maxSQSDelay {
+		until = maxSQSDelay
+	}
+	return int64((until + time.Second - 1) / time.Second)
+}
+
+// Dequeue polls the queues in priority order until a due message arrives. Messages
+// without a job are left for the dead-letter queue.
+func (q *sqsJobQueue) Dequeue(ctx context.Context, leaseFor time.Duration) (*Lease, error) {
+	urls := q.urls()
+	for {
+		for _, url := range urls {
+			// A single queue can long-poll, several are checked quickly in turn
+			wait := int64(0)
+			if len(urls) == 1 {
+				wait = 20
+			}
+			if lease, err := q.receive(ctx, url, leaseFor, wait); lease != nil || err != nil {
+				return lease, err
+			}
+		}
+		if len(urls) > 1 {
+			if lease, err := q.receive(ctx, urls[0], leaseFor, sqsPriorityWait); lease != nil || err != nil {
+				return lease, err
+			}
+		}
+	}
+}
+
+// receive returns the next due job on url, or nil if there is none
+func (q *sqsJobQueue) receive(ctx context.Context, url string, leaseFor time.Duration, wait int64) (*Lease, error) {
+	result, err := q.client.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(url),
+		MaxNumberOfMessages:   aws.Int64(1),
+		WaitTimeSeconds:       aws.Int64(wait),
+		VisibilityTimeout:     aws.Int64(int64(leaseFor / time.Second)),
+		AttributeNames:        aws.StringSlice([]string{sqs.MessageSystemAttributeNameApproximateReceiveCount}),
+		MessageAttributeNames: aws.StringSlice([]string{"All"}),
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range result.Messages {
+		queued := parseJobMessage(aws.StringValue(msg.Body))
+		if queued.JobID == "" {
+			loggerFrom(ctx).Error("Render message has no job ID", "message_id", aws.StringValue(msg.MessageId))
+			continue
+		}
+		if queued.ScheduledAt != nil && time.Until(*queued.ScheduledAt) >= time.Second {
+			if err := q.postpone(ctx, url, msg, time.Until(*queued.ScheduledAt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		lease := &Lease{
+			JobID:      queued.JobID,
+			Priority:   queued.Priority,
+			Attributes: map[string]string{},
+			handle:     aws.StringValue(msg.ReceiptHandle),
+			source:     url,
+		}
+		lease.Deliveries, _ = strconv.Atoi(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+		for key, value := range msg.MessageAttributes {
+			lease.Attributes[key] = aws.StringValue(value.StringValue)
+		}
+		return lease, nil
+	}
+	return nil, nil
+}
+
+// postpone sends a copy of a message that isn't due yet with a new delay and deletes
+// the original, so waiting doesn't count towards the redrive policy
+func (q *sqsJobQueue) postpone(ctx context.Context, url string, msg *sqs.Message, until time.Duration) error {
+	_, err := q.client.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(url),
+		MessageBody:       msg.Body,
+		MessageAttributes: msg.MessageAttributes,
+		DelaySeconds:      aws.Int64(sqsDelaySeconds(until)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to postpone scheduled render message: %v", err)
+	}
+	_, err = q.client.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(url),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		// The copy is already queued, the original comes back and is postponed again
+		loggerFrom(ctx).Warn("Failed to delete postponed render message", "message_id", aws.StringValue(msg.MessageId), "error", err)
+	}
+	return nil
+}
+
+// leaseURL is the queue a lease's message was received from
+func (q *sqsJobQueue) leaseURL(lease *Lease) string {
+	if lease.source != "" {
+		return lease.source
+	}
+	return q.url
+}
+
+// Extend pushes the message's visibility timeout out to leaseFor from now
+func (q *sqsJobQueue) Extend(ctx context.Context, lease *Lease, leaseFor time.Duration) error {
+	return q.changeVisibility(ctx, lease, leaseFor)
+}
+
+// Ack deletes the message
+func (q *sqsJobQueue) Ack(ctx context.Context, lease *Lease) error {
+	_, err := q.client.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.leaseURL(lease)),
+		ReceiptHandle: aws.String(lease.handle),
+	})
+	return err
+}
+
+// Nack makes the message visible again after delay
+func (q *sqsJobQueue) Nack(ctx context.Context, lease *Lease, delay time.Duration) error {
+	return q.changeVisibility(ctx, lease, delay)
+}
+
+func (q *sqsJobQueue) changeVisibility(ctx context.Context, lease *Lease, timeout time.Duration) error {
+	_, err := q.client.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.leaseURL(lease)),
+		ReceiptHandle:     aws.String(lease.handle),
+		VisibilityTimeout: aws.Int64(int64(timeout / time.Second)),
+	})
+	return err
+}
+
+// Depth reports the messages waiting in or being processed from the queues
+func (q *sqsJobQueue) Depth() (int, error) {
+	depth := 0
+	for _, url := range q.urls() {
+		result, err := q.client.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+			QueueUrl: aws.String(url),
+			AttributeNames: aws.StringSlice([]string{
+				sqs.QueueAttributeNameApproximateNumberOfMessages,
+				sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+				sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+			}),
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, value := range result.Attributes {
+			n, _ := strconv.Atoi(aws.StringValue(value))
+			depth += n
+		}
+	}
+	return depth, nil
+}
+
+// Ping checks that the queues exist and are reachable
+func (q *sqsJobQueue) Ping(ctx context.Context) error {
+	for _, url := range q.urls() {
+		_, err := q.client.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(url),
+			AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close is a no-op, queued messages outlive this process
+func (q *sqsJobQueue) Close(ctx context.Context) error {
+	return nil
+}
+
+// memoryJobQueue is a bounded in-process queue that hands out jobs by priority, oldest
+// first within a priority. Jobs still queued when the process exits stay pending in the
+// job store for the reconciler. Without a dead-letter queue, jobs delivered too often
+// are failed in jobs.
+type memoryJobQueue struct {
+	capacity      int
+	maxDeliveries int
+	jobs          JobStore // nil leaves dropped jobs as they are
+	notify        chan struct{} // signalled when a job may be ready
+	closing       chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	ready  map[string][]*Lease // by priority, oldest first
+	held   map[string]*memoryLease
+	tokens int
+}
+
+// memoryLease is a handed out job, or a nacked or scheduled one waiting until it is due
+type memoryLease struct {
+	lease    *Lease
+	expires  time.Time
+	released bool // not handed out, expires is when it is ready
+}
+
+func newMemoryJobQueue(capacity, maxDeliveries int) *memoryJobQueue {
+	return &memoryJobQueue{
+		capacity:      capacity,
+		maxDeliveries: maxDeliveries,
+		notify:        make(chan struct{}, 1),
+		closing:       make(chan struct{}),
+		ready:         map[string][]*Lease{},
+		held:          map[string]*memoryLease{},
+	}
+}
+
+// Enqueue queues job, or holds it until it is due if it is scheduled
+func (q *memoryJobQueue) Enqueue(ctx context.Context, job *RenderJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errQueueClosed
+	}
+	if q.depth() >= q.capacity {
+		return errQueueFull
+	}
+
+	lease := &Lease{JobID: job.ID, Priority: job.Priority, Attributes: jobAttributes(ctx, job)}
+	if !validPriority(lease.Priority) {
+		lease.Priority = "normal"
+	}
+	if job.ScheduledAt != nil && job.ScheduledAt.After(time.Now()) {
+		q.hold(lease, *job.ScheduledAt, true)
+		return nil
+	}
+	q.ready[lease.Priority] = append(q.ready[lease.Priority], lease)
+	q.signal()
+	return nil
+}
+
+// Dequeue waits for the next job, checking every second for expired leases and jobs
+// that became due
+func (q *memoryJobQueue) Dequeue(ctx context.Context, leaseFor time.Duration) (*Lease, error) {
+	for {
+		lease, dead, err := q.next(time.Now(), leaseFor)
+		q.failDeadLettered(dead)
+		if lease != nil || err != nil {
+			return lease, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.closing:
+			return nil, errQueueClosed
+		case <-q.notify:
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// next leases the highest priority ready job, nil if there is none, and returns the
+// jobs it dropped after too many deliveries
+func (q *memoryJobQueue) next(now time.Time, leaseFor time.Duration) (*Lease, []*Lease, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, nil, errQueueClosed
+	}
+	var dead []*Lease
+
+	// Jobs whose lease, nack delay or schedule has run out are ready again
+	for handle, held := range q.held {
+		if !now.Before(held.expires) {
+			delete(q.held, handle)
+			q.ready[held.lease.Priority] = append(q.ready[held.lease.Priority], held.lease)
+		}
+	}
+
+	for _, priority := range jobPriorities {
+		for len(q.ready[priority]) > 0 {
+			queued := q.ready[priority][0]
+			q.ready[priority] = q.ready[priority][1:]
+
+			lease := *queued
+			lease.Deliveries++
+			if lease.Deliveries > q.maxDeliveries {
+				dead = append(dead, &lease)
+				continue
+			}
+			q.hold(&lease, now.Add(leaseFor), false)
+			if q.depth() > len(q.held) {
+				// Wake another consumer for what is left
+				q.signal()
+			}
+			return &lease, dead, nil
+		}
+	}
+	return nil, dead, nil
+}
+
+// failDeadLettered marks dropped jobs failed so they can be retried, unless they
+// finished in the meantime
+func (q *memoryJobQueue) failDeadLettered(dead []*Lease) {
+	for _, lease := range dead {
+		deliveries := lease.Deliveries - 1
+		slog.Error("Render job dead-lettered after too many deliveries", "job_id", lease.JobID, "deliveries", deliveries)
+		if q.jobs == nil {
+			continue
+		}
+		job, err := q.jobs.Get(lease.JobID)
+		if err != nil {
+			slog.Error("Failed to load dead-lettered job", "job_id", lease.JobID, "error", err)
+			continue
+		}
+		if job.Status == "completed" || job.Status == "failed" {
+			continue
+		}
+		status := job.Status
+		job.Status = "failed"
+		job.Error = fmt.Sprintf("Dead-lettered after %d deliveries", deliveries)
+		job.UpdatedAt = time.Now()
+		if err := q.jobs.PutIfStatus(job, status); err != nil && !errors.Is(err, errJobStatusChanged) {
+			slog.Error("Failed to save dead-lettered job", "job_id", lease.JobID, "error", err)
+		}
+	}
+}
+
+// hold tracks lease under a new token until expires
+func (q *memoryJobQueue) hold(lease *Lease, expires time.Time, released bool) {
+	q.tokens++
+	lease.handle = strconv.Itoa(q.tokens)
+	q.held[lease.handle] = &memoryLease{lease: lease, expires: expires, released: released}
+}
+
+func (q *memoryJobQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// leased returns the handed out lease for handle
+func (q *memoryJobQueue) leased(lease *Lease) (*memoryLease, error) {
+	held, ok := q.held[lease.handle]
+	if !ok || held.released {
+		return nil, errLeaseExpired
+	}
+	return held, nil
+}
+
+func (q *memoryJobQueue) Extend(ctx context.Context, lease *Lease, leaseFor time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	held, err := q.leased(lease)
+	if err != nil {
+		return err
+	}
+	held.expires = time.Now().Add(leaseFor)
+	return nil
+}
+
+func (q *memoryJobQueue) Ack(ctx context.Context, lease *Lease) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.leased(lease); err != nil {
+		return err
+	}
+	delete(q.held, lease.handle)
+	return nil
+}
+
+func (q *memoryJobQueue) Nack(ctx context.Context, lease *Lease, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	held, err := q.leased(lease)
+	if err != nil {
+		return err
+	}
+	held.released = true
+	held.expires = time.Now().Add(delay)
+	if delay <= 0 {
+		q.signal()
+	}
+	return nil
+}
+
+// Depth reports the jobs waiting, running, scheduled or waiting out a nack delay
+func (q *memoryJobQueue) Depth() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth(), nil
+}
+
+func (q *memoryJobQueue) depth() int {
+	depth := len(q.held)
+	for _, ready := range q.ready {
+		depth += len(ready)
+	}
+	return depth
+}
+
+// Close refuses new jobs and wakes consumers waiting in Dequeue
+func (q *memoryJobQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.closing)
+	}
+	return nil
+}
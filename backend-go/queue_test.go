@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dequeueSoon dequeues with a short deadline so an empty queue fails the test quickly
+func dequeueSoon(t *testing.T, queue JobQueue, leaseFor time.Duration) (*Lease, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return queue.Dequeue(ctx, leaseFor)
+}
+
+// TestMemoryJobQueue tests that enqueued jobs are leased once and gone after Ack
+func TestMemoryJobQueue(t *testing.T) {
+	queue := newMemoryJobQueue(10, 3)
+	assert.NoError(t, queue.Enqueue(context.Background(), &RenderJob{ID: "job-1", RequestID: "req-123"}))
+
+	lease, err := dequeueSoon(t, queue, time.Minute)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "job-1", lease.JobID)
+		assert.Equal(t, 1, lease.Deliveries)
+		assert.Equal(t, "req-123", lease.Attributes["requestId"])
+		depth, _ := queue.Depth()
+		assert.Equal(t, 1, depth)
+
+		assert.NoError(t, queue.Ack(context.Background(), lease))
+		depth, _ = queue.Depth()
+		assert.Equal(t, 0, depth)
+		assert.ErrorIs(t, queue.Ack(context.Background(), lease), errLeaseExpired)
+	}
+}
+
+// TestMemoryJobQueueNack tests that nacked jobs are delivered again after their delay
+func TestMemoryJobQueueNack(t *testing.T) {
+	queue := newMemoryJobQueue(10, 3)
+	queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"})
+	lease, _ := dequeueSoon(t, queue, time.Minute)
+
+	assert.NoError(t, queue.Nack(context.Background(), lease, 0))
+	assert.ErrorIs(t, queue.Extend(context.Background(), lease, time.Minute), errLeaseExpired)
+
+	again, err := dequeueSoon(t, queue, time.Minute)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "job-1", again.JobID)
+		assert.Equal(t, 2, again.Deliveries)
+	}
+}
+
+// TestMemoryJobQueueLeaseExpiry tests that jobs whose lease runs out are delivered again
+func TestMemoryJobQueueLeaseExpiry(t *testing.T) {
+	queue := newMemoryJobQueue(10, 3)
+	queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"})
+	lease, _ := dequeueSoon(t, queue, time.Millisecond)
+
+	again, err := dequeueSoon(t, queue, time.Minute)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "job-1", again.JobID)
+		assert.Equal(t, 2, again.Deliveries)
+	}
+	assert.ErrorIs(t, queue.Ack(context.Background(), lease), errLeaseExpired)
+}
+
+// TestMemoryJobQueueMaxDeliveries tests that a job is dropped and failed once it was delivered too often
+func TestMemoryJobQueueMaxDeliveries(t *testing.T) {
+	queue := newMemoryJobQueue(10, 2)
+	queue.jobs = newMemoryJobStore()
+	queue.jobs.Put(&RenderJob{ID: "job-1", Status: "processing"})
+	queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"})
+	for i := 0; i < 2; i++ {
+		lease, err := dequeueSoon(t, queue, time.Minute)
+		if assert.NoError(t, err) {
+			queue.Nack(context.Background(), lease, 0)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	_, err := queue.Dequeue(ctx, time.Minute)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	depth, _ := queue.Depth()
+	assert.Equal(t, 0, depth)
+	job, _ := queue.jobs.Get("job-1")
+	assert.Equal(t, "failed", job.Status)
+	assert.Equal(t, "Dead-lettered after 2 deliveries", job.Error)
+}
+
+// TestMemoryJobQueuePriority tests that higher priorities are dequeued first, oldest first within one
+func TestMemoryJobQueuePriority(t *testing.T) {
+	queue := newMemoryJobQueue(10, 3)
+	for _, job := range []*RenderJob{
+		{ID: "low-1", Priority: "low"},
+		{ID: "normal-1", Priority: "normal"},
+		{ID: "high-1", Priority: "high"},
+		{ID: "normal-2"},
+		{ID: "high-2", Priority: "high"},
+	} {
+		assert.NoError(t, queue.Enqueue(context.Background(), job))
+	}
+
+	var order []string
+	for i := 0; i < 5; i++ {
+		lease, err := dequeueSoon(t, queue, time.Minute)
+		if assert.NoError(t, err) {
+			order = append(order, lease.JobID)
+		}
+	}
+
+	assert.Equal(t, []string{"high-1", "high-2", "normal-1", "normal-2", "low-1"}, order)
+}
+
+// TestMemoryJobQueueScheduled tests that scheduled jobs are held until they are due
+func TestMemoryJobQueueScheduled(t *testing.T) {
+	queue := newMemoryJobQueue(10, 3)
+	scheduledAt := time.Now().Add(100 * time.Millisecond)
+	queue.Enqueue(context.Background(), &RenderJob{ID: "later", ScheduledAt: &scheduledAt})
+	queue.Enqueue(context.Background(), &RenderJob{ID: "now", Priority: "low"})
+
+	first, _ := dequeueSoon(t, queue, time.Minute)
+	second, err := dequeueSoon(t, queue, time.Minute)
+
+	assert.Equal(t, "now", first.JobID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "later", second.JobID)
+		assert.Equal(t, 1, second.Deliveries)
+		assert.False(t, time.Now().Before(scheduledAt))
+	}
+}
+
+// TestMemoryJobQueueFull tests that jobs beyond the capacity are refused
+func TestMemoryJobQueueFull(t *testing.T) {
+	queue := newMemoryJobQueue(1, 3)
+
+	assert.NoError(t, queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"}))
+	assert.ErrorIs(t, queue.Enqueue(context.Background(), &RenderJob{ID: "job-2"}), errQueueFull)
+}
+
+// TestMemoryJobQueueClose tests that a closed queue refuses jobs and wakes waiting consumers
+func TestMemoryJobQueueClose(t *testing.T) {
+	queue := newMemoryJobQueue(10, 3)
+	dequeued := make(chan error, 1)
+	go func() {
+		_, err := queue.Dequeue(context.Background(), time.Minute)
+		dequeued <- err
+	}()
+
+	assert.NoError(t, queue.Close(context.Background()))
+
+	select {
+	case err := <-dequeued:
+		assert.ErrorIs(t, err, errQueueClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Dequeue did not return after Close")
+	}
+	assert.ErrorIs(t, queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"}), errQueueClosed)
+}
+
+// TestSQSJobQueue tests the message sent for a job and how leases map to visibility
+func TestSQSJobQueue(t *testing.T) {
+	client := newFakeSQS()
+	queue := testSQSQueue(client)
+	job := &RenderJob{ID: "job-1", TenantID: "acme", S3Key: "uploads/acme/a1.mp4", Style: "bottom", RequestID: "req-123"}
+	assert.NoError(t, queue.Enqueue(context.Background(), job))
+
+	var body map[string]interface{}
+	json.Unmarshal([]byte(client.bodies(testQueueURL)[0]), &body)
+	assert.Equal(t, "job-1", body["jobId"])
+	assert.Equal(t, "acme", body["tenantId"])
+	assert.Equal(t, "uploads/acme/a1.mp4", body["s3Key"])
+
+	lease, err := dequeueSoon(t, queue, time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "job-1", lease.JobID)
+	assert.Equal(t, 1, lease.Deliveries)
+	assert.Equal(t, "req-123", lease.Attributes["requestId"])
+	assert.Zero(t, client.visible(testQueueURL))
+
+	assert.NoError(t, queue.Nack(context.Background(), lease, 0))
+	assert.Equal(t, 1, client.visible(testQueueURL))
+
+	lease, _ = dequeueSoon(t, queue, time.Minute)
+	assert.Equal(t, 2, lease.Deliveries)
+	assert.NoError(t, queue.Ack(context.Background(), lease))
+	assert.Empty(t, client.bodies(testQueueURL))
+}
+
+// TestSQSJobQueuePriorities tests that priorities map to their own queues and are received highest first
+func TestSQSJobQueuePriorities(t *testing.T) {
+	client := newFakeSQS()
+	queue := &sqsJobQueue{client: client, url: testQueueURL, priorityURLs: map[string]string{"high": testHighQueueURL}}
+	queue.Enqueue(context.Background(), &RenderJob{ID: "low-1", Priority: "low"})
+	queue.Enqueue(context.Background(), &RenderJob{ID: "high-1", Priority: "high"})
+
+	assert.Len(t, client.bodies(testHighQueueURL), 1)
+	assert.Len(t, client.bodies(testQueueURL), 1, "low shares the normal queue without SQS_QUEUE_URL_LOW")
+
+	lease, err := dequeueSoon(t, queue, time.Minute)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "high-1", lease.JobID)
+		assert.Equal(t, "high", lease.Priority)
+		assert.NoError(t, queue.Ack(context.Background(), lease))
+	}
+	assert.Empty(t, client.bodies(testHighQueueURL))
+
+	lease, err = dequeueSoon(t, queue, time.Minute)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "low-1", lease.JobID)
+	}
+}
+
+// TestSQSJobQueueScheduled tests that jobs due after the longest SQS delay are sent again until due
+func TestSQSJobQueueScheduled(t *testing.T) {
+	client := newFakeSQS()
+	queue := testSQSQueue(client)
+	scheduledAt := time.Now().Add(time.Hour)
+	assert.NoError(t, queue.Enqueue(context.Background(), &RenderJob{ID: "job-1", ScheduledAt: &scheduledAt}))
+	assert.Equal(t, int64(900), client.lastDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := queue.Dequeue(ctx, time.Minute)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, client.bodies(testQueueURL), 1, "the original is replaced by its postponed copy")
+	assert.Zero(t, client.visible(testQueueURL))
+	assert.Equal(t, int64(900), client.lastDelay)
+}
+
+// TestSQSJobQueueSkipsMalformed tests that messages without a job stay on the queue for its redrive policy
+func TestSQSJobQueueSkipsMalformed(t *testing.T) {
+	client := newFakeSQS()
+	client.add(testQueueURL, `{"style":"bottom"}`, nil)
+	queue := testSQSQueue(client)
+	queueJob(t, client, &RenderJob{ID: "job-1"})
+
+	lease, err := dequeueSoon(t, queue, time.Minute)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "job-1", lease.JobID)
+	}
+	assert.Len(t, client.bodies(testQueueURL), 2)
+}
+
+// TestLoadQueueConfig tests queue defaults, the SQS fallback and validation
+func TestLoadQueueConfig(t *testing.T) {
+	cfg, err := loadQueueConfig(mapSource(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, QueueConfig{
+		Backend:          "memory",
+		Capacity:         1000,
+		MaxDeliveries:    3,
+		RedisStream:      "render-jobs",
+		RedisGroup:       "render-workers",
+		DefaultPriority:  "normal",
+		TenantPriorities: map[string]string{},
+	}, cfg)
+
+	cfg, err = loadQueueConfig(mapSource(map[string]string{"SQS_QUEUE_URL": testQueueURL}))
+	assert.NoError(t, err)
+	assert.Equal(t, "sqs", cfg.Backend)
+
+	cfg, err = loadQueueConfig(mapSource(map[string]string{
+		"SQS_QUEUE_URL":           testQueueURL,
+		"QUEUE_BACKEND":           "redis",
+		"REDIS_URL":               "redis://cache:6379/2",
+		"QUEUE_MAX_DELIVERIES":    "5",
+		"RENDER_PRIORITY_DEFAULT": "low",
+		"RENDER_PRIORITY_TENANTS": "acme=high, globex = normal",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "redis", cfg.Backend)
+	assert.Equal(t, 5, cfg.MaxDeliveries)
+	assert.Equal(t, "high", cfg.priorityFor("acme", ""))
+	assert.Equal(t, "normal", cfg.priorityFor("globex", ""))
+	assert.Equal(t, "low", cfg.priorityFor("initech", ""))
+	assert.Equal(t, "high", cfg.priorityFor("initech", "high"))
+	assert.Equal(t, "acme=high,globex=normal", cfg.tenantPriorityList())
+
+	_, err = loadQueueConfig(mapSource(map[string]string{
+		"QUEUE_BACKEND":           "kafka",
+		"QUEUE_CAPACITY":          "0",
+		"REDIS_URL":               "cache:6379",
+		"RENDER_PRIORITY_DEFAULT": "urgent",
+		"RENDER_PRIORITY_TENANTS": "acme",
+	}))
+	assert.EqualError(t, err, "invalid QUEUE_BACKEND \"kafka\", expected memory, sqs or redis\n"+
+		"invalid QUEUE_CAPACITY \"0\", expected a positive integer\n"+
+		"invalid REDIS_URL, expected redis://[user:password@]host:port[/db]\n"+
+		"invalid RENDER_PRIORITY_DEFAULT \"urgent\", expected high, normal or low\n"+
+		"invalid RENDER_PRIORITY_TENANTS entry \"acme\", expected tenant=high, normal or low")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit allows Burst requests per Period, refilled continuously
+type RateLimit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// rate is the refill rate in tokens per second
+func (l RateLimit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// parseRateLimit parses "<count>/<s|m|h>", e.g. "10/m" for 10 requests per minute
+func parseRateLimit(raw string) (RateLimit, error) {
+	count, unit, ok := strings.Cut(raw, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("expected <count>/<s|m|h>")
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid count %q", count)
+	}
+	var period time.Duration
+	switch unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return RateLimit{}, fmt.Errorf("invalid unit %q", unit)
+	}
+	return RateLimit{Burst: n, Period: period}, nil
+}
+
+// String formats the limit as parsed by parseRateLimit, "off" when disabled
+func (l *RateLimit) String() string {
+	if l == nil {
+		return "off"
+	}
+	unit := "s"
+	switch l.Period {
+	case time.Minute:
+		unit = "m"
+	case time.Hour:
+		unit = "h"
+	}
+	return fmt.Sprintf("%d/%s", l.Burst, unit)
+}
+
+// loadRateLimit reads a limit from env, using fallback when unset. "off" disables it.
+func loadRateLimit(getenv configSource, env, fallback string) (*RateLimit, error) {
+	raw := getenv(env)
+	if raw == "" {
+		raw = fallback
+	}
+	if raw == "off" {
+		return nil, nil
+	}
+	limit, err := parseRateLimit(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", env, raw, err)
+	}
+	return &limit, nil
+}
+
+// tokenBucket is a single caller's bucket
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds one token bucket per caller for a single endpoint
+type rateLimiter struct {
+	limit     RateLimit
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{limit: limit, buckets: make(map[string]*tokenBucket), now: time.Now, lastSweep: time.Now()}
+}
+
+// evictIdle drops buckets unused for a full period, which have refilled and are the
+// same as a new bucket. It runs at most once a period so allow stays cheap.
+func (l *rateLimiter) evictIdle(now time.Time) {
+	if now.Sub(l.lastSweep) < l.limit.Period {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= l.limit.Period {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// allow takes a token for key, returning how long to wait when none is left
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.evictIdle(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(float64(l.limit.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*l.limit.rate())
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.limit.rate() * float64(time.Second))
+	return false, wait
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds for the Retry-After header
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// rateLimit limits requests per API key (or per tenant for JWTs) on one endpoint.
+// A nil limit disables limiting.
+func rateLimit(limit *RateLimit) gin.HandlerFunc {
+	if limit == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	limiter := newRateLimiter(*limit)
+	return func(c *gin.Context) {
+		key := c.GetString(principalContextKey)
+		if key == "" {
+			key = "ip:" + c.ClientIP()
+		}
+		if ok, wait := limiter.allow(key); !ok {
+			c.Header("Retry-After", retryAfterSeconds(wait))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimits are the per-endpoint limits applied to each API key
+type RateLimits struct {
+	Upload     *RateLimit
+	Transcribe *RateLimit
+	Render     *RateLimit
+}
+
+// loadRateLimits reads RATE_LIMIT_UPLOAD, RATE_LIMIT_TRANSCRIBE and RATE_LIMIT_RENDER
+func loadRateLimits(getenv configSource) (RateLimits, error) {
+	var limits RateLimits
+	var err error
+	if limits.Upload, err = loadRateLimit(getenv, "RATE_LIMIT_UPLOAD", "30/m"); err != nil {
+		return limits, err
+	}
+	if limits.Transcribe, err = loadRateLimit(getenv, "RATE_LIMIT_TRANSCRIBE", "10/m"); err != nil {
+		return limits, err
+	}
+	if limits.Render, err = loadRateLimit(getenv, "RATE_LIMIT_RENDER", "10/m"); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseRateLimit tests the <count>/<unit> limit format
+func TestParseRateLimit(t *testing.T) {
+	limit, err := parseRateLimit("10/m")
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimit{Burst: 10, Period: time.Minute}, limit)
+
+	for _, raw := range []string{"10", "0/m", "ten/m", "10/d"} {
+		_, err := parseRateLimit(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+// TestRateLimiterRefill tests that buckets drain and refill over time
+func TestRateLimiterRefill(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(RateLimit{Burst: 2, Period: time.Minute})
+	limiter.now = func() time.Time { return now }
+
+	ok, _ := limiter.allow("key-a")
+	assert.True(t, ok)
+	ok, _ = limiter.allow("key-a")
+	assert.True(t, ok)
+	ok, wait := limiter.allow("key-a")
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+
+	ok, _ = limiter.allow("key-b")
+	assert.True(t, ok, "buckets are per key")
+
+	now = now.Add(30 * time.Second)
+	ok, _ = limiter.allow("key-a")
+	assert.True(t, ok)
+}
+
+// TestRateLimiterEvictsIdleBuckets tests that callers idle for a period stop taking memory
+func TestRateLimiterEvictsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(RateLimit{Burst: 2, Period: time.Minute})
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+
+	limiter.allow("ip:10.0.0.1")
+	limiter.allow("ip:10.0.0.2")
+	now = now.Add(30 * time.Second)
+	limiter.allow("ip:10.0.0.2")
+	assert.Len(t, limiter.buckets, 2)
+
+	now = now.Add(40 * time.Second)
+	limiter.allow("ip:10.0.0.3")
+	assert.Len(t, limiter.buckets, 2, "the caller idle for a full period is dropped")
+	assert.NotContains(t, limiter.buckets, "ip:10.0.0.1")
+}
+
+// TestRateLimitMiddleware tests the 429 response with Retry-After
+func TestRateLimitMiddleware(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.RateLimits.Upload = &RateLimit{Burst: 1, Period: time.Hour}
+	})
+	key := ts.apiKey("acme")
+
+	w := ts.upload(key, "video", "talk.mp4", testVideo())
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = ts.upload(key, "video", "talk.mp4", testVideo())
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	w = ts.upload(ts.apiKey("globex"), "video", "talk.mp4", testVideo())
+	assert.Equal(t, http.StatusOK, w.Code, "limits are per key")
+}
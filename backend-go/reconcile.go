@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ReconcilePolicy decides what happens at startup to jobs a previous process left unfinished
+type ReconcilePolicy struct {
+	Lease    time.Duration // pending/processing jobs not updated for longer are stale
+	Resubmit bool          // resubmit stale jobs instead of failing them
+	Durable  bool          // the queue outlives the process, so every unfinished job is still in it
+}
+
+// loadReconcilePolicy reads JOB_LEASE and RECONCILE_STALE_JOBS (resubmit or fail)
+func loadReconcilePolicy(getenv configSource) (ReconcilePolicy, error) {
+	policy := ReconcilePolicy{Lease: 30 * time.Minute, Resubmit: true}
+
+	if raw := getenv("JOB_LEASE"); raw != "" {
+		lease, err := time.ParseDuration(raw)
+		if err != nil || lease <= 0 {
+			return policy, fmt.Errorf("invalid JOB_LEASE %q", raw)
+		}
+		policy.Lease = lease
+	}
+
+	switch raw := getenv("RECONCILE_STALE_JOBS"); raw {
+	case "", "resubmit":
+	case "fail":
+		policy.Resubmit = false
+	default:
+		return policy, fmt.Errorf("invalid RECONCILE_STALE_JOBS %q, expected resubmit or fail", raw)
+	}
+	return policy, nil
+}
+
+// action names the policy's handling of stale jobs as configured
+func (p ReconcilePolicy) action() string {
+	if p.Resubmit {
+		return "resubmit"
+	}
+	return "fail"
+}
+
+// staleReason explains why job counts as abandoned, or returns "" if it may still be running
+func (p ReconcilePolicy) staleReason(job *RenderJob, now time.Time) string {
+	// Waiting in the backlog, leased by a worker or nacked back at shutdown, the queue
+	// delivers them again
+	if p.Durable {
+		return ""
+	}
+	if job.Status == "requeueable" {
+		return "interrupted by server shutdown"
+	}
+	// Scheduled jobs are only overdue once their time has come
+	since := job.UpdatedAt
+	if job.ScheduledAt != nil && job.ScheduledAt.After(since) {
+		since = *job.ScheduledAt
+	}
+	if now.Sub(since) > p.Lease {
+		return fmt.Sprintf("%s for over %s", job.Status, p.Lease)
+	}
+	return ""
+}
+
+// reconcileJobs resubmits or fails jobs left pending, processing or requeueable by a previous
+// process. Jobs updated within the lease may still be running elsewhere and are left alone.
+func reconcileJobs(jobs JobStore, queue JobQueue, policy ReconcilePolicy, now time.Time) (resubmitted, failed int, err error) {
+	candidates, err := jobs.ListByStatus("pending", "processing", "requeueable")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list unfinished jobs: %v", err)
+	}
+
+	for _, job := range candidates {
+		reason := policy.staleReason(job, now)
+		if reason == "" {
+			continue
+		}
+
+		if policy.Resubmit {
+			job.Status = "pending"
+			job.Error = ""
+			job.enterStage(stageQueued, now)
+			job.UpdatedAt = now
+			if err := jobs.Put(job); err != nil {
+				slog.Error("Failed to resubmit stale job", "job_id", job.ID, "error", err)
+				continue
+			}
+			err := queue.Enqueue(context.Background(), job)
+			if err == nil {
+				slog.Info("Resubmitted stale job", "job_id", job.ID, "reason", reason)
+				resubmitted++
+				continue
+			}
+			reason = fmt.Sprintf("%s, resubmit failed: %v", reason, err)
+		}
+
+		job.Status = "failed"
+		job.Error = fmt.Sprintf("Job abandoned after a server restart: %s", reason)
+		job.UpdatedAt = now
+		if err := jobs.Put(job); err != nil {
+			slog.Error("Failed to mark stale job failed", "job_id", job.ID, "error", err)
+			continue
+		}
+		slog.Warn("Marked stale job failed", "job_id", job.ID, "reason", reason)
+		failed++
+	}
+	return resubmitted, failed, nil
+}
+
+// startJobReconciler reconciles stale jobs in the background so startup is not delayed
+func startJobReconciler(deps Deps, policy ReconcilePolicy) {
+	go func() {
+		resubmitted, failed, err := reconcileJobs(deps.Jobs, deps.Queue, policy, time.Now())
+		if err != nil {
+			slog.Error("Job reconciliation failed", "error", err)
+			return
+		}
+		if resubmitted > 0 || failed > 0 {
+			slog.Info("Job reconciliation finished", "resubmitted", resubmitted, "failed", failed)
+		}
+	}()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoadReconcilePolicy tests the lease and stale job action settings
+func TestLoadReconcilePolicy(t *testing.T) {
+	policy, err := loadReconcilePolicy(mapSource(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, policy.Lease)
+	assert.True(t, policy.Resubmit)
+
+	policy, err = loadReconcilePolicy(mapSource(map[string]string{"JOB_LEASE": "2h", "RECONCILE_STALE_JOBS": "fail"}))
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, policy.Lease)
+	assert.False(t, policy.Resubmit)
+
+	_, err = loadReconcilePolicy(mapSource(map[string]string{"RECONCILE_STALE_JOBS": "ignore"}))
+	assert.Error(t, err)
+}
+
+// seedUnfinishedJobs stores one job per reconciliation case
+func seedUnfinishedJobs(now time.Time) *memoryJobStore {
+	jobs := newMemoryJobStore()
+	jobs.Put(&RenderJob{ID: "fresh", Status: "processing", UpdatedAt: now.Add(-time.Minute)})
+	jobs.Put(&RenderJob{ID: "stale-pending", Status: "pending", UpdatedAt: now.Add(-2 * time.Hour)})
+	jobs.Put(&RenderJob{ID: "stale-processing", Status: "processing", UpdatedAt: now.Add(-2 * time.Hour)})
+	jobs.Put(&RenderJob{ID: "interrupted", Status: "requeueable", UpdatedAt: now.Add(-time.Minute), Error: "Render interrupted by server shutdown"})
+	jobs.Put(&RenderJob{ID: "done", Status: "completed", UpdatedAt: now.Add(-2 * time.Hour)})
+	scheduledAt := now.Add(time.Hour)
+	jobs.Put(&RenderJob{ID: "scheduled", Status: "pending", UpdatedAt: now.Add(-2 * time.Hour), ScheduledAt: &scheduledAt})
+	return jobs
+}
+
+// TestReconcileJobsResubmit tests that stale and interrupted jobs are queued again
+func TestReconcileJobsResubmit(t *testing.T) {
+	now := time.Now()
+	jobs := seedUnfinishedJobs(now)
+	queue := &fakeQueue{}
+
+	resubmitted, failed, err := reconcileJobs(jobs, queue, ReconcilePolicy{Lease: time.Hour, Resubmit: true}, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, resubmitted)
+	assert.Equal(t, 0, failed)
+	assert.ElementsMatch(t, []string{"stale-pending", "stale-processing", "interrupted"}, queue.jobIDs)
+
+	job, _ := jobs.Get("interrupted")
+	assert.Equal(t, "pending", job.Status)
+	assert.Empty(t, job.Error)
+	job, _ = jobs.Get("fresh")
+	assert.Equal(t, "processing", job.Status, "jobs within the lease may still be running")
+	job, _ = jobs.Get("scheduled")
+	assert.Equal(t, "pending", job.Status, "scheduled jobs are not due yet")
+}
+
+// TestReconcileJobsDurableQueue tests that no job is resubmitted when the queue kept them
+// all across the restart
+func TestReconcileJobsDurableQueue(t *testing.T) {
+	now := time.Now()
+	jobs := seedUnfinishedJobs(now)
+	queue := &fakeQueue{}
+
+	resubmitted, failed, err := reconcileJobs(jobs, queue, ReconcilePolicy{Lease: time.Hour, Resubmit: true, Durable: true}, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, resubmitted)
+	assert.Equal(t, 0, failed)
+	assert.Empty(t, queue.jobIDs, "a second copy would be rendered twice")
+	job, _ := jobs.Get("stale-pending")
+	assert.Equal(t, "pending", job.Status)
+	job, _ = jobs.Get("interrupted")
+	assert.Equal(t, "requeueable", job.Status)
+}
+
+// TestReconcileJobsFail tests that stale jobs are failed with a reason
+func TestReconcileJobsFail(t *testing.T) {
+	now := time.Now()
+	jobs := seedUnfinishedJobs(now)
+	queue := &fakeQueue{}
+
+	resubmitted, failed, err := reconcileJobs(jobs, queue, ReconcilePolicy{Lease: time.Hour}, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, resubmitted)
+	assert.Equal(t, 3, failed)
+	assert.Empty(t, queue.jobIDs)
+
+	job, _ := jobs.Get("stale-processing")
+	assert.Equal(t, "failed", job.Status)
+	assert.Equal(t, "Job abandoned after a server restart: processing for over 1h0m0s", job.Error)
+	job, _ = jobs.Get("done")
+	assert.Equal(t, "completed", job.Status)
+}
+
+// TestReconcileJobsQueueClosed tests that jobs which cannot be resubmitted are failed
+func TestReconcileJobsQueueClosed(t *testing.T) {
+	now := time.Now()
+	jobs := newMemoryJobStore()
+	jobs.Put(&RenderJob{ID: "stale", Status: "pending", UpdatedAt: now.Add(-2 * time.Hour)})
+	queue := &fakeQueue{closed: true}
+
+	_, failed, err := reconcileJobs(jobs, queue, ReconcilePolicy{Lease: time.Hour, Resubmit: true}, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failed)
+	job, _ := jobs.Get("stale")
+	assert.Equal(t, "failed", job.Status)
+	assert.Contains(t, job.Error, "resubmit failed: job queue is closed")
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redisBlock is how long one read waits for new entries before delayed and
+// expired jobs are checked again
+const redisBlock = 2 * time.Second
+
+// promoteScript moves a due delayed entry onto the stream in one step, so a failed add
+// cannot lose it and consumers promoting at the same time cannot both add it.
+// ARGV is the delayed set member followed by the entry's fields and values.
+var promoteScript = redis.NewScript(`
+if not redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call("XADD", KEYS[2], "*", unpack(ARGV, 2))
+redis.call("ZREM", KEYS[1], ARGV[1])
+return 1
+`)
+
+// redisJobQueue queues jobs in a Redis stream read by a consumer group. A lease is a
+// pending entry; one left idle past its lease is claimed by the next Dequeue. Nacked
+// and scheduled jobs wait in a sorted set scored by when they are due, and jobs
+// delivered more than maxDeliveries times are moved to the "<stream>:dead" stream.
+// Entries are read in order regardless of priority.
+type redisJobQueue struct {
+	client        *redis.Client
+	stream        string
+	group         string
+	consumer      string
+	maxDeliveries int
+}
+
+// newRedisJobQueue connects to cfg.RedisURL and creates the consumer group if needed
+func newRedisJobQueue(ctx context.Context, cfg QueueConfig) (*redisJobQueue, error) {
+	options, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse REDIS_URL: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	q := &redisJobQueue{
+		client:        redis.NewClient(options),
+		stream:        cfg.RedisStream,
+		group:         cfg.RedisGroup,
+		consumer:      fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		maxDeliveries: cfg.MaxDeliveries,
+	}
+	err = q.client.XGroupCreateMkStream(ctx, q.stream, q.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		q.client.Close()
+		return nil, fmt.Errorf("failed to create consumer group %s: %v", q.group, err)
+	}
+	return q, nil
+}
+
+// delayedKey holds nacked entries until they are due
+func (q *redisJobQueue) delayedKey() string {
+	return q.stream + ":delayed"
+}
+
+// deadKey holds entries that were delivered too often
+func (q *redisJobQueue) deadKey() string {
+	return q.stream + ":dead"
+}
+
+// Enqueue adds job to the stream
+func (q *redisJobQueue) Enqueue(ctx context.Context, job *RenderJob) error {
+	ctx, span := tracer().Start(ctx, "redis.XADD", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("render.job_id", job.ID)))
+
+	values := map[string]interface{}{"body": jobMessage(job), "deliveries": 0}
+	for key, value := range jobAttributes(ctx, job) {
+		values["attr."+key] = value
+	}
+	var err error
+	if job.ScheduledAt != nil && job.ScheduledAt.After(time.Now()) {
+		err = q.delay(ctx, values, *job.ScheduledAt)
+	} else {
+		err = q.add(ctx, values)
+	}
+	endSpan(span, err)
+	return err
+}
+
+func (q *redisJobQueue) add(ctx context.Context, values map[string]interface{}) error {
+	err := q.client.XAdd(ctx, &redis.XAddArgs{Stream: q.stream, Values: values}).Err()
+	if errors.Is(err, redis.ErrClosed) {
+		return errQueueClosed
+	}
+	return err
+}
+
+// Dequeue waits for an entry, preferring due nacked jobs and leases that ran out
+func (q *redisJobQueue) Dequeue(ctx context.Context, leaseFor time.Duration) (*Lease, error) {
+	for {
+		if err := q.promoteDelayed(ctx, time.Now()); err != nil {
+			return nil, q.dequeueError(ctx, err)
+		}
+
+		claimed, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   q.stream,
+			Group:    q.group,
+			Consumer: q.consumer,
+			MinIdle:  leaseFor,
+			Start:    "0",
+			Count:    1,
+		}).Result()
+		if err != nil {
+			return nil, q.dequeueError(ctx, err)
+		}
+		messages := claimed
+		if len(messages) == 0 {
+			streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    q.group,
+				Consumer: q.consumer,
+				Streams:  []string{q.stream, ">"},
+				Count:    1,
+				Block:    redisBlock,
+			}).Result()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return nil, q.dequeueError(ctx, err)
+			}
+			for _, stream := range streams {
+				messages = append(messages, stream.Messages...)
+			}
+		}
+
+		for _, msg := range messages {
+			lease, err := q.lease(ctx, msg)
+			if err != nil {
+				return nil, q.dequeueError(ctx, err)
+			}
+			if lease != nil {
+				return lease, nil
+			}
+		}
+	}
+}
+
+// dequeueError reports cancellation and a closed client the way callers of Dequeue expect
+func (q *redisJobQueue) dequeueError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, redis.ErrClosed) {
+		return errQueueClosed
+	}
+	return err
+}
+
+// lease turns a delivered entry into a Lease. Entries without a job or past
+// maxDeliveries are moved to the dead stream and nil is returned.
+func (q *redisJobQueue) lease(ctx context.Context, msg redis.XMessage) (*Lease, error) {
+	lease := &Lease{Attributes: map[string]string{}, handle: msg.ID}
+	body, _ := msg.Values["body"].(string)
+	queued := parseJobMessage(body)
+	lease.JobID, lease.Priority = queued.JobID, queued.Priority
+	previous, _ := msg.Values["deliveries"].(string)
+	lease.Deliveries, _ = strconv.Atoi(previous)
+	for key, value := range msg.Values {
+		if name, ok := strings.CutPrefix(key, "attr."); ok {
+			lease.Attributes[name], _ = value.(string)
+		}
+	}
+
+	// Deliveries of this entry, earlier ones happened before it was nacked
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: q.stream,
+		Group:  q.group,
+		Start:  msg.ID,
+		End:    msg.ID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 {
+		lease.Deliveries += int(pending[0].RetryCount)
+	}
+
+	switch {
+	case lease.JobID == "":
+		loggerFrom(ctx).Error("Render entry has no job ID", "entry_id", msg.ID)
+	case lease.Deliveries > q.maxDeliveries:
+		loggerFrom(ctx).Error("Render job dead-lettered after too many deliveries", "job_id", lease.JobID, "deliveries", lease.Deliveries-1)
+	default:
+		return lease, nil
+	}
+	if err := q.client.XAdd(ctx, &redis.XAddArgs{Stream: q.deadKey(), Values: msg.Values}).Err(); err != nil {
+		return nil, err
+	}
+	return nil, q.remove(ctx, msg.ID)
+}
+
+// promoteDelayed moves nacked jobs that are due back onto the stream
+func (q *redisJobQueue) promoteDelayed(ctx context.Context, now time.Time) error {
+	due, err := q.client.ZRangeByScore(ctx, q.delayedKey(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, member := range due {
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(member), &values); err != nil || len(values) == 0 {
+			loggerFrom(ctx).Error("Dropping unreadable delayed render entry", "error", err)
+			if err := q.client.ZRem(ctx, q.delayedKey(), member).Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		args := []interface{}{member}
+		for key, value := range values {
+			args = append(args, key, value)
+		}
+		if err := promoteScript.Run(ctx, q.client, []string{q.delayedKey(), q.stream}, args...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extend resets the entry's idle time so it isn't claimed for another leaseFor
+func (q *redisJobQueue) Extend(ctx context.Context, lease *Lease, leaseFor time.Duration) error {
+	claimed, err := q.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   q.stream,
+		Group:    q.group,
+		Consumer: q.consumer,
+		Messages: []string{lease.handle},
+	}).Result()
+	if err != nil {
+		return err
+	}
+	if len(claimed) == 0 {
+		return errLeaseExpired
+	}
+	return nil
+}
+
+// Ack removes the entry
+func (q *redisJobQueue) Ack(ctx context.Context, lease *Lease) error {
+	return q.remove(ctx, lease.handle)
+}
+
+// Nack replaces the entry with a copy that is delivered again after delay
+func (q *redisJobQueue) Nack(ctx context.Context, lease *Lease, delay time.Duration) error {
+	values := map[string]interface{}{"deliveries": strconv.Itoa(lease.Deliveries)}
+	entries, err := q.client.XRange(ctx, q.stream, lease.handle, lease.handle).Result()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errLeaseExpired
+	}
+	for key, value := range entries[0].Values {
+		if key != "deliveries" {
+			values[key] = value
+		}
+	}
+
+	if delay <= 0 {
+		err = q.add(ctx, values)
+	} else {
+		err = q.delay(ctx, values, time.Now().Add(delay))
+	}
+	if err != nil {
+		return err
+	}
+	return q.remove(ctx, lease.handle)
+}
+
+// delay holds an entry in the delayed set until due
+func (q *redisJobQueue) delay(ctx context.Context, values map[string]interface{}, due time.Time) error {
+	member, _ := json.Marshal(values)
+	err := q.client.ZAdd(ctx, q.delayedKey(), redis.Z{Score: float64(due.UnixMilli()), Member: string(member)}).Err()
+	if errors.Is(err, redis.ErrClosed) {
+		return errQueueClosed
+	}
+	return err
+}
+
+// remove acks and deletes an entry so the stream only holds unfinished jobs
+func (q *redisJobQueue) remove(ctx context.Context, id string) error {
+	if err := q.client.XAck(ctx, q.stream, q.group, id).Err(); err != nil {
+		return err
+	}
+	return q.client.XDel(ctx, q.stream, id).Err()
+}
+
+// Depth reports the jobs waiting, running or waiting out a nack delay
+func (q *redisJobQueue) Depth() (int, error) {
+	ctx := context.Background()
+	queued, err := q.client.XLen(ctx, q.stream).Result()
+	if err != nil {
+		return 0, err
+	}
+	delayed, err := q.client.ZCard(ctx, q.delayedKey()).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(queued + delayed), nil
+}
+
+// Ping checks that Redis is reachable
+func (q *redisJobQueue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
+}
+
+// Close disconnects, queued entries outlive this process
+func (q *redisJobQueue) Close(ctx context.Context) error {
+	return q.client.Close()
+}
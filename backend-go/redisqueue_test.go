@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRedisQueue returns a queue on a fresh in-memory Redis
+func newTestRedisQueue(t *testing.T, maxDeliveries int) (*redisJobQueue, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	queue, err := newRedisJobQueue(context.Background(), QueueConfig{
+		RedisURL:      "redis://" + server.Addr(),
+		RedisStream:   "render-jobs",
+		RedisGroup:    "render-workers",
+		MaxDeliveries: maxDeliveries,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { queue.Close(context.Background()) })
+	return queue, server
+}
+
+// TestRedisJobQueue tests that enqueued jobs are leased with their attributes and removed by Ack
+func TestRedisJobQueue(t *testing.T) {
+	queue, _ := newTestRedisQueue(t, 3)
+	assert.NoError(t, queue.Enqueue(context.Background(), &RenderJob{ID: "job-1", RequestID: "req-123"}))
+
+	lease, err := dequeueSoon(t, queue, time.Minute)
+
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", lease.JobID)
+	assert.Equal(t, 1, lease.Deliveries)
+	assert.Equal(t, "req-123", lease.Attributes["requestId"])
+	assert.NoError(t, queue.Extend(context.Background(), lease, time.Minute))
+
+	assert.NoError(t, queue.Ack(context.Background(), lease))
+	depth, _ := queue.Depth()
+	assert.Equal(t, 0, depth)
+}
+
+// TestRedisJobQueueNack tests that nacked jobs wait out their delay and keep their delivery count
+func TestRedisJobQueueNack(t *testing.T) {
+	queue, _ := newTestRedisQueue(t, 3)
+	queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"})
+	lease, _ := dequeueSoon(t, queue, time.Minute)
+
+	assert.NoError(t, queue.Nack(context.Background(), lease, 50*time.Millisecond))
+	depth, _ := queue.Depth()
+	assert.Equal(t, 1, depth)
+
+	again, err := dequeueSoon(t, queue, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", again.JobID)
+	assert.Equal(t, 2, again.Deliveries)
+}
+
+// TestRedisJobQueueScheduled tests that scheduled jobs wait in the delayed set until due
+func TestRedisJobQueueScheduled(t *testing.T) {
+	queue, server := newTestRedisQueue(t, 3)
+	scheduledAt := time.Now().Add(100 * time.Millisecond)
+	assert.NoError(t, queue.Enqueue(context.Background(), &RenderJob{ID: "job-1", Priority: "low", ScheduledAt: &scheduledAt}))
+	members, _ := server.ZMembers("render-jobs:delayed")
+	assert.Len(t, members, 1)
+
+	lease, err := dequeueSoon(t, queue, time.Minute)
+
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", lease.JobID)
+	assert.Equal(t, "low", lease.Priority)
+	assert.Equal(t, 1, lease.Deliveries)
+	assert.False(t, time.Now().Before(scheduledAt))
+}
+
+// TestRedisJobQueuePromoteDelayed tests that a due entry is added to the stream once and
+// stays delayed when it cannot be added
+func TestRedisJobQueuePromoteDelayed(t *testing.T) {
+	queue, server := newTestRedisQueue(t, 3)
+	ctx := context.Background()
+	queue.Enqueue(ctx, &RenderJob{ID: "job-1"})
+	lease, _ := dequeueSoon(t, queue, time.Minute)
+	require.NoError(t, queue.Nack(ctx, lease, time.Minute))
+
+	// The stream cannot take entries
+	server.Del("render-jobs")
+	server.Set("render-jobs", "broken")
+	assert.Error(t, queue.promoteDelayed(ctx, time.Now().Add(time.Hour)))
+	members, _ := server.ZMembers("render-jobs:delayed")
+	assert.Len(t, members, 1)
+
+	server.Del("render-jobs")
+	assert.NoError(t, queue.promoteDelayed(ctx, time.Now().Add(time.Hour)))
+	assert.NoError(t, queue.promoteDelayed(ctx, time.Now().Add(time.Hour)))
+	entries, err := queue.client.XRange(ctx, "render-jobs", "-", "+").Result()
+	require.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "1", entries[0].Values["deliveries"])
+		assert.Equal(t, "job-1", parseJobMessage(entries[0].Values["body"].(string)).JobID)
+	}
+	assert.False(t, server.Exists("render-jobs:delayed"))
+}
+
+// TestRedisJobQueueLeaseExpiry tests that entries idle past their lease are claimed again
+func TestRedisJobQueueLeaseExpiry(t *testing.T) {
+	queue, _ := newTestRedisQueue(t, 3)
+	queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"})
+	dequeueSoon(t, queue, time.Minute)
+	time.Sleep(20 * time.Millisecond)
+
+	again, err := dequeueSoon(t, queue, 10*time.Millisecond)
+
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", again.JobID)
+	assert.Equal(t, 2, again.Deliveries)
+}
+
+// TestRedisJobQueueMaxDeliveries tests that a job delivered too often moves to the dead stream
+func TestRedisJobQueueMaxDeliveries(t *testing.T) {
+	queue, server := newTestRedisQueue(t, 1)
+	queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"})
+	lease, _ := dequeueSoon(t, queue, time.Minute)
+	queue.Nack(context.Background(), lease, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := queue.Dequeue(ctx, time.Minute)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	dead, _ := server.Stream("render-jobs:dead")
+	assert.Len(t, dead, 1)
+	depth, _ := queue.Depth()
+	assert.Equal(t, 0, depth)
+}
+
+// TestRedisJobQueueClose tests that a closed queue reports errQueueClosed
+func TestRedisJobQueueClose(t *testing.T) {
+	queue, _ := newTestRedisQueue(t, 3)
+
+	assert.NoError(t, queue.Close(context.Background()))
+
+	assert.ErrorIs(t, queue.Enqueue(context.Background(), &RenderJob{ID: "job-1"}), errQueueClosed)
+	_, err := queue.Dequeue(context.Background(), time.Minute)
+	assert.ErrorIs(t, err, errQueueClosed)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// remotionRequestTimeout bounds each submit and status call to Remotion, and how long a
+// download waits for Remotion to start sending the output
+const remotionRequestTimeout = 2 * time.Minute
+
+// RemotionConfig controls render timeouts, status polling, retries and the circuit breaker
+type RemotionConfig struct {
+	Timeout          time.Duration // how long a render may take from submission to completion
+	PollInterval     time.Duration // how often a submitted render's status is checked
+	CallbackURL      string        // backend base URL Remotion posts progress to, no callbacks when empty
+	MaxAttempts      int           // attempts per call, including the first
+	RetryBaseDelay   time.Duration // backoff before the second attempt, doubled after each
+	BreakerThreshold int           // consecutive transient failures that open the breaker
+	BreakerCooldown  time.Duration // how long the breaker stays open before a trial call
+}
+
+// loadRemotionConfig reads REMOTION_TIMEOUT, REMOTION_POLL_INTERVAL, RENDER_CALLBACK_URL,
+// REMOTION_MAX_ATTEMPTS, REMOTION_RETRY_BASE_DELAY, REMOTION_BREAKER_THRESHOLD and REMOTION_BREAKER_COOLDOWN
+func loadRemotionConfig(getenv configSource) (RemotionConfig, error) {
+	cfg := RemotionConfig{
+		Timeout:          10 * time.Minute,
+		PollInterval:     5 * time.Second,
+		CallbackURL:      strings.TrimRight(getenv("RENDER_CALLBACK_URL"), "/"),
+		MaxAttempts:      3,
+		RetryBaseDelay:   2 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+
+	var errs []error
+	durations := []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"REMOTION_TIMEOUT", &cfg.Timeout},
+		{"REMOTION_POLL_INTERVAL", &cfg.PollInterval},
+		{"REMOTION_RETRY_BASE_DELAY", &cfg.RetryBaseDelay},
+		{"REMOTION_BREAKER_COOLDOWN", &cfg.BreakerCooldown},
+	}
+	for _, d := range durations {
+		if raw := getenv(d.env); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil || parsed <= 0 {
+				errs = append(errs, fmt.Errorf("invalid %s %q", d.env, raw))
+				continue
+			}
+			*d.value = parsed
+		}
+	}
+	counts := []struct {
+		env   string
+		value *int
+	}{
+		{"REMOTION_MAX_ATTEMPTS", &cfg.MaxAttempts},
+		{"REMOTION_BREAKER_THRESHOLD", &cfg.BreakerThreshold},
+	}
+	for _, n := range counts {
+		if raw := getenv(n.env); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 {
+				errs = append(errs, fmt.Errorf("invalid %s %q, expected a positive integer", n.env, raw))
+				continue
+			}
+			*n.value = parsed
+		}
+	}
+	if cfg.CallbackURL != "" {
+		if u, err := url.Parse(cfg.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid RENDER_CALLBACK_URL %q, expected http(s)://host", cfg.CallbackURL))
+		}
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// errCircuitOpen is returned without calling Remotion while it is considered down
+var errCircuitOpen = errors.New("remotion unavailable: circuit breaker open after repeated failures")
+
+// RemotionError is a failed Remotion call. Transient errors (no response, 5xx, 429)
+// are retried; anything else means the request itself was rejected.
+type RemotionError struct {
+	StatusCode int // 0 when no response was received
+	Message    string
+	Transient  bool
+}
+
+func (e *RemotionError) Error() string {
+	switch {
+	case e.StatusCode == 0:
+		return "remotion unavailable: " + e.Message
+	case e.StatusCode >= 400 && e.StatusCode < 500:
+		return fmt.Sprintf("remotion rejected the request (%d): %s", e.StatusCode, e.Message)
+	case e.StatusCode >= 500:
+		return fmt.Sprintf("remotion error (%d): %s", e.StatusCode, e.Message)
+	}
+	return e.Message
+}
+
+// remotionClient calls the Remotion render service
+type remotionClient struct {
+	baseURL   string
+	apiKey    string
+	cfg       RemotionConfig
+	client    *http.Client
+	downloads *http.Client // no overall timeout, large outputs take a while to stream
+	breaker   *circuitBreaker
+}
+
+func newRemotionClient(baseURL, apiKey string, cfg RemotionConfig) *remotionClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = remotionRequestTimeout
+	return &remotionClient{
+		baseURL:   baseURL,
+		apiKey:    apiKey,
+		cfg:       cfg,
+		client:    &http.Client{Timeout: remotionRequestTimeout},
+		downloads: &http.Client{Transport: transport},
+		breaker:   &circuitBreaker{threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown, now: time.Now},
+	}
+}
+
+// RenderRequest is the body of POST /render
+type RenderRequest struct {
+	VideoURL    string    `json:"videoUrl"`
+	Captions    []Caption `json:"captions"`
+	Style       string    `json:"style"`
+	OutPath     string    `json:"outPath"`
+	Async       bool      `json:"async"`
+	CallbackURL string    `json:"callbackUrl,omitempty"`
+}
+
+// submitResponse is the body Remotion returns from an asynchronous POST /render
+type submitResponse struct {
+	Success  bool   `json:"success"`
+	RenderID string `json:"renderId"`
+	Error    string `json:"error"`
+}
+
+// RenderStatus is a submitted render as reported by GET /render/:id and progress callbacks
+type RenderStatus struct {
+	RenderID string `json:"renderId"`
+	Status   string `json:"status"` // rendering, completed, failed
+	Progress int    `json:"progress"`
+	OutPath  string `json:"outPath,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Submit starts rendering req in the background and returns its render ID
+func (c *remotionClient) Submit(ctx context.Context, req RenderRequest) (string, error) {
+	req.Async = true
+	body, _ := json.Marshal(req)
+	resp, err := c.do(ctx, c.client, func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/render", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("x-api-key", c.apiKey)
+		return httpReq, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result submitResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	if !result.Success || result.RenderID == "" {
+		message := result.Error
+		if message == "" {
+			message = "render was not accepted"
+		}
+		return "", &RemotionError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return result.RenderID, nil
+}
+
+// Status reports the progress of a submitted render
+func (c *remotionClient) Status(ctx context.Context, renderID string) (*RenderStatus, error) {
+	resp, err := c.do(ctx, c.client, func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/render/"+url.PathEscape(renderID), nil)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("x-api-key", c.apiKey)
+		return httpReq, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var status RenderStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, &RemotionError{StatusCode: resp.StatusCode, Message: "invalid render status", Transient: true}
+	}
+	return &status, nil
+}
+
+// Download opens a rendered file. The caller closes the returned body.
+func (c *remotionClient) Download(ctx context.Context, filename string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, c.downloads, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", c.baseURL+"/download/"+filename, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do sends the request built by newRequest with client, retrying transient failures with
+// jittered backoff. Non-2xx responses are returned as a *RemotionError with Remotion's message.
+func (c *remotionClient) do(ctx context.Context, client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt < c.cfg.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			loggerFrom(ctx).Warn("Retrying Remotion request", "attempt", attempt+1, "error", lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoffDelay(c.cfg.RetryBaseDelay, 30*time.Second, attempt-1)):
+			}
+		}
+		if !c.breaker.allow() {
+			return nil, errCircuitOpen
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			// Never reached Remotion
+			c.breaker.release()
+			return nil, fmt.Errorf("failed to create remotion request: %v", err)
+		}
+		if id := requestIDFrom(ctx); id != "" {
+			req.Header.Set(requestIDHeader, id)
+		}
+		injectTraceHeaders(ctx, req.Header)
+
+		resp, err := client.Do(req)
+		if ctx.Err() != nil {
+			// Shutting down or cancelled, not Remotion's fault
+			if resp != nil {
+				resp.Body.Close()
+			}
+			c.breaker.release()
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			lastErr = &RemotionError{Message: err.Error(), Transient: true}
+			c.breaker.failure()
+			continue
+		}
+		if resp.StatusCode < 300 {
+			c.breaker.success()
+			return resp, nil
+		}
+
+		remotionErr := &RemotionError{
+			StatusCode: resp.StatusCode,
+			Message:    errorMessage(resp),
+			Transient:  resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		}
+		if !remotionErr.Transient {
+			// Remotion is healthy, it rejected this request
+			c.breaker.success()
+			return nil, remotionErr
+		}
+		lastErr = remotionErr
+		c.breaker.failure()
+	}
+	if c.cfg.MaxAttempts > 1 {
+		return nil, fmt.Errorf("%w (gave up after %d attempts)", lastErr, c.cfg.MaxAttempts)
+	}
+	return nil, lastErr
+}
+
+// errorMessage reads Remotion's JSON {"error": ...} body, falling back to the status text
+func errorMessage(resp *http.Response) string {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var parsed struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error != "" {
+		return parsed.Error
+	}
+	return http.StatusText(resp.StatusCode)
+}
+
+// backoffDelay doubles base for each retry, capped at limit, and picks a random delay
+// in the upper half so that workers retrying together spread out
+func backoffDelay(base, limit time.Duration, retry int) time.Duration {
+	delay := base << retry
+	if delay > limit || delay <= 0 {
+		delay = limit
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// circuitBreaker stops calls after threshold consecutive failures. Once the cooldown
+// has passed it lets a single trial call through, closing again if it succeeds.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool // a trial call is in flight
+}
+
+// allow reports whether a call may be made now
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// success records a call that reached a healthy Remotion
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures, b.trial = 0, false
+	remotionCircuitOpen.Set(0)
+}
+
+// release gives back a trial call that ended without telling whether Remotion is healthy
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// failure records a transient failure, opening or reopening the breaker at the threshold
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+		remotionCircuitOpen.Set(1)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRemotionConfig retries quickly and opens the breaker after two failures
+var testRemotionConfig = RemotionConfig{
+	Timeout:          time.Second,
+	MaxAttempts:      3,
+	RetryBaseDelay:   time.Millisecond,
+	BreakerThreshold: 2,
+	BreakerCooldown:  time.Minute,
+}
+
+// scriptedRemotion answers successive /render calls with the given statuses and bodies
+func scriptedRemotion(t *testing.T, calls *int32, responses ...func(w http.ResponseWriter)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		respond := responses[len(responses)-1]
+		if int(n) <= len(responses) {
+			respond = responses[n-1]
+		}
+		respond(w)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func respondWith(status int, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+// TestRemotionClientRejected tests that 4xx errors carry Remotion's message and are not retried
+func TestRemotionClientRejected(t *testing.T) {
+	var calls int32
+	server := scriptedRemotion(t, &calls,
+		respondWith(http.StatusBadRequest, `{"success":false,"error":"Invalid style. Must be: bottom, top-bar, or karaoke"}`))
+	client := newRemotionClient(server.URL, "render-key", testRemotionConfig)
+
+	_, err := client.Submit(context.Background(), RenderRequest{Style: "neon"})
+
+	assert.EqualError(t, err, "remotion rejected the request (400): Invalid style. Must be: bottom, top-bar, or karaoke")
+	var remotionErr *RemotionError
+	assert.True(t, errors.As(err, &remotionErr))
+	assert.False(t, remotionErr.Transient)
+	assert.Equal(t, int32(1), calls)
+}
+
+// TestRemotionClientRetriesServerErrors tests that 5xx responses are retried until one succeeds
+func TestRemotionClientRetriesServerErrors(t *testing.T) {
+	var calls int32
+	server := scriptedRemotion(t, &calls,
+		respondWith(http.StatusInternalServerError, `{"success":false,"error":"Render process exited with code 1"}`),
+		respondWith(http.StatusOK, `{"success":true,"renderId":"render-1"}`))
+	client := newRemotionClient(server.URL, "render-key", testRemotionConfig)
+
+	renderID, err := client.Submit(context.Background(), RenderRequest{Style: "bottom"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "render-1", renderID)
+	assert.Equal(t, int32(2), calls)
+}
+
+// TestRemotionClientGivesUp tests that persistent 5xx responses fail with the last error
+func TestRemotionClientGivesUp(t *testing.T) {
+	var calls int32
+	server := scriptedRemotion(t, &calls,
+		respondWith(http.StatusBadGateway, `not json`))
+	cfg := testRemotionConfig
+	cfg.BreakerThreshold = 10
+	client := newRemotionClient(server.URL, "render-key", cfg)
+
+	_, err := client.Submit(context.Background(), RenderRequest{Style: "bottom"})
+
+	assert.EqualError(t, err, "remotion error (502): Bad Gateway (gave up after 3 attempts)")
+	assert.Equal(t, int32(3), calls)
+}
+
+// TestRemotionClientTimeout tests that a slow Remotion counts as a transient failure
+func TestRemotionClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	cfg := testRemotionConfig
+	cfg.MaxAttempts = 1
+	client := newRemotionClient(server.URL, "render-key", cfg)
+	client.client.Timeout = 20 * time.Millisecond
+
+	_, err := client.Submit(context.Background(), RenderRequest{Style: "bottom"})
+
+	var remotionErr *RemotionError
+	if assert.True(t, errors.As(err, &remotionErr)) {
+		assert.True(t, remotionErr.Transient)
+		assert.Equal(t, 0, remotionErr.StatusCode)
+	}
+}
+
+// TestRemotionClientSlowDownload tests that the request timeout does not cut off an
+// output that takes longer than it to stream
+func TestRemotionClientSlowDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("rendered "))
+		w.(http.Flusher).Flush()
+		time.Sleep(60 * time.Millisecond)
+		w.Write([]byte("video"))
+	}))
+	defer server.Close()
+	client := newRemotionClient(server.URL, "render-key", testRemotionConfig)
+	client.client.Timeout = 20 * time.Millisecond
+
+	body, err := client.Download(context.Background(), "video_job-1.mp4")
+	if assert.NoError(t, err) {
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		assert.Equal(t, "rendered video", string(data))
+	}
+}
+
+// TestRemotionCircuitBreaker tests that the breaker opens after repeated failures and
+// lets a trial call through after the cooldown
+func TestRemotionCircuitBreaker(t *testing.T) {
+	var calls int32
+	server := scriptedRemotion(t, &calls,
+		respondWith(http.StatusServiceUnavailable, `{"error":"busy"}`),
+		respondWith(http.StatusServiceUnavailable, `{"error":"busy"}`),
+		respondWith(http.StatusOK, `{"success":true,"renderId":"render-1"}`))
+	client := newRemotionClient(server.URL, "render-key", testRemotionConfig)
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	_, err := client.Submit(context.Background(), RenderRequest{Style: "bottom"})
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, int32(2), calls)
+
+	_, err = client.Submit(context.Background(), RenderRequest{Style: "bottom"})
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, int32(2), calls, "no calls while open")
+
+	now = now.Add(time.Minute)
+	renderID, err := client.Submit(context.Background(), RenderRequest{Style: "bottom"})
+	assert.NoError(t, err)
+	assert.Equal(t, "render-1", renderID)
+	assert.True(t, client.breaker.allow(), "closed after a successful trial")
+}
+
+// TestRemotionCircuitBreakerCancelledTrial tests that a trial call cancelled by the
+// caller frees the trial slot for the next call
+func TestRemotionCircuitBreakerCancelledTrial(t *testing.T) {
+	var calls int32
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			started <- struct{}{}
+			<-release
+			return
+		}
+		respondWith(http.StatusOK, `{"success":true,"renderId":"render-1"}`)(w)
+	}))
+	defer server.Close()
+	defer close(release)
+	client := newRemotionClient(server.URL, "render-key", testRemotionConfig)
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+	client.breaker.failure()
+	client.breaker.failure()
+	now = now.Add(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := client.Submit(ctx, RenderRequest{Style: "bottom"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	renderID, err := client.Submit(context.Background(), RenderRequest{Style: "bottom"})
+	assert.NoError(t, err)
+	assert.Equal(t, "render-1", renderID)
+	assert.Equal(t, int32(2), calls)
+}
+
+// TestRemotionCircuitBreakerUnbuiltTrial tests that a trial call whose request could not
+// be built neither counts as a failure nor keeps the trial slot
+func TestRemotionCircuitBreakerUnbuiltTrial(t *testing.T) {
+	client := newRemotionClient("http://[::1", "render-key", testRemotionConfig)
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+	client.breaker.failure()
+	client.breaker.failure()
+	now = now.Add(time.Minute)
+
+	_, err := client.Submit(context.Background(), RenderRequest{Style: "bottom"})
+	assert.ErrorContains(t, err, "failed to create remotion request")
+	assert.Equal(t, 2, client.breaker.failures)
+	assert.True(t, client.breaker.allow(), "the trial slot is free for the next call")
+}
+
+// TestRemotionClientStatus tests reading a render's status and that unknown renders are not retried
+func TestRemotionClientStatus(t *testing.T) {
+	var calls int32
+	server := scriptedRemotion(t, &calls,
+		respondWith(http.StatusOK, `{"renderId":"render-1","status":"rendering","progress":45}`),
+		respondWith(http.StatusNotFound, `{"success":false,"error":"Render not found"}`))
+	client := newRemotionClient(server.URL, "render-key", testRemotionConfig)
+
+	status, err := client.Status(context.Background(), "render-1")
+	assert.NoError(t, err)
+	assert.Equal(t, RenderStatus{RenderID: "render-1", Status: "rendering", Progress: 45}, *status)
+
+	_, err = client.Status(context.Background(), "render-1")
+	assert.EqualError(t, err, "remotion rejected the request (404): Render not found")
+	assert.Equal(t, int32(2), calls)
+}
+
+// TestBackoffDelay tests that retry delays grow, stay capped and keep jitter in the upper half
+func TestBackoffDelay(t *testing.T) {
+	for retry := 0; retry < 10; retry++ {
+		delay := backoffDelay(time.Second, 30*time.Second, retry)
+		full := time.Second << retry
+		if full > 30*time.Second {
+			full = 30 * time.Second
+		}
+		assert.GreaterOrEqual(t, delay, full/2)
+		assert.LessOrEqual(t, delay, full)
+	}
+}
+
+// TestLoadRemotionConfig tests Remotion client defaults and validation
+func TestLoadRemotionConfig(t *testing.T) {
+	cfg, err := loadRemotionConfig(mapSource(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.Timeout)
+	assert.Equal(t, 3, cfg.MaxAttempts)
+	assert.Equal(t, 5, cfg.BreakerThreshold)
+
+	cfg, err = loadRemotionConfig(mapSource(map[string]string{"REMOTION_MAX_ATTEMPTS": "1", "REMOTION_BREAKER_COOLDOWN": "1m"}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cfg.MaxAttempts)
+	assert.Equal(t, time.Minute, cfg.BreakerCooldown)
+
+	_, err = loadRemotionConfig(mapSource(map[string]string{"REMOTION_MAX_ATTEMPTS": "0", "REMOTION_TIMEOUT": "soon"}))
+	assert.EqualError(t, err, "invalid REMOTION_TIMEOUT \"soon\"\ninvalid REMOTION_MAX_ATTEMPTS \"0\", expected a positive integer")
+}
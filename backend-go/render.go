@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// renderWorker renders jobs with the Remotion service and stores the output
+type renderWorker struct {
+	cfg      *Config
+	storage  ObjectStorage
+	jobs     JobStore
+	remotion *remotionClient
+}
+
+func newRenderWorker(cfg *Config, deps Deps) *renderWorker {
+	return &renderWorker{
+		cfg:      cfg,
+		storage:  deps.Storage,
+		jobs:     deps.Jobs,
+		remotion: newRemotionClient(cfg.RemotionURL, cfg.RenderAPIKey, cfg.Remotion),
+	}
+}
+
+// RenderRetryPolicy decides how often a job is run again after a transient failure
+type RenderRetryPolicy struct {
+	MaxAttempts int           // runs per submission, including the first
+	BaseDelay   time.Duration // wait before the first retry, doubled after each
+	MaxDelay    time.Duration // longest wait between attempts
+}
+
+// loadRenderRetryPolicy reads RENDER_MAX_ATTEMPTS, RENDER_RETRY_BASE_DELAY and RENDER_RETRY_MAX_DELAY
+func loadRenderRetryPolicy(getenv configSource) (RenderRetryPolicy, error) {
+	policy := RenderRetryPolicy{MaxAttempts: 3, BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute}
+
+	if raw := getenv("RENDER_MAX_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			return policy, fmt.Errorf("invalid RENDER_MAX_ATTEMPTS %q, expected a positive integer", raw)
+		}
+		policy.MaxAttempts = attempts
+	}
+	for _, d := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"RENDER_RETRY_BASE_DELAY", &policy.BaseDelay},
+		{"RENDER_RETRY_MAX_DELAY", &policy.MaxDelay},
+	} {
+		if raw := getenv(d.env); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil || parsed <= 0 {
+				return policy, fmt.Errorf("invalid %s %q", d.env, raw)
+			}
+			*d.value = parsed
+		}
+	}
+	return policy, nil
+}
+
+// RenderAttempt records one run of a render job
+type RenderAttempt struct {
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+var (
+	// errRenderFailed is a render Remotion ran and gave up on, running it again would fail the same way
+	errRenderFailed = errors.New("render failed")
+	// errRenderLost is a render Remotion no longer knows about, usually after it restarted
+	errRenderLost = errors.New("render lost by remotion")
+)
+
+// renderFailure is a failed attempt with the step that failed, as shown on the job
+type renderFailure struct {
+	step string
+	err  error
+}
+
+func (f *renderFailure) Error() string { return f.step + ": " + f.err.Error() }
+func (f *renderFailure) Unwrap() error { return f.err }
+
+// isTransient reports whether a failed attempt may succeed if the job runs again.
+// Requests Remotion rejected and renders it ran and failed are permanent.
+func isTransient(err error) bool {
+	if errors.Is(err, errRenderLost) {
+		return true
+	}
+	if errors.Is(err, errRenderFailed) {
+		return false
+	}
+	var remotionErr *RemotionError
+	if errors.As(err, &remotionErr) {
+		return remotionErr.Transient
+	}
+	return true
+}
+
+// processRenderJob processes a render job asynchronously using ECS Fargate, retrying
+// transient failures with backoff. Cancelling ctx aborts the render and leaves the job requeueable.
+// The error is why the job did not complete, nil if it did.
+func (w *renderWorker) processRenderJob(ctx context.Context, jobID string) error {
+	job, err := w.jobs.Get(jobID)
+	if err != nil {
+		loggerFrom(ctx).Error("Job could not be loaded", "job_id", jobID, "error", err)
+		return err
+	}
+
+	// Logs and Remotion calls carry the ID of the request that created the job
+	ctx = withRequestID(ctx, job.RequestID)
+	logger := loggerFrom(ctx).With("job_id", jobID)
+
+	ctx, span := tracer().Start(ctx, "render.job", trace.WithAttributes(
+		attribute.String("render.job_id", jobID), attribute.String("render.style", job.Style)))
+	defer span.End()
+
+	policy := w.cfg.RenderRetry
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		outputURL, err := w.runAttempt(ctx, job)
+		observeRender := func(outcome string) {
+			renderDuration.WithLabelValues(styleLabel(job.Style), outcome).Observe(time.Since(started).Seconds())
+		}
+		if err != nil && ctx.Err() != nil {
+			observeRender("interrupted")
+			w.interrupt(job)
+			logger.Warn("Job interrupted by shutdown, marked requeueable")
+			return ctx.Err()
+		}
+		if err != nil && (!isTransient(err) || attempt >= policy.MaxAttempts) {
+			observeRender("failed")
+			span.SetStatus(codes.Error, "render failed")
+			w.fail(job, err.Error())
+			logger.Error("Job failed", "attempts", attempt, "error", err)
+			return err
+		}
+		if err != nil {
+			observeRender("retried")
+			delay := backoffDelay(policy.BaseDelay, policy.MaxDelay, attempt-1)
+			job.Status = "pending"
+			job.enterStage(stageQueued, time.Now())
+			w.save(job)
+			logger.Warn("Render attempt failed, retrying", "attempt", attempt, "delay", delay.String(), "error", err)
+
+			select {
+			case <-ctx.Done():
+				w.interrupt(job)
+				logger.Warn("Job interrupted by shutdown, marked requeueable")
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		observeRender("completed")
+		job.enterStage(stageFinalizing, time.Now())
+		job.Status = "completed"
+		job.Progress = 100
+		job.OutputURL = outputURL
+		w.save(job)
+		logger.Info("Job completed successfully", "attempts", attempt)
+		return nil
+	}
+}
+
+// runAttempt renders job once, recording the attempt on it, and returns the output URL
+func (w *renderWorker) runAttempt(ctx context.Context, job *RenderJob) (outputURL string, err error) {
+	job.Attempts = append(job.Attempts, RenderAttempt{StartedAt: time.Now()})
+	defer func() {
+		current := &job.Attempts[len(job.Attempts)-1]
+		ended := time.Now()
+		current.EndedAt = &ended
+		if ctx.Err() != nil {
+			current.Error = "interrupted by server shutdown"
+		} else if err != nil {
+			current.Error = err.Error()
+		}
+	}()
+
+	job.Status = "processing"
+	job.Error = ""
+	job.enterStage(stageFetchingVideo, time.Now())
+	w.save(job)
+
+	// Generate presigned URL for video access
+	videoURLForRender := job.VideoURL
+	if job.S3Key != "" {
+		presignedURL, err := w.storage.PresignGet(ctx, job.S3Key, 2*time.Hour)
+		if err != nil {
+			return "", &renderFailure{step: "Failed to generate presigned URL", err: err}
+		}
+		videoURLForRender = presignedURL
+	}
+
+	// Trigger ECS Fargate task for rendering
+	outputURL, err = w.triggerFargateRenderTask(ctx, job, videoURLForRender)
+	if err != nil {
+		return "", &renderFailure{step: "Failed to trigger render task", err: err}
+	}
+	return outputURL, nil
+}
+
+// fail marks a job failed with a reason
+func (w *renderWorker) fail(job *RenderJob, reason string) {
+	job.Status = "failed"
+	job.Error = reason
+	w.save(job)
+}
+
+// interrupt marks a job that stopped at shutdown so it can be submitted again
+func (w *renderWorker) interrupt(job *RenderJob) {
+	job.Status = "requeueable"
+	job.Error = "Render interrupted by server shutdown"
+	w.save(job)
+}
+
+// save stores the job's latest state, keeping progress callbacks reported for the
+// same render since the job was read
+func (w *renderWorker) save(job *RenderJob) {
+	if stored, err := w.jobs.Get(job.ID); err == nil && stored.RenderID == job.RenderID {
+		job.Progress = max(job.Progress, stored.Progress)
+	}
+	job.UpdatedAt = time.Now()
+	if err := w.jobs.Put(job); err != nil {
+		slog.Error("Failed to save job", "job_id", job.ID, "request_id", job.RequestID, "error", err)
+	}
+}
+
+// triggerFargateRenderTask renders via the Remotion service, uploads the result
+// and returns a download URL for it
+func (w *renderWorker) triggerFargateRenderTask(ctx context.Context, job *RenderJob, videoURL string) (_ string, err error) {
+	ctx, span := tracer().Start(ctx, "remotion.render", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+
+	outPath, err := w.awaitRender(ctx, job, videoURL)
+	if err != nil {
+		return "", err
+	}
+	job.enterStage(stageUploading, time.Now())
+	w.save(job)
+
+	download, err := w.remotion.Download(ctx, filepath.Base(outPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to download rendered video: %w", err)
+	}
+	defer download.Close()
+
+	s3Key := renderOutputKey(job)
+	s3URL, err := w.storage.Put(ctx, s3Key, "video/mp4", download, nil)
+	if err != nil {
+		return "", err
+	}
+	loggerFrom(ctx).Info("Video uploaded to S3", "job_id", job.ID, "url", s3URL)
+
+	presignedDownloadURL, err := w.storage.PresignGet(ctx, s3Key, 24*time.Hour)
+	if err != nil {
+		presignedDownloadURL = s3URL
+	}
+	return presignedDownloadURL, nil
+}
+
+// awaitRender submits the job to Remotion, or resumes the render it was already
+// submitted as, and polls until it finishes, saving progress on the job as it goes
+func (w *renderWorker) awaitRender(ctx context.Context, job *RenderJob, videoURL string) (string, error) {
+	timeout := w.cfg.Remotion.Timeout
+	renderCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	logger := loggerFrom(ctx).With("job_id", job.ID)
+
+	resumed := false
+	if job.RenderID != "" {
+		// A render submitted before a restart may still be running or finished
+		status, err := w.remotion.Status(renderCtx, job.RenderID)
+		resumed = err == nil && status.Status != "failed"
+	}
+	if resumed {
+		logger.Info("Resuming render", "render_id", job.RenderID)
+	} else {
+		req := RenderRequest{
+			VideoURL: videoURL,
+			Captions: job.Captions,
+			Style:    job.Style,
+			OutPath:  fmt.Sprintf("out/video_%s.mp4", job.ID),
+		}
+		if w.cfg.Remotion.CallbackURL != "" {
+			req.CallbackURL = w.cfg.Remotion.CallbackURL + "/render-callback/" + job.ID
+		}
+		renderID, err := w.remotion.Submit(renderCtx, req)
+		if err != nil {
+			return "", err
+		}
+		job.RenderID = renderID
+		job.Progress = 0
+		logger.Info("Render submitted", "render_id", renderID)
+	}
+	job.enterStage(stageRendering, time.Now())
+	w.save(job)
+
+	for {
+		select {
+		case <-renderCtx.Done():
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", fmt.Errorf("render did not finish within %s", timeout)
+		case <-time.After(w.cfg.Remotion.PollInterval):
+		}
+
+		status, err := w.remotion.Status(renderCtx, job.RenderID)
+		var remotionErr *RemotionError
+		if errors.As(err, &remotionErr) && !remotionErr.Transient {
+			return "", fmt.Errorf("%w: %v", errRenderLost, err)
+		}
+		if err != nil {
+			// Remotion keeps rendering through a blip, keep polling until the deadline
+			logger.Warn("Failed to check render status", "render_id", job.RenderID, "error", err)
+			continue
+		}
+
+		if status.Progress > job.Progress {
+			job.Progress = status.Progress
+			if err := w.jobs.UpdateProgress(job.ID, job.RenderID, status.Progress); err != nil {
+				logger.Warn("Failed to save render progress", "render_id", job.RenderID, "error", err)
+			}
+		}
+		switch status.Status {
+		case "completed":
+			return status.OutPath, nil
+		case "failed":
+			return "", fmt.Errorf("%w: %s", errRenderFailed, status.Error)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRemotion accepts a render, reports it rendering once and then completed
+// (or failed), and serves the output like the Remotion service
+func fakeRemotion(t *testing.T, success bool) *httptest.Server {
+	polls := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/render":
+			assert.Equal(t, "render-key", r.Header.Get("x-api-key"))
+			assert.Equal(t, "req-123", r.Header.Get(requestIDHeader))
+			var req map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&req)
+			assert.Contains(t, req["videoUrl"], "uploads/acme/a1.mp4")
+			assert.Equal(t, true, req["async"])
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "renderId": "render-1"})
+		case "/render/render-1":
+			assert.Equal(t, "render-key", r.Header.Get("x-api-key"))
+			polls++
+			switch {
+			case polls == 1:
+				json.NewEncoder(w).Encode(RenderStatus{RenderID: "render-1", Status: "rendering", Progress: 45})
+			case success:
+				json.NewEncoder(w).Encode(RenderStatus{RenderID: "render-1", Status: "completed", Progress: 100, OutPath: "out/video_job-1.mp4"})
+			default:
+				json.NewEncoder(w).Encode(RenderStatus{RenderID: "render-1", Status: "failed", Progress: 45, Error: "Render process exited with code 1"})
+			}
+		case "/download/video_job-1.mp4":
+			w.Write([]byte("rendered video"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func newTestRenderWorker(remotionURL string) *renderWorker {
+	cfg := &Config{
+		RemotionURL:  remotionURL,
+		RenderAPIKey: "render-key",
+		Remotion: RemotionConfig{
+			Timeout: 5 * time.Second, PollInterval: time.Millisecond, MaxAttempts: 2,
+			RetryBaseDelay: time.Millisecond, BreakerThreshold: 5, BreakerCooldown: time.Minute,
+		},
+		RenderRetry: RenderRetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+	return &renderWorker{
+		cfg:      cfg,
+		storage:  newFakeStorage(),
+		jobs:     newMemoryJobStore(),
+		remotion: newRemotionClient(remotionURL, "render-key", cfg.Remotion),
+	}
+}
+
+// TestProcessRenderJob tests rendering, storing the output and completing the job
+func TestProcessRenderJob(t *testing.T) {
+	remotion := fakeRemotion(t, true)
+	defer remotion.Close()
+	worker := newTestRenderWorker(remotion.URL)
+	worker.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "pending", S3Key: "uploads/acme/a1.mp4", RequestID: "req-123"})
+
+	worker.processRenderJob(context.Background(), "job-1")
+
+	job, _ := worker.jobs.Get("job-1")
+	assert.Equal(t, "completed", job.Status)
+	assert.Equal(t, "render-1", job.RenderID)
+	assert.Equal(t, 100, job.Progress)
+	assert.Equal(t, stageFinalizing, job.Stage)
+	for _, stage := range []string{stageFetchingVideo, stageRendering, stageUploading, stageFinalizing} {
+		assert.Contains(t, job.StageTimes, stage)
+	}
+	assert.False(t, job.StageTimes[stageUploading].Before(job.StageTimes[stageRendering]))
+	assert.Contains(t, job.OutputURL, "output/acme/video_job-1.mp4")
+	output, found, _ := worker.storage.Get(context.Background(), "output/acme/video_job-1.mp4")
+	assert.True(t, found)
+	assert.Equal(t, "rendered video", string(output))
+}
+
+// TestProcessRenderJobFailure tests that a failed render marks the job failed
+func TestProcessRenderJobFailure(t *testing.T) {
+	remotion := fakeRemotion(t, false)
+	defer remotion.Close()
+	worker := newTestRenderWorker(remotion.URL)
+	worker.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "pending", S3Key: "uploads/acme/a1.mp4", RequestID: "req-123"})
+
+	worker.processRenderJob(context.Background(), "job-1")
+
+	job, _ := worker.jobs.Get("job-1")
+	assert.Equal(t, "failed", job.Status)
+	assert.Equal(t, "Failed to trigger render task: render failed: Render process exited with code 1", job.Error)
+	assert.Equal(t, 45, job.Progress)
+	// A render Remotion ran and failed is not retried
+	if assert.Len(t, job.Attempts, 1) {
+		assert.Equal(t, job.Error, job.Attempts[0].Error)
+		assert.NotNil(t, job.Attempts[0].EndedAt)
+	}
+}
+
+// TestProcessRenderJobRetriesTransientFailure tests that a job is run again after Remotion
+// was unavailable and that each attempt is recorded
+func TestProcessRenderJobRetriesTransientFailure(t *testing.T) {
+	submits := 0
+	remotion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/render":
+			// The client retries once itself, so the first job attempt sees two 503s
+			submits++
+			if submits <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"success":false,"error":"busy"}`))
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "renderId": "render-1"})
+		case "/render/render-1":
+			json.NewEncoder(w).Encode(RenderStatus{RenderID: "render-1", Status: "completed", Progress: 100, OutPath: "out/video_job-1.mp4"})
+		case "/download/video_job-1.mp4":
+			w.Write([]byte("rendered video"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer remotion.Close()
+	worker := newTestRenderWorker(remotion.URL)
+	worker.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "pending"})
+
+	worker.processRenderJob(context.Background(), "job-1")
+
+	job, _ := worker.jobs.Get("job-1")
+	assert.Equal(t, "completed", job.Status)
+	if assert.Len(t, job.Attempts, 2) {
+		assert.Equal(t, "Failed to trigger render task: remotion error (503): busy (gave up after 2 attempts)", job.Attempts[0].Error)
+		assert.Empty(t, job.Attempts[1].Error)
+		assert.False(t, job.Attempts[1].StartedAt.Before(*job.Attempts[0].EndedAt))
+	}
+}
+
+// TestProcessRenderJobRetriesExhausted tests that a job fails once its attempts are used up
+func TestProcessRenderJobRetriesExhausted(t *testing.T) {
+	remotion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer remotion.Close()
+	worker := newTestRenderWorker(remotion.URL)
+	worker.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "pending"})
+
+	worker.processRenderJob(context.Background(), "job-1")
+
+	job, _ := worker.jobs.Get("job-1")
+	assert.Equal(t, "failed", job.Status)
+	assert.Equal(t, "Failed to trigger render task: remotion error (502): Bad Gateway (gave up after 2 attempts)", job.Error)
+	assert.Len(t, job.Attempts, 2)
+}
+
+// TestIsTransient tests which failures are worth running a job again for
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient(errors.New("failed to upload output")))
+	assert.True(t, isTransient(errCircuitOpen))
+	assert.True(t, isTransient(&renderFailure{step: "Failed to trigger render task", err: &RemotionError{StatusCode: 503, Transient: true}}))
+	assert.True(t, isTransient(fmt.Errorf("%w: %v", errRenderLost, &RemotionError{StatusCode: 404})))
+	assert.False(t, isTransient(&renderFailure{step: "Failed to trigger render task", err: &RemotionError{StatusCode: 400}}))
+	assert.False(t, isTransient(fmt.Errorf("%w: out of memory", errRenderFailed)))
+}
+
+// TestLoadRenderRetryPolicy tests retry defaults and validation
+func TestLoadRenderRetryPolicy(t *testing.T) {
+	policy, err := loadRenderRetryPolicy(mapSource(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, RenderRetryPolicy{MaxAttempts: 3, BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute}, policy)
+
+	policy, err = loadRenderRetryPolicy(mapSource(map[string]string{"RENDER_MAX_ATTEMPTS": "1", "RENDER_RETRY_BASE_DELAY": "10s"}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, policy.MaxAttempts)
+	assert.Equal(t, 10*time.Second, policy.BaseDelay)
+
+	_, err = loadRenderRetryPolicy(mapSource(map[string]string{"RENDER_MAX_ATTEMPTS": "0"}))
+	assert.EqualError(t, err, `invalid RENDER_MAX_ATTEMPTS "0", expected a positive integer`)
+	_, err = loadRenderRetryPolicy(mapSource(map[string]string{"RENDER_RETRY_MAX_DELAY": "-1s"}))
+	assert.EqualError(t, err, `invalid RENDER_RETRY_MAX_DELAY "-1s"`)
+}
+
+// TestRetryRenderJobEndpoint tests manually retrying failed jobs
+func TestRetryRenderJobEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+	ts.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "failed", Error: "Failed to trigger render task: render failed",
+		RenderID: "render-1", Progress: 45, Attempts: []RenderAttempt{{StartedAt: time.Now(), Error: "render failed"}}})
+	ts.jobs.Put(&RenderJob{ID: "job-2", TenantID: "acme", Status: "processing"})
+
+	w := ts.do("POST", "/render-job/job-1/retry", ts.apiKey("globex"), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = ts.do("POST", "/render-job/job-2/retry", key, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "job is processing")
+
+	w = ts.do("POST", "/render-job/job-1/retry", key, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"job-1"}, ts.queue.jobIDs)
+	job, _ := ts.jobs.Get("job-1")
+	assert.Equal(t, "pending", job.Status)
+	assert.Equal(t, stageQueued, job.Stage)
+	assert.Empty(t, job.Error)
+	assert.Empty(t, job.RenderID)
+	assert.Zero(t, job.Progress)
+	assert.Len(t, job.Attempts, 1, "earlier attempts are kept")
+
+	w = ts.do("POST", "/render-job/job-1/retry", key, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Concurrent retries of the same failed job queue it once
+	ts.jobs.Put(&RenderJob{ID: "job-3", TenantID: "acme", Status: "failed"})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ts.do("POST", "/render-job/job-3/retry", key, nil).Code == http.StatusOK {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, accepted)
+	assert.Equal(t, []string{"job-1", "job-3"}, ts.queue.jobIDs)
+}
+
+// TestProcessRenderJobResumes tests that a job interrupted after submission waits for its
+// existing render instead of rendering again
+func TestProcessRenderJobResumes(t *testing.T) {
+	remotion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/render/render-1":
+			json.NewEncoder(w).Encode(RenderStatus{RenderID: "render-1", Status: "completed", Progress: 100, OutPath: "out/video_job-1.mp4"})
+		case "/download/video_job-1.mp4":
+			w.Write([]byte("rendered video"))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer remotion.Close()
+	worker := newTestRenderWorker(remotion.URL)
+	worker.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "requeueable", RenderID: "render-1", Progress: 60})
+
+	worker.processRenderJob(context.Background(), "job-1")
+
+	job, _ := worker.jobs.Get("job-1")
+	assert.Equal(t, "completed", job.Status)
+	assert.Equal(t, "render-1", job.RenderID)
+}
+
+// TestRenderCallbackEndpoint tests that Remotion's progress callbacks update the job
+func TestRenderCallbackEndpoint(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.RenderAPIKey = "render-key" })
+	ts.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "processing", RenderID: "render-1", Progress: 10})
+
+	w := ts.do("POST", "/render-callback/job-1", "wrong-key", RenderStatus{RenderID: "render-1", Status: "rendering", Progress: 50})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = ts.do("POST", "/render-callback/job-1", "render-key", RenderStatus{RenderID: "render-2", Status: "rendering", Progress: 50})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	for _, progress := range []int{-1, 101} {
+		w = ts.do("POST", "/render-callback/job-1", "render-key", RenderStatus{RenderID: "render-1", Status: "rendering", Progress: progress})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	w = ts.do("POST", "/render-callback/job-1", "render-key", RenderStatus{RenderID: "render-1", Status: "rendering", Progress: 50})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	job, _ := ts.jobs.Get("job-1")
+	assert.Equal(t, 50, job.Progress)
+
+	// Late callbacks never move progress backwards
+	ts.do("POST", "/render-callback/job-1", "render-key", RenderStatus{RenderID: "render-1", Status: "rendering", Progress: 30})
+	job, _ = ts.jobs.Get("job-1")
+	assert.Equal(t, 50, job.Progress)
+
+	w = ts.do("GET", "/render-job/job-1", ts.apiKey("acme"), nil)
+	assert.Contains(t, w.Body.String(), `"progress":50`)
+
+	// A callback arriving after the worker finished leaves the job completed
+	job.Status, job.Progress = "completed", 100
+	ts.jobs.Put(job)
+	w = ts.do("POST", "/render-callback/job-1", "render-key", RenderStatus{RenderID: "render-1", Status: "rendering", Progress: 80})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	job, _ = ts.jobs.Get("job-1")
+	assert.Equal(t, "completed", job.Status)
+	assert.Equal(t, 100, job.Progress)
+}
+
+// TestRenderWorkerSaveKeepsCallbackProgress tests that the worker saving a stale copy of
+// the job does not undo progress reported by callbacks for the same render
+func TestRenderWorkerSaveKeepsCallbackProgress(t *testing.T) {
+	w := newTestRenderWorker("http://remotion.invalid")
+	job := &RenderJob{ID: "job-1", Status: "processing", RenderID: "render-1", Progress: 20}
+	w.jobs.Put(job)
+	w.jobs.UpdateProgress("job-1", "render-1", 60)
+
+	job.enterStage(stageUploading, time.Now())
+	w.save(job)
+
+	stored, _ := w.jobs.Get("job-1")
+	assert.Equal(t, 60, stored.Progress)
+	assert.Equal(t, stageUploading, stored.Stage)
+
+	// Progress of an earlier render does not carry over to a new one
+	job.RenderID, job.Progress = "render-2", 0
+	w.save(job)
+	stored, _ = w.jobs.Get("job-1")
+	assert.Equal(t, 0, stored.Progress)
+}
+
+// TestProcessRenderJobRejected tests that Remotion's validation message ends up on the job
+func TestProcessRenderJobRejected(t *testing.T) {
+	remotion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"success":false,"error":"Invalid style. Must be: bottom, top-bar, or karaoke"}`))
+	}))
+	defer remotion.Close()
+	worker := newTestRenderWorker(remotion.URL)
+	worker.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "pending", Style: "neon"})
+
+	worker.processRenderJob(context.Background(), "job-1")
+
+	job, _ := worker.jobs.Get("job-1")
+	assert.Equal(t, "failed", job.Status)
+	assert.Equal(t, "Failed to trigger render task: remotion rejected the request (400): Invalid style. Must be: bottom, top-bar, or karaoke", job.Error)
+}
+
+// TestProcessRenderJobInterrupted tests that a cancelled render leaves the job requeueable
+func TestProcessRenderJobInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	remotion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer remotion.Close()
+	worker := newTestRenderWorker(remotion.URL)
+	worker.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "pending"})
+
+	worker.processRenderJob(ctx, "job-1")
+
+	job, _ := worker.jobs.Get("job-1")
+	assert.Equal(t, "requeueable", job.Status)
+	assert.Equal(t, "Render interrupted by server shutdown", job.Error)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetentionRule expires objects under Prefix once they are older than TTL
+type RetentionRule struct {
+	Prefix string
+	TTL    time.Duration
+}
+
+// RetentionPolicy is the set of rules applied by the background sweeper
+type RetentionPolicy struct {
+	Rules    []RetentionRule
+	Interval time.Duration
+}
+
+// ExpiredObject is an S3 object eligible for deletion
+type ExpiredObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	Prefix       string    `json:"prefix"`
+}
+
+// retentionPrefixes maps each managed prefix to the env var holding its TTL
+var retentionPrefixes = []struct {
+	prefix string
+	env    string
+}{
+	{"uploads/", "RETENTION_UPLOADS_TTL"},
+	{"captions/", "RETENTION_CAPTIONS_TTL"},
+	{"transcripts/", "RETENTION_TRANSCRIPTS_TTL"},
+	{"output/", "RETENTION_OUTPUT_TTL"},
+}
+
+// loadRetentionPolicy reads per-prefix TTLs. Prefixes without a TTL are kept forever.
+func loadRetentionPolicy(getenv configSource) (RetentionPolicy, error) {
+	policy := RetentionPolicy{Interval: time.Hour}
+
+	if raw := getenv("RETENTION_SWEEP_INTERVAL"); raw != "" {
+		interval, err := parseRetentionDuration(raw)
+		if err != nil || interval <= 0 {
+			return policy, fmt.Errorf("invalid RETENTION_SWEEP_INTERVAL %q", raw)
+		}
+		policy.Interval = interval
+	}
+
+	for _, p := range retentionPrefixes {
+		raw := getenv(p.env)
+		if raw == "" {
+			continue
+		}
+		ttl, err := parseRetentionDuration(raw)
+		if err != nil || ttl < 0 {
+			return policy, fmt.Errorf("invalid %s %q", p.env, raw)
+		}
+		if ttl > 0 {
+			policy.Rules = append(policy.Rules, RetentionRule{Prefix: p.prefix, TTL: ttl})
+		}
+	}
+	return policy, nil
+}
+
+// parseRetentionDuration parses a Go duration, also accepting whole days ("30d")
+func parseRetentionDuration(raw string) (time.Duration, error) {
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(raw, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+// findExpiredObjects lists every object that has outlived its prefix's TTL
+func findExpiredObjects(ctx context.Context, policy RetentionPolicy, now time.Time,
+	list func(ctx context.Context, prefix string, fn func(obj StoredObject)) error) ([]ExpiredObject, error) {
+	var expired []ExpiredObject
+	for _, rule := range policy.Rules {
+		cutoff := now.Add(-rule.TTL)
+		err := list(ctx, rule.Prefix, func(obj StoredObject) {
+			if obj.LastModified.Before(cutoff) {
+				expired = append(expired, ExpiredObject{
+					Key:          obj.Key,
+					Size:         obj.Size,
+					LastModified: obj.LastModified,
+					Prefix:       rule.Prefix,
+				})
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expired, nil
+}
+
+// renderJobIDFromOutputKey extracts the job ID from output/video_<jobID>.mp4
+func renderJobIDFromOutputKey(key string) (string, bool) {
+	base := filepath.Base(key)
+	if !strings.HasPrefix(base, "video_") {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(base, "video_"), filepath.Ext(base)), true
+}
+
+// expireRelatedRecords updates the records that point at a deleted object
+func expireRelatedRecords(deps Deps, obj ExpiredObject) {
+	switch obj.Prefix {
+	case "uploads/":
+		if err := deps.Assets.Delete(assetIDFromS3Key(obj.Key)); err != nil {
+			slog.Error("Failed to remove asset", "key", obj.Key, "error", err)
+		}
+	case "captions/":
+		removeCaptionVersion(deps.Assets, obj.Key)
+	case "output/":
+		jobID, ok := renderJobIDFromOutputKey(obj.Key)
+		if !ok {
+			return
+		}
+		markJobExpired(deps.Jobs, jobID)
+	}
+}
+
+// markJobExpired flags a completed job whose output has been deleted
+func markJobExpired(jobs JobStore, jobID string) {
+	job, err := jobs.Get(jobID)
+	if err != nil {
+		if !errors.Is(err, errJobNotFound) {
+			slog.Error("Failed to load job", "job_id", jobID, "error", err)
+		}
+		return
+	}
+
+	job.Status = "expired"
+	job.OutputURL = ""
+	job.Error = "Output deleted by retention policy"
+	job.UpdatedAt = time.Now()
+	if err := jobs.Put(job); err != nil {
+		slog.Error("Failed to mark job expired", "job_id", jobID, "error", err)
+	}
+}
+
+// sweepExpiredObjects deletes expired objects and expires their related records
+func sweepExpiredObjects(deps Deps, policy RetentionPolicy) {
+	ctx := context.Background()
+	expired, err := findExpiredObjects(ctx, policy, time.Now(), deps.Storage.List)
+	if err != nil {
+		slog.Error("Retention sweep failed", "error", err)
+		return
+	}
+
+	deleted := 0
+	for _, obj := range expired {
+		if err := deps.Storage.Delete(ctx, obj.Key); err != nil {
+			slog.Error("Retention sweep could not delete object", "key", obj.Key, "error", err)
+			continue
+		}
+		expireRelatedRecords(deps, obj)
+		deleted++
+	}
+	if deleted > 0 {
+		slog.Info("Retention sweep deleted expired objects", "deleted", deleted)
+	}
+}
+
+// startRetentionSweeper runs the sweeper in the background on the policy interval
+func startRetentionSweeper(deps Deps, policy RetentionPolicy) {
+	if len(policy.Rules) == 0 {
+		return
+	}
+	slog.Info("Retention sweeper enabled", "prefixes", len(policy.Rules), "interval", policy.Interval.String())
+
+	go func() {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepExpiredObjects(deps, policy)
+		}
+	}()
+}
+
+// retentionPreviewHandler handles GET /admin/retention/preview, a dry run of the next sweep
+func (s *Server) retentionPreviewHandler(c *gin.Context) {
+	policy := s.cfg.Retention
+	expired, err := findExpiredObjects(c.Request.Context(), policy, time.Now(), s.Storage.List)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list objects: %v", err)})
+		return
+	}
+
+	var totalBytes int64
+	for _, obj := range expired {
+		totalBytes += obj.Size
+	}
+	if expired == nil {
+		expired = []ExpiredObject{}
+	}
+
+	rules := []gin.H{}
+	for _, rule := range policy.Rules {
+		rules = append(rules, gin.H{"prefix": rule.Prefix, "ttl": rule.TTL.String()})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules":      rules,
+		"objects":    expired,
+		"count":      len(expired),
+		"totalBytes": totalBytes,
+	})
+}
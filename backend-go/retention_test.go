@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoadRetentionPolicy tests per-prefix TTLs from the environment
+func TestLoadRetentionPolicy(t *testing.T) {
+	t.Setenv("RETENTION_UPLOADS_TTL", "30d")
+	t.Setenv("RETENTION_OUTPUT_TTL", "72h")
+	t.Setenv("RETENTION_CAPTIONS_TTL", "0")
+	t.Setenv("RETENTION_SWEEP_INTERVAL", "15m")
+
+	policy, err := loadRetentionPolicy(os.Getenv)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, policy.Interval)
+	assert.Equal(t, []RetentionRule{
+		{Prefix: "uploads/", TTL: 30 * 24 * time.Hour},
+		{Prefix: "output/", TTL: 72 * time.Hour},
+	}, policy.Rules)
+
+	t.Setenv("RETENTION_OUTPUT_TTL", "soon")
+	_, err = loadRetentionPolicy(os.Getenv)
+	assert.Error(t, err)
+}
+
+// TestFindExpiredObjects tests that only objects older than their prefix TTL are selected
+func TestFindExpiredObjects(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	objects := map[string][]StoredObject{
+		"uploads/": {
+			{Key: "uploads/old.mp4", Size: 100, LastModified: now.Add(-48 * time.Hour)},
+			{Key: "uploads/new.mp4", Size: 100, LastModified: now.Add(-time.Hour)},
+		},
+		"output/": {
+			{Key: "output/video_job1.mp4", Size: 50, LastModified: now.Add(-2 * time.Hour)},
+		},
+	}
+	list := func(ctx context.Context, prefix string, fn func(obj StoredObject)) error {
+		for _, obj := range objects[prefix] {
+			fn(obj)
+		}
+		return nil
+	}
+	policy := RetentionPolicy{Rules: []RetentionRule{
+		{Prefix: "uploads/", TTL: 24 * time.Hour},
+		{Prefix: "output/", TTL: time.Hour},
+	}}
+
+	expired, err := findExpiredObjects(context.Background(), policy, now, list)
+
+	assert.NoError(t, err)
+	assert.Len(t, expired, 2)
+	assert.Equal(t, "uploads/old.mp4", expired[0].Key)
+	assert.Equal(t, "output/video_job1.mp4", expired[1].Key)
+}
+
+// TestMarkJobExpired tests that jobs lose their output when it is deleted
+func TestMarkJobExpired(t *testing.T) {
+	jobs := newMemoryJobStore()
+	jobs.Put(&RenderJob{ID: "job-expire", Status: "completed", OutputURL: "https://example.com/out.mp4"})
+
+	jobID, ok := renderJobIDFromOutputKey("output/video_job-expire.mp4")
+	assert.True(t, ok)
+	markJobExpired(jobs, jobID)
+
+	job, _ := jobs.Get("job-expire")
+	assert.Equal(t, "expired", job.Status)
+	assert.Empty(t, job.OutputURL)
+}
+
+// TestSweepExpiredObjects tests that the sweeper deletes expired objects and updates their records
+func TestSweepExpiredObjects(t *testing.T) {
+	ts := newTestServer(t)
+	ts.storage.Put(context.Background(), "output/acme/video_job-old.mp4", "video/mp4", strings.NewReader("video"), nil)
+	ts.storage.Put(context.Background(), "uploads/acme/a1.mp4", "video/mp4", strings.NewReader("video"), nil)
+	ts.storage.modified["output/acme/video_job-old.mp4"] = time.Now().Add(-48 * time.Hour)
+	ts.jobs.Put(&RenderJob{ID: "job-old", TenantID: "acme", Status: "completed", OutputURL: "https://example.com/out.mp4"})
+
+	sweepExpiredObjects(ts.deps(), RetentionPolicy{Rules: []RetentionRule{
+		{Prefix: "output/", TTL: 24 * time.Hour},
+		{Prefix: "uploads/", TTL: 24 * time.Hour},
+	}})
+
+	_, found, _ := ts.storage.Get(context.Background(), "output/acme/video_job-old.mp4")
+	assert.False(t, found)
+	_, found, _ = ts.storage.Get(context.Background(), "uploads/acme/a1.mp4")
+	assert.True(t, found, "recent uploads are kept")
+	job, _ := ts.jobs.Get("job-old")
+	assert.Equal(t, "expired", job.Status)
+}
+
+// TestRequireAdmin tests the admin key guard
+func TestRequireAdmin(t *testing.T) {
+	preview := func(ts *testServer, adminKey string) int {
+		req, _ := http.NewRequest("GET", "/admin/retention/preview", nil)
+		if adminKey != "" {
+			req.Header.Set("X-Admin-Key", adminKey)
+		}
+		return ts.serve(req).Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, preview(newTestServer(t), "s3cret"), "disabled without ADMIN_API_KEY")
+
+	ts := newTestServer(t, func(cfg *Config) { cfg.AdminAPIKey = "s3cret" })
+	assert.Equal(t, http.StatusUnauthorized, preview(ts, ""))
+	assert.Equal(t, http.StatusUnauthorized, preview(ts, "wrong"))
+	assert.Equal(t, http.StatusOK, preview(ts, "s3cret"))
+}
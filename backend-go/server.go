@@ -0,0 +1,606 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// Deps are the external services the server talks to
+type Deps struct {
+	Storage     ObjectStorage
+	Jobs        JobStore
+	Queue       JobQueue
+	Transcriber Transcriber
+	Assets      AssetStore
+	APIKeys     APIKeyStore
+	Usage       UsageStore
+	DeadLetters *deadLetterQueue // nil without SQS_DLQ_URL
+}
+
+// Server holds the configuration and dependencies shared by all handlers
+type Server struct {
+	cfg *Config
+	Deps
+	ready     *readinessChecker
+	estimator *renderEstimator
+}
+
+// NewServer builds the HTTP router with every route wired to deps
+func NewServer(cfg *Config, deps Deps) *gin.Engine {
+	s := &Server{cfg: cfg, Deps: deps}
+	s.ready = &readinessChecker{probes: s.probes(), timeout: cfg.Health.Timeout, ttl: cfg.Health.CacheTTL}
+	s.estimator = newRenderEstimator(deps.Jobs)
+	return s.routes()
+}
+
+// routes registers all endpoints
+func (s *Server) routes() *gin.Engine {
+	r := gin.New()
+
+	// Tag each request with an ID, log it as JSON and recover from panics
+	r.Use(otelgin.Middleware(s.cfg.Tracing.ServiceName), requestID(), accessLog(), httpMetrics(), gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		loggerFrom(c.Request.Context()).Error("Panic serving request", "error", fmt.Sprint(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+
+	// CORS middleware - must be before routes
+	r.Use(corsMiddleware(s.cfg.CORS))
+
+	// Serve static files
+	r.Static("/static", "./static")
+
+	// Load HTML templates
+	r.LoadHTMLGlob("templates/*")
+
+	// GET / - Upload page
+	r.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "upload.html", nil)
+	})
+
+	// GET /metrics - Prometheus metrics
+	r.GET("/metrics", s.metricsHandler())
+
+	// GET /health - Health check
+	r.GET("/health", s.healthHandler)
+
+	// POST /render-callback/:id - Render progress from Remotion, authenticated with RENDER_API_KEY
+	r.POST("/render-callback/:id", s.renderCallbackHandler)
+
+	// GET /livez and /readyz - Liveness and dependency readiness probes
+	r.GET("/livez", s.livezHandler)
+	r.GET("/readyz", s.readyzHandler)
+
+	// Everything below requires an API key or bearer token
+	authed := r.Group("", s.requireTenant())
+
+	// GET /download/:filename - Proxy download from Remotion service
+	authed.GET("/download/:filename", s.downloadHandler)
+
+	// POST /upload - Handle video upload and store in S3
+	authed.POST("/upload", rateLimit(s.cfg.RateLimits.Upload), s.uploadHandler)
+
+	// POST /get-presigned-url - Get presigned URL for preview
+	authed.POST("/get-presigned-url", s.presignHandler)
+
+	// POST /transcribe - Transcribe video using AssemblyAI
+	authed.POST("/transcribe", rateLimit(s.cfg.RateLimits.Transcribe), s.transcribeHandler)
+
+	// POST /render-job - Create async render job
+	authed.POST("/render-job", rateLimit(s.cfg.RateLimits.Render), s.createRenderJobHandler)
+
+	// GET /render-job/:id - Get job status
+	authed.GET("/render-job/:id", s.getRenderJobHandler)
+
+	// POST /render-job/:id/retry - Run a failed job again
+	authed.POST("/render-job/:id/retry", rateLimit(s.cfg.RateLimits.Render), s.retryRenderJobHandler)
+
+	// Current month's usage against quotas
+	authed.GET("/usage", s.usageHandler)
+
+	// Asset library
+	authed.GET("/assets", s.listAssetsHandler)
+	authed.GET("/assets/:id", s.getAssetHandler)
+	authed.DELETE("/assets/:id", s.deleteAssetHandler)
+	authed.GET("/assets/:id/captions", s.listCaptionVersionsHandler)
+	authed.POST("/assets/:id/captions", s.saveCaptionVersionHandler)
+	authed.GET("/assets/:id/captions/:version", s.getCaptionVersionHandler)
+
+	// Operator endpoints
+	admin := r.Group("/admin", requireAdmin(s.cfg.AdminAPIKey))
+	admin.GET("/retention/preview", s.retentionPreviewHandler)
+	admin.POST("/api-keys", s.createAPIKeyHandler)
+	admin.DELETE("/api-keys", s.revokeAPIKeyHandler)
+	admin.GET("/dead-letters", s.listDeadLettersHandler)
+	admin.POST("/dead-letters/redrive", s.redriveDeadLettersHandler)
+
+	return r
+}
+
+// healthHandler handles GET /health
+func (s *Server) healthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"service": "captioning-backend",
+	})
+}
+
+// downloadHandler proxies a rendered file from the Remotion service
+func (s *Server) downloadHandler(c *gin.Context) {
+	filename := c.Param("filename")
+
+	resp, err := http.Get(s.cfg.RemotionURL + "/download/" + filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Download failed"})
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	// Set headers for file download
+	c.Header("Content-Type", "video/mp4")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	// Stream the file
+	io.Copy(c.Writer, resp.Body)
+}
+
+// uploadHandler handles POST /upload, storing a probed MP4 and its asset record
+func (s *Server) uploadHandler(c *gin.Context) {
+	logger := loggerFrom(c.Request.Context())
+
+	// Enforce max upload size (200MB)
+	const maxUploadSize = 200 * 1024 * 1024 // 200MB
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+
+	if err := c.Request.ParseMultipartForm(maxUploadSize); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large (max 200MB)"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("video")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	// Validate MIME type using first 512 bytes, hashing the content in the same pass
+	hasher := sha256.New()
+	stream := io.TeeReader(file, hasher)
+	buffer := make([]byte, 512)
+	_, err = io.ReadFull(stream, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	file.Seek(0, 0) // Reset file pointer
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+
+	mimeType := http.DetectContentType(buffer)
+	if mimeType != "video/mp4" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only MP4 files are allowed"})
+		return
+	}
+
+	// Probe duration, dimensions, codecs and audio presence
+	mediaInfo, err := probeMP4(file, header.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid MP4 file: %v", err)})
+		return
+	}
+
+	// Reuse the existing object when this caller already uploaded the same content
+	owner := requestTenant(c)
+	existing, err := s.Assets.FindByChecksum(owner, checksum)
+	if err != nil {
+		logger.Warn("Checksum lookup failed", "error", err)
+	} else if existing != nil {
+		logger.Info("Upload matches existing asset", "asset_id", existing.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"assetId":   existing.ID,
+			"fileUrl":   s.Storage.URL(existing.S3Key),
+			"s3Key":     existing.S3Key,
+			"media":     existing.Media,
+			"duplicate": true,
+		})
+		return
+	}
+
+	// Generate secure filename with UUID
+	ext := filepath.Ext(header.Filename)
+	if ext == "" {
+		ext = ".mp4"
+	}
+	assetID := uuid.New().String()
+	filename := assetID + ext
+
+	// Upload directly to S3
+	s3Key := tenantUploadPrefix(owner) + filename
+	s3URL, err := s.Storage.Put(c.Request.Context(), s3Key, "video/mp4", file, mediaInfo.s3Metadata())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload to S3: %v", err)})
+		return
+	}
+	uploadBytes.Observe(float64(header.Size))
+
+	asset := &Asset{
+		ID:        assetID,
+		Filename:  header.Filename,
+		Size:      header.Size,
+		Checksum:  checksum,
+		S3Key:     s3Key,
+		Media:     mediaInfo,
+		Owner:     owner,
+		CreatedAt: time.Now(),
+	}
+	if err := s.Assets.Put(asset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save asset"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"assetId": asset.ID,
+		"fileUrl": s3URL,
+		"s3Key":   s3Key,
+		"media":   mediaInfo,
+	})
+}
+
+// transcribeHandler handles POST /transcribe, captioning an upload with the transcriber
+func (s *Server) transcribeHandler(c *gin.Context) {
+	logger := loggerFrom(c.Request.Context())
+	var req struct {
+		FileURL string `json:"fileUrl"`
+		S3Key   string `json:"s3Key"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Only the tenant's own uploads can be transcribed
+	if !tenantOwnsUpload(requestTenant(c), req.S3Key) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+
+	asset, ok := s.getUploadAsset(c, req.S3Key)
+	if !ok {
+		return
+	}
+
+	// Skip the paid transcription when the upload has no audio track
+	var mediaInfo *MediaInfo
+	var err error
+	if asset != nil {
+		mediaInfo = asset.Media
+	} else if mediaInfo, err = getMediaInfo(c.Request.Context(), s.Storage, req.S3Key); err != nil {
+		logger.Warn("Could not read media info", "key", req.S3Key, "error", err)
+	}
+	if mediaInfo != nil && !mediaInfo.HasAudio {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Video has no audio track to transcribe"})
+		return
+	}
+
+	// Reuse captions already transcribed for identical content
+	var captions []Caption
+	cached := false
+	if asset != nil {
+		captions, cached = getCachedTranscript(c.Request.Context(), s.Storage, requestTenant(c), asset.Checksum)
+	}
+
+	if cached {
+		logger.Info("Using cached transcript", "asset_id", asset.ID)
+		transcriptionsTotal.WithLabelValues("cached").Inc()
+	} else {
+		// Paid transcription counts against the monthly quota
+		var duration float64
+		if mediaInfo != nil {
+			duration = mediaInfo.Duration
+		}
+		// An unprobed upload could be transcribed without being charged
+		if duration == 0 && s.cfg.Quotas.TranscribeMinutes > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Transcription quota is enforced and the video's duration could not be read"})
+			return
+		}
+		if !s.checkQuota(c, usageTranscribe, duration) {
+			return
+		}
+
+		// Generate presigned URL valid for 1 hour for the transcriber to access the video
+		presignedURL, err := s.Storage.PresignGet(c.Request.Context(), req.S3Key, 1*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate presigned URL: %v", err)})
+			return
+		}
+
+		logger.Info("Generated presigned URL for transcription", "url", presignedURL)
+
+		started := time.Now()
+		captions, err = s.Transcriber.Transcribe(c.Request.Context(), presignedURL)
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+		}
+		transcriptionsTotal.WithLabelValues(outcome).Inc()
+		transcriptionDuration.WithLabelValues(outcome).Observe(time.Since(started).Seconds())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Transcription failed: %v", err)})
+			return
+		}
+
+		if err := s.recordUsage(requestTenant(c), usageTranscribe, duration); err != nil {
+			logger.Error("Failed to record transcription usage", "error", err)
+		}
+
+		if asset != nil {
+			if err := cacheTranscript(c.Request.Context(), s.Storage, requestTenant(c), asset.Checksum, captions); err != nil {
+				logger.Warn("Failed to cache transcript", "asset_id", asset.ID, "error", err)
+			}
+		}
+	}
+
+	// Generate SRT file and upload it under the asset's caption versions
+	var srtURL string
+	if asset == nil {
+		// Upload without an asset record: keep the transcript next to its video ID
+		srtKey := captionKey(assetIDFromS3Key(req.S3Key), 1)
+		srtURL, err = s.Storage.Put(c.Request.Context(), srtKey, "text/plain", strings.NewReader(generateSRT(captions)), nil)
+		if err != nil {
+			logger.Error("Failed to upload SRT to S3", "error", err)
+			// Continue anyway, captions are in response
+		}
+	} else if original := asset.originalTranscript(); original != nil {
+		// Already transcribed, the original version is still current
+		srtURL = s.Storage.URL(original.Key)
+	} else if _, url, err := saveCaptionVersion(c.Request.Context(), s.Storage, s.Assets, asset, captions, "transcript"); err != nil {
+		logger.Error("Failed to save captions", "asset_id", asset.ID, "error", err)
+	} else {
+		srtURL = url
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"captions": captions,
+		"srtUrl":   srtURL,
+		"cached":   cached,
+	})
+}
+
+// createRenderJobHandler handles POST /render-job, queueing an async render at the
+// requested or tenant's priority, optionally not before scheduledAt
+func (s *Server) createRenderJobHandler(c *gin.Context) {
+	logger := loggerFrom(c.Request.Context())
+	var req struct {
+		VideoURL    string     `json:"videoUrl"`
+		Captions    []Caption  `json:"captions"`
+		Style       string     `json:"style"`
+		S3Key       string     `json:"s3Key"`
+		Priority    string     `json:"priority"`
+		ScheduledAt *time.Time `json:"scheduledAt"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Priority != "" && !validPriority(req.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be high, normal or low"})
+		return
+	}
+	if req.ScheduledAt != nil && time.Until(*req.ScheduledAt) > maxScheduleAhead {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("scheduledAt must be within %d days", int(maxScheduleAhead.Hours()/24))})
+		return
+	}
+
+	tenantID := requestTenant(c)
+	if req.S3Key != "" && !tenantOwnsUpload(tenantID, req.S3Key) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+
+	// Rendered minutes use the probed duration of the source upload
+	var duration float64
+	if req.S3Key != "" {
+		asset, ok := s.getUploadAsset(c, req.S3Key)
+		if !ok {
+			return
+		}
+		if asset != nil && asset.Media != nil {
+			duration = asset.Media.Duration
+		} else if mediaInfo, err := getMediaInfo(c.Request.Context(), s.Storage, req.S3Key); err == nil && mediaInfo != nil {
+			duration = mediaInfo.Duration
+		}
+	}
+	// An unprobed source could be rendered without being charged
+	if duration == 0 && s.cfg.Quotas.RenderMinutes > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Render quota is enforced, render an uploaded video by s3Key so its duration is known"})
+		return
+	}
+	if !s.checkQuota(c, usageRender, duration) {
+		return
+	}
+
+	// Create job
+	jobID := uuid.New().String()
+	job := &RenderJob{
+		ID:            jobID,
+		TenantID:      tenantID,
+		Status:        "pending",
+		VideoURL:      req.VideoURL,
+		S3Key:         req.S3Key,
+		Captions:      req.Captions,
+		Style:         req.Style,
+		Priority:      s.cfg.Queue.priorityFor(tenantID, req.Priority),
+		ScheduledAt:   req.ScheduledAt,
+		RequestID:     requestIDFrom(c.Request.Context()),
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		VideoDuration: duration,
+	}
+	job.enterStage(stageQueued, job.CreatedAt)
+
+	if err := s.Jobs.Put(job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save job"})
+		return
+	}
+	if !s.enqueueJob(c, job) {
+		return
+	}
+	logger.Info("Job queued", "job_id", jobID, "priority", job.Priority, "scheduled_at", job.ScheduledAt)
+
+	if err := s.recordUsage(tenantID, usageRender, duration); err != nil {
+		logger.Error("Failed to record render usage", "error", err)
+	}
+
+	response := gin.H{
+		"jobId":    jobID,
+		"status":   "pending",
+		"priority": job.Priority,
+		"message":  "Render job created successfully",
+	}
+	if job.ScheduledAt != nil {
+		response["scheduledAt"] = job.ScheduledAt
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// getRenderJobHandler handles GET /render-job/:id
+func (s *Server) getRenderJobHandler(c *gin.Context) {
+	job, err := s.Jobs.Get(c.Param("id"))
+	if err != nil || job.TenantID != requestTenant(c) {
+		if err != nil && !errors.Is(err, errJobNotFound) {
+			loggerFrom(c.Request.Context()).Error("Failed to load job", "job_id", c.Param("id"), "error", err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	job.ETA = s.estimator.estimate(job, time.Now())
+	c.JSON(http.StatusOK, job)
+}
+
+// enqueueJob queues a saved job. When that fails the job is marked failed and the
+// response is written, so the caller only returns.
+func (s *Server) enqueueJob(c *gin.Context, job *RenderJob) bool {
+	err := s.Queue.Enqueue(c.Request.Context(), job)
+	if err == nil {
+		return true
+	}
+	job.Status = "failed"
+	job.Error = fmt.Sprintf("Failed to queue job: %v", err)
+	job.UpdatedAt = time.Now()
+	if err := s.Jobs.Put(job); err != nil {
+		loggerFrom(c.Request.Context()).Error("Failed to save job", "job_id", job.ID, "error", err)
+	}
+	// Draining before shutdown, another instance takes the retry
+	if errors.Is(err, errQueueClosed) {
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down, retry shortly"})
+		return false
+	}
+	if errors.Is(err, errQueueFull) {
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Render queue is full, retry later"})
+		return false
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
+	return false
+}
+
+// retryRenderJobHandler handles POST /render-job/:id/retry, queueing a failed job
+// again with a fresh set of automatic retries. Usage was recorded when it was created.
+func (s *Server) retryRenderJobHandler(c *gin.Context) {
+	logger := loggerFrom(c.Request.Context())
+	job, err := s.Jobs.Get(c.Param("id"))
+	if err != nil || job.TenantID != requestTenant(c) {
+		if err != nil && !errors.Is(err, errJobNotFound) {
+			logger.Error("Failed to load job", "job_id", c.Param("id"), "error", err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if job.Status != "failed" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Only failed jobs can be retried, job is %s", job.Status)})
+		return
+	}
+
+	job.Status = "pending"
+	job.Error = ""
+	job.Progress = 0
+	job.RenderID = ""
+	job.ScheduledAt = nil // retried right away
+	job.RequestID = requestIDFrom(c.Request.Context())
+	job.UpdatedAt = time.Now()
+	job.enterStage(stageQueued, job.UpdatedAt)
+	// Only one of concurrent retries gets to queue the job
+	err = s.Jobs.PutIfStatus(job, "failed")
+	if errors.Is(err, errJobStatusChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Job is already being retried"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save job"})
+		return
+	}
+	if !s.enqueueJob(c, job) {
+		return
+	}
+	logger.Info("Job queued for retry", "job_id", job.ID, "previous_attempts", len(job.Attempts))
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobId":   job.ID,
+		"status":  "pending",
+		"message": "Render job queued for retry",
+	})
+}
+
+// renderCallbackHandler handles POST /render-callback/:id, where Remotion reports the
+// progress of a submitted render. The worker polling the render still finalizes the job.
+func (s *Server) renderCallbackHandler(c *gin.Context) {
+	provided := c.GetHeader("x-api-key")
+	if s.cfg.RenderAPIKey == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(s.cfg.RenderAPIKey)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid render key"})
+		return
+	}
+
+	var status RenderStatus
+	if err := c.ShouldBindJSON(&status); err != nil || status.Progress < 0 || status.Progress > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	job, err := s.Jobs.Get(c.Param("id"))
+	if err != nil || job.RenderID != status.RenderID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	// 100 is left for the worker, which marks the job completed once the output is stored
+	if status.Progress < 100 {
+		if err := s.Jobs.UpdateProgress(job.ID, status.RenderID, status.Progress); err != nil {
+			loggerFrom(c.Request.Context()).Error("Failed to save render progress", "job_id", job.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save progress"})
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
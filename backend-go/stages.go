@@ -0,0 +1,152 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Render stages, in the order a job passes through them
+const (
+	stageQueued        = "queued"
+	stageFetchingVideo = "fetching-video"
+	stageRendering     = "rendering"
+	stageUploading     = "uploading"
+	stageFinalizing    = "finalizing"
+)
+
+// estimateSamples is how many recent completed renders per style feed the ETA
+const estimateSamples = 50
+
+// enterStage moves job to stage and records when it started
+func (job *RenderJob) enterStage(stage string, now time.Time) {
+	if job.StageTimes == nil {
+		job.StageTimes = map[string]time.Time{}
+	}
+	job.Stage = stage
+	job.StageTimes[stage] = now
+}
+
+// renderEstimator predicts render completion from how long recent renders of the
+// same style took per second of video. Speeds are reloaded from the job store at
+// most once per refresh interval, in the background once the first load is done, so
+// status polls never wait on the scan of completed jobs.
+type renderEstimator struct {
+	jobs    JobStore
+	refresh time.Duration
+
+	mu       sync.Mutex
+	speeds   map[string]float64 // style -> render seconds per second of video
+	overall  float64            // across styles, for styles without history
+	loadedAt time.Time
+	loading  bool
+}
+
+func newRenderEstimator(jobs JobStore) *renderEstimator {
+	return &renderEstimator{jobs: jobs, refresh: 10 * time.Minute}
+}
+
+// speed returns the render seconds per second of video expected for style
+func (e *renderEstimator) speed(style string, now time.Time) (float64, bool) {
+	e.mu.Lock()
+	stale := !e.loading && (e.loadedAt.IsZero() || now.Sub(e.loadedAt) >= e.refresh)
+	if stale {
+		e.loading = true
+		e.loadedAt = now
+	}
+	first := e.speeds == nil
+	e.mu.Unlock()
+
+	if stale && first {
+		e.reload()
+	} else if stale {
+		go e.reload()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if speed, ok := e.speeds[style]; ok {
+		return speed, true
+	}
+	return e.overall, e.overall > 0
+}
+
+// reload recomputes speeds from the completed jobs. A failed load keeps the previous
+// speeds until the next refresh.
+func (e *renderEstimator) reload() {
+	completed, err := e.jobs.ListByStatus("completed")
+	var speeds map[string]float64
+	var overall float64
+	if err == nil {
+		speeds, overall = renderSpeeds(completed)
+	} else {
+		slog.Warn("Failed to load render history for ETAs", "error", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loading = false
+	if err == nil {
+		e.speeds, e.overall = speeds, overall
+	}
+}
+
+// renderSpeeds averages render seconds per second of video over the most recent
+// completed jobs of each style. jobs are ordered oldest first.
+func renderSpeeds(jobs []*RenderJob) (map[string]float64, float64) {
+	totals := map[string]float64{}
+	counts := map[string]int{}
+	var overall float64
+	var overallCount int
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+		started, ok := job.StageTimes[stageFetchingVideo]
+		if !ok || job.VideoDuration <= 0 || counts[job.Style] >= estimateSamples {
+			continue
+		}
+		elapsed := job.UpdatedAt.Sub(started).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		totals[job.Style] += elapsed / job.VideoDuration
+		counts[job.Style]++
+		overall += elapsed / job.VideoDuration
+		overallCount++
+	}
+
+	speeds := map[string]float64{}
+	for style, total := range totals {
+		speeds[style] = total / float64(counts[style])
+	}
+	if overallCount > 0 {
+		overall /= float64(overallCount)
+	}
+	return speeds, overall
+}
+
+// estimate returns when an unfinished job is expected to complete, or nil without
+// a video duration or render history to go on
+func (e *renderEstimator) estimate(job *RenderJob, now time.Time) *time.Time {
+	if (job.Status != "pending" && job.Status != "processing") || job.VideoDuration <= 0 {
+		return nil
+	}
+	speed, ok := e.speed(job.Style, now)
+	if !ok {
+		return nil
+	}
+	expected := time.Duration(speed * job.VideoDuration * float64(time.Second))
+
+	started, ok := job.StageTimes[stageFetchingVideo]
+	if !ok || job.Stage == stageQueued {
+		started = now
+		if job.ScheduledAt != nil && job.ScheduledAt.After(now) {
+			started = *job.ScheduledAt
+		}
+	}
+	eta := started.Add(expected)
+	if eta.Before(now) {
+		// Slower than usual, expect the remaining share of a typical render from now
+		eta = now.Add(expected * time.Duration(100-job.Progress) / 100)
+	}
+	return &eta
+}
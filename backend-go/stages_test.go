@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// completedRender is a finished job that took renderTime for seconds of video in style
+func completedRender(id, style string, seconds float64, renderTime time.Duration, finished time.Time) *RenderJob {
+	job := &RenderJob{ID: id, Status: "completed", Style: style, VideoDuration: seconds, CreatedAt: finished.Add(-renderTime), UpdatedAt: finished}
+	job.enterStage(stageFetchingVideo, finished.Add(-renderTime))
+	return job
+}
+
+// TestEnterStage tests that stage changes are timestamped
+func TestEnterStage(t *testing.T) {
+	now := time.Now()
+	job := &RenderJob{}
+
+	job.enterStage(stageQueued, now)
+	job.enterStage(stageRendering, now.Add(time.Second))
+
+	assert.Equal(t, stageRendering, job.Stage)
+	assert.Equal(t, now, job.StageTimes[stageQueued])
+	assert.Equal(t, now.Add(time.Second), job.StageTimes[stageRendering])
+}
+
+// TestRenderSpeeds tests averaging render time per second of video by style
+func TestRenderSpeeds(t *testing.T) {
+	now := time.Now()
+	speeds, overall := renderSpeeds([]*RenderJob{
+		completedRender("job-1", "bottom", 60, 2*time.Minute, now),
+		completedRender("job-2", "bottom", 30, 2*time.Minute, now),
+		completedRender("job-3", "karaoke", 10, time.Minute, now),
+		{ID: "job-4", Status: "completed", Style: "karaoke"}, // no stage times or duration
+	})
+
+	assert.Equal(t, map[string]float64{"bottom": 3, "karaoke": 6}, speeds)
+	assert.Equal(t, 4.0, overall)
+}
+
+// TestRenderEstimator tests ETAs from history for queued, running and slow jobs
+func TestRenderEstimator(t *testing.T) {
+	now := time.Now()
+	jobs := newMemoryJobStore()
+	jobs.Put(completedRender("done-1", "bottom", 60, 2*time.Minute, now.Add(-time.Hour)))
+	estimator := newRenderEstimator(jobs)
+
+	queued := &RenderJob{Status: "pending", Style: "bottom", VideoDuration: 30}
+	queued.enterStage(stageQueued, now)
+	assert.Equal(t, now.Add(time.Minute), *estimator.estimate(queued, now))
+
+	running := &RenderJob{Status: "processing", Style: "bottom", VideoDuration: 30, Progress: 50}
+	running.enterStage(stageFetchingVideo, now.Add(-20*time.Second))
+	assert.Equal(t, now.Add(40*time.Second), *estimator.estimate(running, now))
+
+	slow := &RenderJob{Status: "processing", Style: "bottom", VideoDuration: 30, Progress: 75}
+	slow.enterStage(stageFetchingVideo, now.Add(-5*time.Minute))
+	assert.Equal(t, now.Add(15*time.Second), *estimator.estimate(slow, now))
+
+	scheduledAt := now.Add(time.Hour)
+	scheduled := &RenderJob{Status: "pending", Style: "bottom", VideoDuration: 30, ScheduledAt: &scheduledAt}
+	scheduled.enterStage(stageQueued, now)
+	assert.Equal(t, scheduledAt.Add(time.Minute), *estimator.estimate(scheduled, now))
+
+	// Styles without history use the average of all styles
+	karaoke := &RenderJob{Status: "pending", Style: "karaoke", VideoDuration: 10}
+	assert.Equal(t, now.Add(20*time.Second), *estimator.estimate(karaoke, now))
+
+	assert.Nil(t, estimator.estimate(&RenderJob{Status: "pending", Style: "bottom"}, now), "no video duration")
+	assert.Nil(t, estimator.estimate(&RenderJob{Status: "completed", Style: "bottom", VideoDuration: 30}, now))
+}
+
+// slowHistory holds ListByStatus until a load is let through
+type slowHistory struct {
+	*memoryJobStore
+	loads chan struct{}
+}
+
+func (s slowHistory) ListByStatus(statuses ...string) ([]*RenderJob, error) {
+	<-s.loads
+	return s.memoryJobStore.ListByStatus(statuses...)
+}
+
+// TestRenderEstimatorRefreshInBackground tests that ETAs keep using the previous speeds
+// while the history is reloaded
+func TestRenderEstimatorRefreshInBackground(t *testing.T) {
+	now := time.Now()
+	jobs := slowHistory{newMemoryJobStore(), make(chan struct{}, 1)}
+	defer close(jobs.loads)
+	jobs.Put(completedRender("done-1", "bottom", 60, 2*time.Minute, now.Add(-time.Hour)))
+	estimator := newRenderEstimator(jobs)
+
+	jobs.loads <- struct{}{}
+	queued := &RenderJob{Status: "pending", Style: "bottom", VideoDuration: 30}
+	queued.enterStage(stageQueued, now)
+	assert.Equal(t, now.Add(time.Minute), *estimator.estimate(queued, now))
+
+	// The reload is blocked, estimates do not wait for it
+	later := now.Add(estimator.refresh)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, later.Add(time.Minute), *estimator.estimate(queued, later))
+	}
+}
+
+// TestRenderEstimatorWithoutHistory tests that no ETA is given before any render completes
+func TestRenderEstimatorWithoutHistory(t *testing.T) {
+	estimator := newRenderEstimator(newMemoryJobStore())
+
+	assert.Nil(t, estimator.estimate(&RenderJob{Status: "pending", Style: "bottom", VideoDuration: 30}, time.Now()))
+}
+
+// TestRenderJobStageAndETA tests that new jobs start queued and report an ETA
+func TestRenderJobStageAndETA(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.apiKey("acme")
+	ts.jobs.Put(completedRender("done-1", "bottom", 60, 2*time.Minute, time.Now().Add(-time.Hour)))
+
+	w := ts.do("POST", "/render-job", key, map[string]interface{}{"videoUrl": "https://example.com/v.mp4", "style": "bottom"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	job, _ := ts.jobs.Get(ts.queue.jobIDs[0])
+	assert.Equal(t, stageQueued, job.Stage)
+	assert.Contains(t, job.StageTimes, stageQueued)
+
+	// Without a probed upload there is no duration to estimate from
+	w = ts.do("GET", "/render-job/"+job.ID, key, nil)
+	assert.NotContains(t, w.Body.String(), `"eta"`)
+
+	job.VideoDuration = 30
+	ts.jobs.Put(job)
+	w = ts.do("GET", "/render-job/"+job.ID, key, nil)
+	assert.Contains(t, w.Body.String(), `"stage":"queued"`)
+	assert.Contains(t, w.Body.String(), `"eta"`)
+}
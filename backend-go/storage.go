@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StoredObject describes an object in storage
+type StoredObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ObjectStorage is the object store holding uploads, captions, transcripts and outputs
+type ObjectStorage interface {
+	// Put uploads an object and returns its URL
+	Put(ctx context.Context, key, contentType string, body io.Reader, metadata map[string]string) (string, error)
+	// Get downloads an object, reporting whether it exists
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Metadata returns the user-defined metadata stored with an object
+	Metadata(ctx context.Context, key string) (map[string]*string, error)
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every object under prefix
+	List(ctx context.Context, prefix string, fn func(obj StoredObject)) error
+	// PresignGet returns a time-limited download URL
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// URL returns the permanent URL of an object
+	URL(key string) string
+}
+
+// s3Storage stores objects in a single S3 bucket
+type s3Storage struct {
+	client *s3.S3
+	bucket string
+}
+
+func newS3Storage(client *s3.S3, bucket string) *s3Storage {
+	return &s3Storage{client: client, bucket: bucket}
+}
+
+// startSpan starts a client span for an S3 operation on key
+func (s *s3Storage) startSpan(ctx context.Context, operation, key string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "s3."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("aws.s3.bucket", s.bucket),
+		attribute.String("aws.s3.key", key),
+	))
+}
+
+// Put uploads data from an io.Reader to S3 bucket
+func (s *s3Storage) Put(ctx context.Context, key, contentType string, reader io.Reader, metadata map[string]string) (url string, err error) {
+	ctx, span := s.startSpan(ctx, "PutObject", key)
+	defer func() { endSpan(span, err) }()
+
+	// Seekable readers (e.g. multipart files) are streamed as-is,
+	// anything else is read into memory for upload
+	body, ok := reader.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return "", fmt.Errorf("failed to read data: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	_, err = s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+		Metadata:    aws.StringMap(metadata),
+	})
+	if err != nil {
+		s3ErrorsTotal.WithLabelValues("put").Inc()
+		return "", fmt.Errorf("failed to upload to S3: %v", err)
+	}
+
+	return s.URL(key), nil
+}
+
+// Get downloads an object from S3 bucket, reporting whether it exists
+func (s *s3Storage) Get(ctx context.Context, key string) (data []byte, found bool, err error) {
+	ctx, span := s.startSpan(ctx, "GetObject", key)
+	defer func() { endSpan(span, err) }()
+
+	result, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, false, nil
+		}
+		s3ErrorsTotal.WithLabelValues("get").Inc()
+		return nil, false, fmt.Errorf("failed to download from S3: %v", err)
+	}
+	defer result.Body.Close()
+
+	data, err = io.ReadAll(result.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read S3 object: %v", err)
+	}
+	return data, true, nil
+}
+
+// Metadata reads the user-defined metadata of an object
+func (s *s3Storage) Metadata(ctx context.Context, key string) (metadata map[string]*string, err error) {
+	ctx, span := s.startSpan(ctx, "HeadObject", key)
+	defer func() { endSpan(span, err) }()
+
+	head, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		s3ErrorsTotal.WithLabelValues("head").Inc()
+		return nil, fmt.Errorf("failed to read object metadata: %v", err)
+	}
+	return head.Metadata, nil
+}
+
+// Ping checks that the bucket exists and is reachable
+func (s *s3Storage) Ping(ctx context.Context) error {
+	_, err := s.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
+	return err
+}
+
+// Delete removes an object from S3 bucket
+func (s *s3Storage) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := s.startSpan(ctx, "DeleteObject", key)
+	defer func() { endSpan(span, err) }()
+
+	_, err = s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		s3ErrorsTotal.WithLabelValues("delete").Inc()
+		return fmt.Errorf("failed to delete from S3: %v", err)
+	}
+	return nil
+}
+
+// List calls fn for every object under prefix in S3 bucket
+func (s *s3Storage) List(ctx context.Context, prefix string, fn func(obj StoredObject)) (err error) {
+	ctx, span := s.startSpan(ctx, "ListObjectsV2", prefix)
+	defer func() { endSpan(span, err) }()
+
+	err = s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			fn(StoredObject{
+				Key:          aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				LastModified: aws.TimeValue(obj.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		s3ErrorsTotal.WithLabelValues("list").Inc()
+		return fmt.Errorf("failed to list S3 objects: %v", err)
+	}
+	return nil
+}
+
+// PresignGet generates a presigned URL for S3 object access
+func (s *s3Storage) PresignGet(ctx context.Context, key string, expiry time.Duration) (url string, err error) {
+	_, span := s.startSpan(ctx, "PresignGetObject", key)
+	defer func() { endSpan(span, err) }()
+
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	urlStr, err := req.Presign(expiry)
+	if err != nil {
+		s3ErrorsTotal.WithLabelValues("presign").Inc()
+		return "", fmt.Errorf("failed to generate presigned URL: %v", err)
+	}
+	return urlStr, nil
+}
+
+// URL returns the public URL of an S3 object
+func (s *s3Storage) URL(key string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, aws.StringValue(s.client.Config.Region), key)
+}
+
+// getMediaInfo reads the probed media metadata stored with an uploaded object
+func getMediaInfo(ctx context.Context, storage ObjectStorage, key string) (*MediaInfo, error) {
+	metadata, err := storage.Metadata(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return mediaInfoFromS3Metadata(metadata), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer returns the tracer for this service's spans from the current provider,
+// which records nothing until setupTracing installs an exporter
+func tracer() trace.Tracer {
+	return otel.Tracer("captioning-platform")
+}
+
+// TracingConfig selects where spans are exported
+type TracingConfig struct {
+	Endpoint    string  // OTLP/HTTP endpoint, tracing is off when empty
+	ServiceName string  // service.name resource attribute
+	SampleRatio float64 // fraction of new traces recorded, parents' decisions are kept
+}
+
+// loadTracingConfig reads the standard OTEL_* variables plus TRACE_SAMPLE_RATIO
+func loadTracingConfig(getenv configSource) (TracingConfig, error) {
+	cfg := TracingConfig{
+		Endpoint:    getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName: getenv("OTEL_SERVICE_NAME"),
+		SampleRatio: 1,
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "captioning-backend"
+	}
+	if raw := getenv("TRACE_SAMPLE_RATIO"); raw != "" {
+		ratio, err := strconv.ParseFloat(raw, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return cfg, fmt.Errorf("invalid TRACE_SAMPLE_RATIO %q, expected 0 to 1", raw)
+		}
+		cfg.SampleRatio = ratio
+	}
+	return cfg, nil
+}
+
+// setupTracing installs the W3C trace context propagator and, when an endpoint is
+// configured, an OTLP exporter. The returned function flushes pending spans.
+func setupTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// endSpan records a failed operation on span before ending it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		message := redactString(err.Error())
+		span.RecordError(fmt.Errorf("%s", message))
+		span.SetStatus(codes.Error, message)
+	}
+	span.End()
+}
+
+// injectTraceHeaders adds the traceparent of ctx to an outbound request
+func injectTraceHeaders(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// traceMessageAttributes carries the trace context of ctx as SQS message attributes
+func traceMessageAttributes(ctx context.Context) map[string]*sqs.MessageAttributeValue {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	attributes := map[string]*sqs.MessageAttributeValue{}
+	for key, value := range carrier {
+		attributes[key] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+	}
+	return attributes
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+// spanNames returns the names of the finished spans in the order they ended
+func spanNames(recorder *tracetest.SpanRecorder) []string {
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	return names
+}
+
+// TestLoadTracingConfig tests tracing defaults and sample ratio validation
+func TestLoadTracingConfig(t *testing.T) {
+	cfg, err := loadTracingConfig(mapSource(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "", cfg.Endpoint)
+	assert.Equal(t, "captioning-backend", cfg.ServiceName)
+	assert.Equal(t, 1.0, cfg.SampleRatio)
+
+	cfg, err = loadTracingConfig(mapSource(map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+		"OTEL_SERVICE_NAME":           "captioning-api",
+		"TRACE_SAMPLE_RATIO":          "0.25",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "http://collector:4318", cfg.Endpoint)
+	assert.Equal(t, "captioning-api", cfg.ServiceName)
+	assert.Equal(t, 0.25, cfg.SampleRatio)
+
+	_, err = loadTracingConfig(mapSource(map[string]string{"TRACE_SAMPLE_RATIO": "2"}))
+	assert.EqualError(t, err, `invalid TRACE_SAMPLE_RATIO "2", expected 0 to 1`)
+}
+
+// TestHandlerSpans tests that requests are traced by route
+func TestHandlerSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	ts := newTestServer(t)
+
+	w := ts.do("GET", "/health", "", nil)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"/health"}, spanNames(recorder))
+	assert.Equal(t, trace.SpanKindServer, recorder.Ended()[0].SpanKind())
+}
+
+// TestRenderPropagatesTraceContext tests that Remotion calls carry the render's trace
+func TestRenderPropagatesTraceContext(t *testing.T) {
+	recorder := recordSpans(t)
+	var mu sync.Mutex
+	traceparents := map[string]string{}
+	remotion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents[r.URL.Path] = r.Header.Get("traceparent")
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/render":
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "renderId": "render-1"})
+		case "/render/render-1":
+			json.NewEncoder(w).Encode(RenderStatus{RenderID: "render-1", Status: "completed", OutPath: "out/video_job-1.mp4"})
+		default:
+			w.Write([]byte("rendered video"))
+		}
+	}))
+	defer remotion.Close()
+	worker := newTestRenderWorker(remotion.URL)
+	worker.jobs.Put(&RenderJob{ID: "job-1", TenantID: "acme", Status: "pending", Style: "bottom"})
+
+	worker.processRenderJob(context.Background(), "job-1")
+
+	assert.Equal(t, []string{"remotion.render", "render.job"}, spanNames(recorder))
+	traceID := recorder.Ended()[1].SpanContext().TraceID().String()
+	assert.Contains(t, traceparents["/render"], traceID)
+	assert.Contains(t, traceparents["/render/render-1"], traceID)
+	assert.Contains(t, traceparents["/download/video_job-1.mp4"], traceID)
+}
+
+// TestMemoryJobQueueContinuesTrace tests that in-process renders join the enqueuing request's trace
+func TestMemoryJobQueueContinuesTrace(t *testing.T) {
+	recordSpans(t)
+	queue := newMemoryJobQueue(10, 3)
+	ctx, span := tracer().Start(context.Background(), "POST /render-job")
+	defer span.End()
+
+	assert.NoError(t, queue.Enqueue(ctx, &RenderJob{ID: "job-1"}))
+
+	lease, err := dequeueSoon(t, queue, time.Minute)
+	if assert.NoError(t, err) {
+		spanContext := trace.SpanContextFromContext(lease.Context(context.Background()))
+		assert.Equal(t, span.SpanContext().TraceID(), spanContext.TraceID())
+	}
+}
+
+// TestTraceMessageAttributes tests that SQS messages carry the W3C traceparent
+func TestTraceMessageAttributes(t *testing.T) {
+	recordSpans(t)
+	ctx, span := tracer().Start(context.Background(), "POST /render-job")
+	defer span.End()
+
+	attributes := traceMessageAttributes(ctx)
+
+	if assert.Contains(t, attributes, "traceparent") {
+		assert.Equal(t, "String", *attributes["traceparent"].DataType)
+		assert.Contains(t, *attributes["traceparent"].StringValue, span.SpanContext().TraceID().String())
+	}
+}
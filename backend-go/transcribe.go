@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transcriber turns the audio of a media URL into timed captions
+type Transcriber interface {
+	Transcribe(ctx context.Context, mediaURL string) ([]Caption, error)
+}
+
+// assemblyAITranscriber transcribes with the AssemblyAI API
+type assemblyAITranscriber struct {
+	apiKey  string
+	baseURL string
+}
+
+func newAssemblyAITranscriber(apiKey string) *assemblyAITranscriber {
+	return &assemblyAITranscriber{apiKey: apiKey, baseURL: "https://api.assemblyai.com/v2"}
+}
+
+// Transcribe requests a transcript, waits for it and converts the words to captions
+func (t *assemblyAITranscriber) Transcribe(ctx context.Context, mediaURL string) ([]Caption, error) {
+	transcriptID, err := t.requestTranscription(ctx, mediaURL)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+
+	transcript, err := t.pollTranscription(ctx, transcriptID)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertToCaptions(transcript.Words), nil
+}
+
+// requestTranscription starts a transcription job
+func (t *assemblyAITranscriber) requestTranscription(ctx context.Context, audioURL string) (_ string, err error) {
+	ctx, span := tracer().Start(ctx, "assemblyai.requestTranscription", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+
+	reqBody := AssemblyAITranscriptRequest{AudioURL: audioURL}
+	jsonData, _ := json.Marshal(reqBody)
+
+	req, err := t.newRequest(ctx, "POST", t.baseURL+"/transcript", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("content-type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var transcriptResp AssemblyAITranscriptResponse
+	if err := json.NewDecoder(resp.Body).Decode(&transcriptResp); err != nil {
+		return "", err
+	}
+
+	return transcriptResp.ID, nil
+}
+
+// pollTranscription polls until transcription is complete, with a timeout,
+// max attempts and exponential backoff
+func (t *assemblyAITranscriber) pollTranscription(ctx context.Context, transcriptID string) (_ *AssemblyAITranscriptResponse, err error) {
+	url := fmt.Sprintf("%s/transcript/%s", t.baseURL, transcriptID)
+	logger := loggerFrom(ctx).With("transcript_id", transcriptID)
+
+	ctx, span := tracer().Start(ctx, "assemblyai.pollTranscription", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("assemblyai.transcript_id", transcriptID)))
+	defer func() { endSpan(span, err) }()
+
+	// Create context with 10-minute timeout
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	maxAttempts := 40
+	backoff := 1 * time.Second
+
+	polls := 0
+	defer func() {
+		assemblyAIPollAttempts.Observe(float64(polls))
+		span.SetAttributes(attribute.Int("assemblyai.poll_attempts", polls))
+	}()
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		// Check if context is done
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, fmt.Errorf("transcription timed out after 10 minutes")
+			}
+			return nil, fmt.Errorf("transcription polling stopped: %v", ctx.Err())
+		default:
+		}
+
+		req, err := t.newRequest(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		client := &http.Client{Timeout: 30 * time.Second}
+		polls++
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var transcript AssemblyAITranscriptResponse
+		json.NewDecoder(resp.Body).Decode(&transcript)
+		resp.Body.Close()
+
+		logger.Debug("Polled transcription", "attempt", attempt+1, "status", transcript.Status)
+		if transcript.Status == "completed" {
+			return &transcript, nil
+		} else if transcript.Status == "error" {
+			return nil, fmt.Errorf("transcription failed")
+		}
+
+		// Exponential backoff: 1s → 2s → 4s → 8s → 16s → max 30s
+		select {
+		case <-ctx.Done(): // reported at the top of the loop
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+
+	return nil, fmt.Errorf("transcription timed out after %d attempts", maxAttempts)
+}
+
+// newRequest builds an authorized AssemblyAI request carrying the request ID
+func (t *assemblyAITranscriber) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("authorization", t.apiKey)
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	injectTraceHeaders(ctx, req.Header)
+	return req, nil
+}
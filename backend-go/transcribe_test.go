@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAssemblyAI serves the transcript endpoints with a fixed final status
+func fakeAssemblyAI(t *testing.T, status string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.Header.Get("authorization"))
+		assert.Equal(t, "req-123", r.Header.Get(requestIDHeader))
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/transcript":
+			var req AssemblyAITranscriptRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			assert.Equal(t, "https://media.example.com/a.mp4", req.AudioURL)
+			json.NewEncoder(w).Encode(map[string]string{"id": "tr-1", "status": "queued"})
+		case r.Method == "GET" && r.URL.Path == "/transcript/tr-1":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":     "tr-1",
+				"status": status,
+				"words": []map[string]interface{}{
+					{"text": "Hello", "start": 0, "end": 400},
+					{"text": "world", "start": 400, "end": 900},
+				},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// TestAssemblyAITranscriber tests requesting and polling a transcript
+func TestAssemblyAITranscriber(t *testing.T) {
+	server := fakeAssemblyAI(t, "completed")
+	defer server.Close()
+
+	transcriber := newAssemblyAITranscriber("test-key")
+	transcriber.baseURL = server.URL
+
+	captions, err := transcriber.Transcribe(withRequestID(context.Background(), "req-123"), "https://media.example.com/a.mp4")
+
+	assert.NoError(t, err)
+	assert.Len(t, captions, 1)
+	assert.Equal(t, "Hello world", captions[0].Text)
+	assert.Equal(t, 0.9, captions[0].End)
+}
+
+// TestAssemblyAITranscriberError tests that failed transcripts are reported
+func TestAssemblyAITranscriberError(t *testing.T) {
+	server := fakeAssemblyAI(t, "error")
+	defer server.Close()
+
+	transcriber := newAssemblyAITranscriber("test-key")
+	transcriber.baseURL = server.URL
+
+	_, err := transcriber.Transcribe(withRequestID(context.Background(), "req-123"), "https://media.example.com/a.mp4")
+
+	assert.EqualError(t, err, "transcription failed")
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+)
+
+// Usage is a tenant's metered consumption for one monthly period (YYYY-MM)
+type Usage struct {
+	TenantID          string  `json:"tenantId"`
+	Period            string  `json:"period"`
+	TranscribeSeconds float64 `json:"transcribeSeconds"`
+	RenderSeconds     float64 `json:"renderSeconds"`
+}
+
+// usageKind names a metered resource
+type usageKind string
+
+const (
+	usageTranscribe usageKind = "transcribeSeconds"
+	usageRender     usageKind = "renderSeconds"
+)
+
+// UsageStore accumulates metered usage per tenant and period
+type UsageStore interface {
+	Get(tenantID, period string) (*Usage, error)
+	Add(tenantID, period string, kind usageKind, seconds float64) error
+}
+
+// memoryUsageStore keeps usage in process memory
+type memoryUsageStore struct {
+	mu    sync.Mutex
+	usage map[string]*Usage
+}
+
+func newMemoryUsageStore() *memoryUsageStore {
+	return &memoryUsageStore{usage: make(map[string]*Usage)}
+}
+
+func (s *memoryUsageStore) Get(tenantID, period string) (*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if usage, ok := s.usage[tenantID+":"+period]; ok {
+		copied := *usage
+		return &copied, nil
+	}
+	return &Usage{TenantID: tenantID, Period: period}, nil
+}
+
+func (s *memoryUsageStore) Add(tenantID, period string, kind usageKind, seconds float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := tenantID + ":" + period
+	usage, ok := s.usage[key]
+	if !ok {
+		usage = &Usage{TenantID: tenantID, Period: period}
+		s.usage[key] = usage
+	}
+	switch kind {
+	case usageTranscribe:
+		usage.TranscribeSeconds += seconds
+	case usageRender:
+		usage.RenderSeconds += seconds
+	}
+	return nil
+}
+
+// dynamoUsageStore keeps usage counters in the jobs table under "usage:<tenant>:<period>" items
+type dynamoUsageStore struct {
+	client *dynamodb.DynamoDB
+	table  string
+}
+
+func usageItemID(tenantID, period string) string {
+	return fmt.Sprintf("usage:%s:%s", tenantID, period)
+}
+
+func (s *dynamoUsageStore) Get(tenantID, period string) (*Usage, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"jobId": {S: aws.String(usageItemID(tenantID, period))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	usage := &Usage{TenantID: tenantID, Period: period}
+	if v := result.Item[string(usageTranscribe)]; v != nil && v.N != nil {
+		usage.TranscribeSeconds, _ = strconv.ParseFloat(*v.N, 64)
+	}
+	if v := result.Item[string(usageRender)]; v != nil && v.N != nil {
+		usage.RenderSeconds, _ = strconv.ParseFloat(*v.N, 64)
+	}
+	return usage, nil
+}
+
+func (s *dynamoUsageStore) Add(tenantID, period string, kind usageKind, seconds float64) error {
+	_, err := s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"jobId": {S: aws.String(usageItemID(tenantID, period))},
+		},
+		UpdateExpression: aws.String("ADD #kind :seconds"),
+		ExpressionAttributeNames: map[string]*string{
+			"#kind": aws.String(string(kind)),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":seconds": {N: aws.String(strconv.FormatFloat(seconds, 'f', 3, 64))},
+		},
+	})
+	return err
+}
+
+// Quotas are monthly per-tenant limits in minutes; zero means unlimited
+type Quotas struct {
+	TranscribeMinutes float64
+	RenderMinutes     float64
+}
+
+// loadQuotas reads QUOTA_TRANSCRIBE_MINUTES and QUOTA_RENDER_MINUTES
+func loadQuotas(getenv configSource) (Quotas, error) {
+	var q Quotas
+	for _, entry := range []struct {
+		env    string
+		target *float64
+	}{
+		{"QUOTA_TRANSCRIBE_MINUTES", &q.TranscribeMinutes},
+		{"QUOTA_RENDER_MINUTES", &q.RenderMinutes},
+	} {
+		raw := getenv(entry.env)
+		if raw == "" {
+			continue
+		}
+		minutes, err := strconv.ParseFloat(raw, 64)
+		if err != nil || minutes < 0 {
+			return q, fmt.Errorf("invalid %s %q", entry.env, raw)
+		}
+		*entry.target = minutes
+	}
+	return q, nil
+}
+
+// limitMinutes returns the quota for a usage kind
+func (q Quotas) limitMinutes(kind usageKind) float64 {
+	if kind == usageTranscribe {
+		return q.TranscribeMinutes
+	}
+	return q.RenderMinutes
+}
+
+// usagePeriod is the monthly billing period containing t
+func usagePeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// nextPeriodStart is when the quota for the period containing t resets
+func nextPeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// usedSeconds returns the recorded seconds of a usage kind
+func (u *Usage) usedSeconds(kind usageKind) float64 {
+	if kind == usageTranscribe {
+		return u.TranscribeSeconds
+	}
+	return u.RenderSeconds
+}
+
+// checkQuota rejects the request with 429 when consuming seconds would exceed the tenant's quota
+func (s *Server) checkQuota(c *gin.Context, kind usageKind, seconds float64) bool {
+	limit := s.cfg.Quotas.limitMinutes(kind)
+	if limit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	usage, err := s.Usage.Get(requestTenant(c), usagePeriod(now))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read usage"})
+		return false
+	}
+	if (usage.usedSeconds(kind)+seconds)/60 > limit {
+		c.Header("Retry-After", retryAfterSeconds(nextPeriodStart(now).Sub(now)))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("Monthly %s quota of %.0f minutes exceeded", quotaName(kind), limit)})
+		return false
+	}
+	return true
+}
+
+// recordUsage adds consumed seconds to the tenant's current period
+func (s *Server) recordUsage(tenantID string, kind usageKind, seconds float64) error {
+	if seconds <= 0 {
+		return nil
+	}
+	return s.Usage.Add(tenantID, usagePeriod(time.Now()), kind, seconds)
+}
+
+func quotaName(kind usageKind) string {
+	if kind == usageTranscribe {
+		return "transcription"
+	}
+	return "render"
+}
+
+// usageHandler handles GET /usage, reporting the caller's consumption against quotas
+func (s *Server) usageHandler(c *gin.Context) {
+	limits := s.cfg.RateLimits
+	now := time.Now()
+	usage, err := s.Usage.Get(requestTenant(c), usagePeriod(now))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read usage"})
+		return
+	}
+
+	describe := func(kind usageKind) gin.H {
+		return gin.H{
+			"usedMinutes":  usage.usedSeconds(kind) / 60,
+			"limitMinutes": s.cfg.Quotas.limitMinutes(kind),
+		}
+	}
+	rateLimits := gin.H{}
+	for name, limit := range map[string]*RateLimit{"upload": limits.Upload, "transcribe": limits.Transcribe, "render": limits.Render} {
+		if limit != nil {
+			rateLimits[name] = gin.H{"requests": limit.Burst, "per": limit.Period.String()}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenantId":   usage.TenantID,
+		"period":     usage.Period,
+		"resetsAt":   nextPeriodStart(now),
+		"transcribe": describe(usageTranscribe),
+		"render":     describe(usageRender),
+		"rateLimits": rateLimits,
+	})
+}
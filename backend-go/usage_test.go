@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNextPeriodStart tests monthly quota reset times
+func TestNextPeriodStart(t *testing.T) {
+	now := time.Date(2024, 12, 15, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2024-12", usagePeriod(now))
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nextPeriodStart(now))
+}
+
+// TestCheckQuota tests that exceeding monthly minutes returns 429 with Retry-After and
+// that uploads of unknown duration are refused
+func TestCheckQuota(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.Quotas = Quotas{TranscribeMinutes: 10} })
+	// The test video is 10 seconds long
+	ts.server.recordUsage("acme", usageTranscribe, 590)
+	ts.server.recordUsage("globex", usageTranscribe, 595)
+
+	transcribe := func(tenant string) *httptest.ResponseRecorder {
+		key := ts.apiKey(tenant)
+		var uploaded struct {
+			S3Key string `json:"s3Key"`
+		}
+		json.Unmarshal(ts.upload(key, "video", "talk.mp4", testVideo()).Body.Bytes(), &uploaded)
+		return ts.do("POST", "/transcribe", key, map[string]string{"s3Key": uploaded.S3Key})
+	}
+
+	assert.Equal(t, http.StatusOK, transcribe("acme").Code)
+
+	w := transcribe("globex")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Uploads without a known duration would not be charged
+	w = ts.do("POST", "/transcribe", ts.apiKey("acme"), map[string]string{"s3Key": "uploads/acme/unprobed.mp4"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, 1, ts.transcriber.calls)
+}
+
+// TestRenderQuota tests that renders are charged by source duration and that sources
+// without one are refused while a render quota is set
+func TestRenderQuota(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.Quotas = Quotas{RenderMinutes: 15} })
+	ts.assets.Put(&Asset{ID: "a1", Owner: "acme", S3Key: "uploads/acme/a1.mp4", Media: &MediaInfo{Duration: 600, HasAudio: true}})
+	key := ts.apiKey("acme")
+
+	w := ts.do("POST", "/render-job", key, map[string]interface{}{"s3Key": "uploads/acme/a1.mp4"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = ts.do("POST", "/render-job", key, map[string]interface{}{"s3Key": "uploads/acme/a1.mp4"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	for _, body := range []map[string]interface{}{
+		{"videoUrl": "https://example.com/v.mp4"},
+		{"s3Key": "uploads/acme/unprobed.mp4"},
+	} {
+		w = ts.do("POST", "/render-job", key, body)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+	}
+	assert.Len(t, ts.queue.jobIDs, 1)
+}
+
+// TestUsageHandler tests GET /usage
+func TestUsageHandler(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Quotas = Quotas{RenderMinutes: 100}
+		cfg.RateLimits = RateLimits{Upload: &RateLimit{Burst: 30, Period: time.Minute}}
+	})
+	keys := useTestTenants(ts, "acme")
+	ts.server.recordUsage("acme", usageRender, 90)
+	ts.server.recordUsage("acme", usageTranscribe, 30)
+
+	router := ts.router
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/usage", nil)
+	req.Header.Set("X-API-Key", keys["acme"])
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		TenantID string `json:"tenantId"`
+		Render   struct {
+			UsedMinutes  float64 `json:"usedMinutes"`
+			LimitMinutes float64 `json:"limitMinutes"`
+		} `json:"render"`
+		Transcribe struct {
+			UsedMinutes float64 `json:"usedMinutes"`
+		} `json:"transcribe"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", response.TenantID)
+	assert.Equal(t, 1.5, response.Render.UsedMinutes)
+	assert.Equal(t, 100.0, response.Render.LimitMinutes)
+	assert.Equal(t, 0.5, response.Transcribe.UsedMinutes)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WorkerConfig controls the render worker, run in-process for the memory queue and
+// by `main worker` for SQS and Redis
+type WorkerConfig struct {
+	Concurrency  int           // jobs rendered at once
+	LeaseTimeout time.Duration // how long a dequeued job stays leased, extended while it renders
+}
+
+// loadWorkerConfig reads WORKER_CONCURRENCY and WORKER_LEASE_TIMEOUT
+func loadWorkerConfig(getenv configSource) (WorkerConfig, error) {
+	cfg := WorkerConfig{Concurrency: 1, LeaseTimeout: 5 * time.Minute}
+
+	var errs []error
+	if raw := getenv("WORKER_CONCURRENCY"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("invalid WORKER_CONCURRENCY %q, expected a positive integer", raw))
+		} else {
+			cfg.Concurrency = n
+		}
+	}
+	if raw := getenv("WORKER_LEASE_TIMEOUT"); raw != "" {
+		// SQS visibility timeouts are whole seconds up to 12 hours
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second || d > 12*time.Hour {
+			errs = append(errs, fmt.Errorf("invalid WORKER_LEASE_TIMEOUT %q, expected 1s to 12h", raw))
+		} else {
+			cfg.LeaseTimeout = d
+		}
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// queueWorker dequeues render jobs and runs each through process. A job is acked once it
+// completed or failed permanently; jobs that failed transiently are left for their lease
+// to expire and are delivered again until the queue dead-letters them, interrupted ones
+// are handed back right away.
+type queueWorker struct {
+	queue     JobQueue
+	cfg       WorkerConfig
+	jobs      JobStore
+	process   func(ctx context.Context, jobID string) error
+	heartbeat time.Duration // how often the lease is extended during a render
+
+	pollCtx    context.Context
+	stopPolls  context.CancelFunc
+	jobCtx     context.Context
+	cancelJobs context.CancelFunc
+	running    sync.WaitGroup
+}
+
+func newQueueWorker(queue JobQueue, cfg WorkerConfig, jobs JobStore, process func(ctx context.Context, jobID string) error) *queueWorker {
+	w := &queueWorker{
+		queue:     queue,
+		cfg:       cfg,
+		jobs:      jobs,
+		process:   process,
+		heartbeat: cfg.LeaseTimeout / 2,
+	}
+	w.pollCtx, w.stopPolls = context.WithCancel(context.Background())
+	w.jobCtx, w.cancelJobs = context.WithCancel(context.Background())
+	return w
+}
+
+// Start runs Concurrency pollers until Close or until the queue is closed
+func (w *queueWorker) Start() {
+	for i := 0; i < w.cfg.Concurrency; i++ {
+		w.running.Add(1)
+		go func() {
+			defer w.running.Done()
+			for w.pollCtx.Err() == nil {
+				err := w.poll(w.pollCtx)
+				if errors.Is(err, errQueueClosed) {
+					return
+				}
+				if err != nil && w.pollCtx.Err() == nil {
+					// Queue unreachable or throttling, don't spin
+					loggerFrom(w.pollCtx).Warn("Failed to dequeue render jobs", "error", err)
+					select {
+					case <-w.pollCtx.Done():
+					case <-time.After(5 * time.Second):
+					}
+				}
+			}
+		}()
+	}
+}
+
+// Close stops dequeuing and waits for running jobs. Jobs still running when ctx is
+// done are cancelled and get interruptGrace to mark themselves requeueable.
+func (w *queueWorker) Close(ctx context.Context) error {
+	w.stopPolls()
+
+	done := make(chan struct{})
+	go func() {
+		w.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	w.cancelJobs()
+	select {
+	case <-done:
+	case <-time.After(interruptGrace):
+	}
+	return fmt.Errorf("render jobs interrupted: %v", ctx.Err())
+}
+
+// poll waits for one job and handles it
+func (w *queueWorker) poll(ctx context.Context) error {
+	lease, err := w.queue.Dequeue(ctx, w.cfg.LeaseTimeout)
+	if err != nil {
+		return err
+	}
+	w.handle(lease)
+	return nil
+}
+
+// handle renders the leased job and settles the lease according to the job's outcome
+func (w *queueWorker) handle(lease *Lease) {
+	// Continue the trace of the request that queued the job
+	ctx := lease.Context(w.jobCtx)
+	logger := loggerFrom(ctx).With("job_id", lease.JobID, "deliveries", lease.Deliveries)
+
+	// A duplicate delivery of a job another worker already finished
+	if job, err := w.jobs.Get(lease.JobID); err == nil && job.Status == "completed" {
+		w.ack(ctx, lease)
+		return
+	}
+
+	stopHeartbeat := w.keepLeased(ctx, lease)
+	renderErr := w.process(ctx, lease.JobID)
+	stopHeartbeat()
+
+	job, err := w.jobs.Get(lease.JobID)
+	switch {
+	case err != nil:
+		logger.Error("Job could not be loaded after rendering", "error", err)
+	case job.Status == "completed":
+		w.ack(ctx, lease)
+	case job.Status == "requeueable":
+		if err := w.queue.Nack(context.WithoutCancel(ctx), lease, 0); err != nil {
+			logger.Warn("Failed to release render job", "error", err)
+		}
+		logger.Info("Render interrupted, job released for another worker")
+	case job.Status == "failed":
+		// Permanent or out of attempts, a manual retry queues it afresh
+		w.ack(ctx, lease)
+		logger.Warn("Render failed, job removed from the queue", "error", renderErr)
+	default:
+		logger.Warn("Render failed, job left for redelivery", "status", job.Status)
+	}
+}
+
+// keepLeased extends the lease every heartbeat until the returned function is called
+func (w *queueWorker) keepLeased(ctx context.Context, lease *Lease) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(w.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := w.queue.Extend(context.WithoutCancel(ctx), lease, w.cfg.LeaseTimeout); err != nil {
+					loggerFrom(ctx).Warn("Failed to extend render job lease", "job_id", lease.JobID, "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func (w *queueWorker) ack(ctx context.Context, lease *Lease) {
+	if err := w.queue.Ack(context.WithoutCancel(ctx), lease); err != nil {
+		// Delivered again later and acked then, the job is already completed
+		loggerFrom(ctx).Warn("Failed to ack render job", "job_id", lease.JobID, "error", err)
+	}
+}
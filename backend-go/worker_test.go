@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testWorkerConfig = WorkerConfig{Concurrency: 1, LeaseTimeout: time.Minute}
+
+// queueJob puts the message sqsJobQueue would send for job on the fake render queue
+func queueJob(t *testing.T, client *fakeSQS, job *RenderJob) {
+	assert.NoError(t, testSQSQueue(client).Enqueue(context.Background(), job))
+}
+
+func testSQSQueue(client *fakeSQS) *sqsJobQueue {
+	return &sqsJobQueue{client: client, url: testQueueURL}
+}
+
+// setStatus returns a process function that leaves jobs with status, failing with err
+func setStatus(jobs JobStore, status string, err error) func(ctx context.Context, jobID string) error {
+	return func(ctx context.Context, jobID string) error {
+		job, _ := jobs.Get(jobID)
+		job.Status = status
+		jobs.Put(job)
+		return err
+	}
+}
+
+// TestQueueWorkerRendersJob tests that a queued job goes through the render pipeline and its message is deleted
+func TestQueueWorkerRendersJob(t *testing.T) {
+	remotion := fakeRemotion(t, true)
+	defer remotion.Close()
+	renders := newTestRenderWorker(remotion.URL)
+	client := newFakeSQS()
+	job := &RenderJob{ID: "job-1", TenantID: "acme", Status: "pending", S3Key: "uploads/acme/a1.mp4", RequestID: "req-123"}
+	renders.jobs.Put(job)
+	queueJob(t, client, job)
+	worker := newQueueWorker(testSQSQueue(client), testWorkerConfig, renders.jobs, renders.processRenderJob)
+
+	assert.NoError(t, worker.poll(context.Background()))
+
+	job, _ = renders.jobs.Get("job-1")
+	assert.Equal(t, "completed", job.Status)
+	assert.Empty(t, client.bodies(testQueueURL))
+}
+
+// TestQueueWorkerAcksPermanentFailures tests that a render Remotion gave up on is not delivered again
+func TestQueueWorkerAcksPermanentFailures(t *testing.T) {
+	remotion := fakeRemotion(t, false)
+	defer remotion.Close()
+	renders := newTestRenderWorker(remotion.URL)
+	client := newFakeSQS()
+	job := &RenderJob{ID: "job-1", TenantID: "acme", Status: "pending", S3Key: "uploads/acme/a1.mp4", RequestID: "req-123"}
+	renders.jobs.Put(job)
+	queueJob(t, client, job)
+	worker := newQueueWorker(testSQSQueue(client), testWorkerConfig, renders.jobs, renders.processRenderJob)
+
+	worker.poll(context.Background())
+
+	job, _ = renders.jobs.Get("job-1")
+	assert.Equal(t, "failed", job.Status)
+	assert.Empty(t, client.bodies(testQueueURL))
+}
+
+// TestQueueWorkerAcksExhaustedRetries tests that a job that ran out of attempts on
+// transient errors is not delivered again next to a manual retry
+func TestQueueWorkerAcksExhaustedRetries(t *testing.T) {
+	client := newFakeSQS()
+	jobs := newMemoryJobStore()
+	job := &RenderJob{ID: "job-1", TenantID: "acme", Status: "pending"}
+	jobs.Put(job)
+	queueJob(t, client, job)
+	unavailable := &RemotionError{StatusCode: http.StatusServiceUnavailable, Message: "busy", Transient: true}
+	worker := newQueueWorker(testSQSQueue(client), testWorkerConfig, jobs, setStatus(jobs, "failed", unavailable))
+
+	worker.poll(context.Background())
+
+	assert.Empty(t, client.bodies(testQueueURL))
+}
+
+// TestQueueWorkerReleasesInterruptedJobs tests that a job interrupted by shutdown is handed straight back
+func TestQueueWorkerReleasesInterruptedJobs(t *testing.T) {
+	client := newFakeSQS()
+	jobs := newMemoryJobStore()
+	job := &RenderJob{ID: "job-1", TenantID: "acme", Status: "pending"}
+	jobs.Put(job)
+	queueJob(t, client, job)
+	worker := newQueueWorker(testSQSQueue(client), testWorkerConfig, jobs, setStatus(jobs, "requeueable", context.Canceled))
+
+	worker.poll(context.Background())
+
+	assert.Equal(t, 1, client.visible(testQueueURL))
+}
+
+// TestQueueWorkerExtendsVisibility tests that long renders keep their message hidden
+func TestQueueWorkerExtendsVisibility(t *testing.T) {
+	client := newFakeSQS()
+	jobs := newMemoryJobStore()
+	job := &RenderJob{ID: "job-1", TenantID: "acme", Status: "pending"}
+	jobs.Put(job)
+	queueJob(t, client, job)
+	complete := setStatus(jobs, "completed", nil)
+	worker := newQueueWorker(testSQSQueue(client), testWorkerConfig, jobs, func(ctx context.Context, jobID string) error {
+		time.Sleep(50 * time.Millisecond)
+		return complete(ctx, jobID)
+	})
+	worker.heartbeat = 10 * time.Millisecond
+
+	worker.poll(context.Background())
+
+	assert.GreaterOrEqual(t, client.visibilityChanges, 2)
+	assert.Empty(t, client.bodies(testQueueURL))
+}
+
+// TestQueueWorkerSkipsCompletedJobs tests that duplicate deliveries of finished jobs are only deleted
+func TestQueueWorkerSkipsCompletedJobs(t *testing.T) {
+	client := newFakeSQS()
+	jobs := newMemoryJobStore()
+	job := &RenderJob{ID: "job-1", TenantID: "acme", Status: "completed"}
+	jobs.Put(job)
+	queueJob(t, client, job)
+	worker := newQueueWorker(testSQSQueue(client), testWorkerConfig, jobs, func(ctx context.Context, jobID string) error {
+		t.Errorf("job %s rendered again", jobID)
+		return nil
+	})
+
+	worker.poll(context.Background())
+
+	assert.Empty(t, client.bodies(testQueueURL))
+}
+
+// TestQueueWorkerMalformedMessage tests that SQS messages without a job are left for the dead-letter queue
+func TestQueueWorkerMalformedMessage(t *testing.T) {
+	client := newFakeSQS()
+	body, _ := json.Marshal(map[string]string{"style": "bottom"})
+	client.add(testQueueURL, string(body), nil)
+	worker := newQueueWorker(testSQSQueue(client), testWorkerConfig, newMemoryJobStore(), func(ctx context.Context, jobID string) error {
+		t.Errorf("job %q rendered", jobID)
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, worker.poll(ctx), context.DeadlineExceeded)
+
+	assert.Len(t, client.bodies(testQueueURL), 1)
+}
+
+// TestQueueWorkerStartClose tests polling in the background until Close
+func TestQueueWorkerStartClose(t *testing.T) {
+	client := newFakeSQS()
+	jobs := newMemoryJobStore()
+	worker := newQueueWorker(testSQSQueue(client), WorkerConfig{Concurrency: 2, LeaseTimeout: time.Minute}, jobs, setStatus(jobs, "completed", nil))
+	worker.Start()
+
+	job := &RenderJob{ID: "job-1", TenantID: "acme", Status: "pending"}
+	jobs.Put(job)
+	queueJob(t, client, job)
+	assert.Eventually(t, func() bool { return len(client.bodies(testQueueURL)) == 0 }, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, worker.Close(ctx))
+}
+
+// TestQueueWorkerStopsWhenQueueCloses tests that pollers exit once the memory queue is closed
+func TestQueueWorkerStopsWhenQueueCloses(t *testing.T) {
+	queue := newMemoryJobQueue(10, 3)
+	jobs := newMemoryJobStore()
+	worker := newQueueWorker(queue, testWorkerConfig, jobs, setStatus(jobs, "completed", nil))
+	worker.Start()
+
+	job := &RenderJob{ID: "job-1", TenantID: "acme", Status: "pending"}
+	jobs.Put(job)
+	assert.NoError(t, queue.Enqueue(context.Background(), job))
+	assert.Eventually(t, func() bool {
+		depth, _ := queue.Depth()
+		return depth == 0
+	}, 2*time.Second, 5*time.Millisecond)
+
+	queue.Close(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pollers kept running after the queue closed")
+	}
+}
+
+// TestLoadWorkerConfig tests worker defaults and validation
+func TestLoadWorkerConfig(t *testing.T) {
+	cfg, err := loadWorkerConfig(mapSource(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, WorkerConfig{Concurrency: 1, LeaseTimeout: 5 * time.Minute}, cfg)
+
+	cfg, err = loadWorkerConfig(mapSource(map[string]string{"WORKER_CONCURRENCY": "4", "WORKER_LEASE_TIMEOUT": "90s"}))
+	assert.NoError(t, err)
+	assert.Equal(t, WorkerConfig{Concurrency: 4, LeaseTimeout: 90 * time.Second}, cfg)
+
+	_, err = loadWorkerConfig(mapSource(map[string]string{"WORKER_CONCURRENCY": "0", "WORKER_LEASE_TIMEOUT": "13h"}))
+	assert.EqualError(t, err, "invalid WORKER_CONCURRENCY \"0\", expected a positive integer\ninvalid WORKER_LEASE_TIMEOUT \"13h\", expected 1s to 12h")
+}
@@ -4,18 +4,40 @@ const http = require("http");
 
 const dynamodb = new AWS.DynamoDB.DocumentClient();
 const s3 = new AWS.S3();
+const sqs = new AWS.SQS();
 
 const DYNAMODB_TABLE = process.env.DYNAMODB_TABLE;
 const S3_BUCKET = process.env.S3_BUCKET;
 const REMOTION_URL = process.env.REMOTION_URL || "http://remotion-service:3000";
 const RENDER_API_KEY = process.env.RENDER_API_KEY;
+// Deliveries before SQS moves a message to the dead-letter queue
+const MAX_RECEIVE_COUNT = Number(process.env.MAX_RECEIVE_COUNT || 3);
+// Longest delay SQS accepts on a message, in seconds
+const MAX_SQS_DELAY = 900;
 
 exports.handler = async (event) => {
   console.log("Received event:", JSON.stringify(event, null, 2));
 
+  // Failed messages go back to the queue and are dead-lettered after MAX_RECEIVE_COUNT deliveries
+  const batchItemFailures = [];
+
   for (const record of event.Records) {
     const message = JSON.parse(record.body);
-    const { jobId, videoUrl, captions, style, s3Key } = message;
+    const { jobId, videoUrl, captions, style, s3Key, tenantId, scheduledAt } =
+      message;
+
+    // Scheduled further out than SQS can delay a message, send it again until due
+    const untilDue = scheduledAt ? Date.parse(scheduledAt) - Date.now() : 0;
+    if (untilDue >= 1000) {
+      try {
+        await postpone(record, untilDue);
+        console.log(`Job ${jobId} postponed until ${scheduledAt}`);
+      } catch (error) {
+        console.error(`Failed to postpone job ${jobId}:`, error);
+        batchItemFailures.push({ itemIdentifier: record.messageId });
+      }
+      continue;
+    }
 
     console.log(`Processing job ${jobId}`);
 
@@ -48,7 +70,7 @@ exports.handler = async (event) => {
       const videoBuffer = await downloadVideo(renderResult.downloadUrl);
 
       // Upload to S3
-      const outputKey = `output/video_${jobId}.mp4`;
+      const outputKey = `output/${tenantId}/video_${jobId}.mp4`;
       await uploadToS3(videoBuffer, outputKey);
 
       // Generate presigned URL
@@ -59,14 +81,51 @@ exports.handler = async (event) => {
 
       console.log(`Job ${jobId} completed successfully`);
     } catch (error) {
-      console.error(`Job ${jobId} failed:`, error);
-      await updateJobStatus(jobId, "failed", null, error.message);
+      const receiveCount = Number(record.attributes.ApproximateReceiveCount || 1);
+      const final = receiveCount >= MAX_RECEIVE_COUNT;
+      console.error(
+        `Job ${jobId} failed (delivery ${receiveCount} of ${MAX_RECEIVE_COUNT}):`,
+        error
+      );
+      if (final) {
+        await updateJobStatus(jobId, "failed", null, error.message);
+      } else {
+        await updateJobStatus(
+          jobId,
+          "pending",
+          null,
+          `Attempt ${receiveCount} failed, retrying: ${error.message}`
+        );
+      }
+      batchItemFailures.push({ itemIdentifier: record.messageId });
     }
   }
 
-  return { statusCode: 200, body: "Processing complete" };
+  return { batchItemFailures };
 };
 
+// Send a copy of record back to its queue, delayed by up to MAX_SQS_DELAY
+async function postpone(record, untilDue) {
+  // arn:aws:sqs:region:account:name
+  const [, , , , account, queueName] = record.eventSourceARN.split(":");
+  const { QueueUrl } = await sqs
+    .getQueueUrl({ QueueName: queueName, QueueOwnerAWSAccountId: account })
+    .promise();
+
+  const attributes = {};
+  for (const [key, value] of Object.entries(record.messageAttributes || {})) {
+    attributes[key] = { DataType: value.dataType, StringValue: value.stringValue };
+  }
+  await sqs
+    .sendMessage({
+      QueueUrl,
+      MessageBody: record.body,
+      MessageAttributes: attributes,
+      DelaySeconds: Math.min(Math.ceil(untilDue / 1000), MAX_SQS_DELAY),
+    })
+    .promise();
+}
+
 async function updateJobStatus(jobId, status, outputUrl = null, error = null) {
   const params = {
     TableName: DYNAMODB_TABLE,
@@ -17,11 +17,67 @@ if (!fs.existsSync(outDir)) {
   fs.mkdirSync(outDir, { recursive: true });
 }
 
+// Renders started with { async: true }, kept for status polling until an hour after they finish
+const renders = new Map();
+const RENDER_RETENTION_MS = 60 * 60 * 1000;
+
+/**
+ * Reads render progress (0-99) from Remotion CLI output such as "Rendered 120/300"
+ * and "Encoded 40/300". Frame rendering counts for 90%, encoding for the rest.
+ */
+function parseProgress(output) {
+  const matches = [...output.matchAll(/(Rendered|Encoded)\s+(\d+)\/(\d+)/g)];
+  if (matches.length === 0) {
+    return null;
+  }
+  const [, phase, done, total] = matches[matches.length - 1];
+  const ratio = Math.min(Number(done) / Math.max(Number(total), 1), 1);
+  return Math.floor(phase === "Rendered" ? ratio * 90 : 90 + ratio * 9);
+}
+
+/**
+ * Public view of a render, as returned by GET /render/:id and sent to callbacks
+ */
+function renderStatus(render) {
+  return {
+    renderId: render.id,
+    status: render.status,
+    progress: render.progress,
+    outPath: render.status === "completed" ? render.outPath : undefined,
+    error: render.error || undefined,
+  };
+}
+
+/**
+ * POSTs the render's status to its callback URL, at most every 2s while rendering
+ */
+async function notifyCallback(render, final) {
+  if (!render.callbackUrl || (!final && Date.now() - render.notifiedAt < 2000)) {
+    return;
+  }
+  render.notifiedAt = Date.now();
+  try {
+    await fetch(render.callbackUrl, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        "x-api-key": process.env.RENDER_API_KEY || "",
+        ...(render.traceparent && { traceparent: render.traceparent }),
+      },
+      body: JSON.stringify(renderStatus(render)),
+    });
+  } catch (err) {
+    console.error(`Render ${render.id} callback failed:`, err.message);
+  }
+}
+
 /**
  * POST /render
- * Accepts: { videoUrl, captions, style, outPath }
+ * Accepts: { videoUrl, captions, style, outPath, async, callbackUrl }
  * Runs: npx remotion render src/index.tsx CaptionedVideo <outPath> --props-file <file>
- * Returns: { success, outPath, logs }
+ * Returns: { success, outPath, logs } once rendered, or with async set,
+ * 202 { success, renderId, statusUrl } immediately. callbackUrl receives
+ * the same body as GET /render/:id as the render progresses.
  */
 app.post("/render", async (req, res) => {
   // FIX #5: Simple authentication
@@ -35,7 +91,8 @@ app.post("/render", async (req, res) => {
     });
   }
 
-  const { videoUrl, captions, style, outPath } = req.body;
+  const { videoUrl, captions, style, outPath, callbackUrl } = req.body;
+  const isAsync = req.body.async === true;
 
   if (!videoUrl || !captions || !style) {
     return res.status(400).json({
@@ -160,11 +217,61 @@ app.post("/render", async (req, res) => {
 
   let logs = "";
 
+  const render = {
+    id: path.basename(outputPath, path.extname(outputPath)) + "-" + Date.now(),
+    status: "rendering",
+    progress: 0,
+    outPath: outputPath,
+    error: null,
+    callbackUrl,
+    traceparent: req.headers.traceparent,
+    notifiedAt: 0,
+  };
+  if (isAsync) {
+    renders.set(render.id, render);
+    res.status(202).json({
+      success: true,
+      renderId: render.id,
+      statusUrl: `/render/${render.id}`,
+    });
+  }
+
+  // Finish the render once, answering the request or updating the stored status
+  let finished = false;
+  const finish = (error) => {
+    if (finished) {
+      return;
+    }
+    finished = true;
+    render.status = error ? "failed" : "completed";
+    render.progress = error ? render.progress : 100;
+    render.error = error;
+    if (isAsync) {
+      notifyCallback(render, true);
+      setTimeout(() => renders.delete(render.id), RENDER_RETENTION_MS).unref();
+    } else if (error) {
+      res.status(500).json({ success: false, error, logs });
+    } else {
+      res.json({
+        success: true,
+        outPath: outputPath,
+        outUrl: `/download/${path.basename(outputPath)}`,
+        logs,
+      });
+    }
+  };
+
   // Capture stdout
   renderProcess.stdout.on("data", (data) => {
     const message = data.toString();
     logs += message;
     console.log(message);
+
+    const progress = parseProgress(message);
+    if (progress !== null && progress > render.progress) {
+      render.progress = progress;
+      notifyCallback(render, false);
+    }
   });
 
   // Capture stderr
@@ -187,19 +294,10 @@ app.post("/render", async (req, res) => {
 
     if (code === 0) {
       console.log("Render completed successfully");
-      res.json({
-        success: true,
-        outPath: outputPath,
-        outUrl: `/download/${path.basename(outputPath)}`,
-        logs,
-      });
+      finish(null);
     } else {
       console.error("Render failed with code:", code);
-      res.status(500).json({
-        success: false,
-        error: `Render process exited with code ${code}`,
-        logs,
-      });
+      finish(`Render process exited with code ${code}`);
     }
   });
 
@@ -215,12 +313,28 @@ app.post("/render", async (req, res) => {
     console.log("Props file kept for debugging:", propsFile);
 
     console.error("Render process error:", error);
-    res.status(500).json({
+    finish(error.message);
+  });
+});
+
+/**
+ * GET /render/:id
+ * Returns: { renderId, status (rendering, completed, failed), progress, outPath, error }
+ */
+app.get("/render/:id", (req, res) => {
+  const expectedKey = process.env.RENDER_API_KEY;
+  if (expectedKey && req.headers["x-api-key"] !== expectedKey) {
+    return res.status(401).json({
       success: false,
-      error: error.message,
-      logs,
+      error: "Unauthorized: Invalid or missing API key",
     });
-  });
+  }
+
+  const render = renders.get(req.params.id);
+  if (!render) {
+    return res.status(404).json({ success: false, error: "Render not found" });
+  }
+  res.json(renderStatus(render));
 });
 
 /**
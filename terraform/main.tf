@@ -5,12 +5,49 @@ resource "aws_sqs_queue" "render_queue" {
   message_retention_seconds  = 86400 # 24 hours
   receive_wait_time_seconds  = 20   # Long polling
 
+  # Jobs that keep failing are parked in the dead-letter queue for inspection and redrive
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.render_dlq.arn
+    maxReceiveCount     = var.render_max_receive_count
+  })
+
   tags = {
     Name        = "${var.project_name}-render-queue"
     Environment = "production"
   }
 }
 
+# High and low priority render queues, see SQS_QUEUE_URL_HIGH and SQS_QUEUE_URL_LOW
+resource "aws_sqs_queue" "render_queue_priority" {
+  for_each = toset(["high", "low"])
+
+  name                       = "${var.project_name}-render-queue-${each.key}"
+  visibility_timeout_seconds = 900
+  message_retention_seconds  = 86400
+  receive_wait_time_seconds  = 20
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.render_dlq.arn
+    maxReceiveCount     = var.render_max_receive_count
+  })
+
+  tags = {
+    Name        = "${var.project_name}-render-queue-${each.key}"
+    Environment = "production"
+  }
+}
+
+# Dead-letter queue for render jobs, see /admin/dead-letters
+resource "aws_sqs_queue" "render_dlq" {
+  name                      = "${var.project_name}-render-dlq"
+  message_retention_seconds = 1209600 # 14 days
+
+  tags = {
+    Name        = "${var.project_name}-render-dlq"
+    Environment = "production"
+  }
+}
+
 # DynamoDB table for job status
 resource "aws_dynamodb_table" "render_jobs" {
   name           = "${var.project_name}-jobs"
@@ -44,6 +81,51 @@ resource "aws_dynamodb_table" "render_jobs" {
   }
 }
 
+# DynamoDB table for uploaded video assets
+resource "aws_dynamodb_table" "assets" {
+  name         = "${var.project_name}-assets"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "owner"
+    type = "S"
+  }
+
+  attribute {
+    name = "createdAt"
+    type = "S"
+  }
+
+  attribute {
+    name = "checksum"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "OwnerIndex"
+    hash_key        = "owner"
+    range_key       = "createdAt"
+    projection_type = "ALL"
+  }
+
+  global_secondary_index {
+    name            = "ChecksumIndex"
+    hash_key        = "checksum"
+    projection_type = "ALL"
+  }
+
+  tags = {
+    Name        = "${var.project_name}-assets"
+    Environment = "production"
+  }
+}
+
 # IAM role for Lambda
 resource "aws_iam_role" "lambda_render" {
   name = "${var.project_name}-lambda-render"
@@ -82,9 +164,14 @@ resource "aws_iam_role_policy" "lambda_render_policy" {
         Action = [
           "sqs:ReceiveMessage",
           "sqs:DeleteMessage",
-          "sqs:GetQueueAttributes"
+          "sqs:GetQueueAttributes",
+          "sqs:GetQueueUrl",
+          "sqs:SendMessage" # postpones jobs scheduled beyond the 15 minute SQS delay
         ]
-        Resource = aws_sqs_queue.render_queue.arn
+        Resource = concat(
+          [aws_sqs_queue.render_queue.arn],
+          [for queue in aws_sqs_queue.render_queue_priority : queue.arn]
+        )
       },
       {
         Effect = "Allow"
@@ -405,6 +492,8 @@ resource "aws_lambda_function" "render_worker" {
       S3_BUCKET      = var.s3_bucket
       REMOTION_URL   = "http://remotion.local:3000"
       RENDER_API_KEY = var.render_api_key
+      # The last failed delivery marks the job failed before SQS dead-letters it
+      MAX_RECEIVE_COUNT = var.render_max_receive_count
     }
   }
 
@@ -436,6 +525,26 @@ resource "aws_lambda_event_source_mapping" "sqs_trigger" {
   event_source_arn = aws_sqs_queue.render_queue.arn
   function_name    = aws_lambda_function.render_worker.arn
   batch_size       = 1
+
+  # Failed jobs are returned to the queue instead of being dropped
+  function_response_types = ["ReportBatchItemFailures"]
+}
+
+# High priority jobs get their own trigger, low priority ones a capped share of the workers
+resource "aws_lambda_event_source_mapping" "sqs_priority_trigger" {
+  for_each = aws_sqs_queue.render_queue_priority
+
+  event_source_arn        = each.value.arn
+  function_name           = aws_lambda_function.render_worker.arn
+  batch_size              = 1
+  function_response_types = ["ReportBatchItemFailures"]
+
+  dynamic "scaling_config" {
+    for_each = each.key == "low" ? [1] : []
+    content {
+      maximum_concurrency = var.render_low_priority_concurrency
+    }
+  }
 }
 
 
@@ -499,9 +608,25 @@ resource "aws_ecs_task_definition" "backend" {
         name  = "SQS_QUEUE_URL"
         value = aws_sqs_queue.render_queue.url
       },
+      {
+        name  = "SQS_QUEUE_URL_HIGH"
+        value = aws_sqs_queue.render_queue_priority["high"].url
+      },
+      {
+        name  = "SQS_QUEUE_URL_LOW"
+        value = aws_sqs_queue.render_queue_priority["low"].url
+      },
+      {
+        name  = "SQS_DLQ_URL"
+        value = aws_sqs_queue.render_dlq.url
+      },
       {
         name  = "DYNAMODB_TABLE"
         value = aws_dynamodb_table.render_jobs.name
+      },
+      {
+        name  = "DYNAMODB_ASSETS_TABLE"
+        value = aws_dynamodb_table.assets.name
       }
     ]
 
@@ -549,13 +674,31 @@ resource "aws_iam_role_policy" "backend_task_policy" {
         ]
         Resource = "arn:aws:s3:::${var.s3_bucket}/*"
       },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:ListBucket"]
+        Resource = "arn:aws:s3:::${var.s3_bucket}"
+      },
       {
         Effect = "Allow"
         Action = [
           "sqs:SendMessage",
-          "sqs:GetQueueUrl"
+          "sqs:GetQueueUrl",
+          "sqs:GetQueueAttributes"
+        ]
+        Resource = concat(
+          [aws_sqs_queue.render_queue.arn],
+          [for queue in aws_sqs_queue.render_queue_priority : queue.arn]
+        )
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:ChangeMessageVisibility"
         ]
-        Resource = aws_sqs_queue.render_queue.arn
+        Resource = aws_sqs_queue.render_dlq.arn
       },
       {
         Effect = "Allow"
@@ -563,9 +706,27 @@ resource "aws_iam_role_policy" "backend_task_policy" {
           "dynamodb:PutItem",
           "dynamodb:GetItem",
           "dynamodb:UpdateItem",
-          "dynamodb:Query"
+          "dynamodb:DeleteItem",
+          "dynamodb:Query",
+          "dynamodb:Scan",
+          "dynamodb:DescribeTable"
         ]
         Resource = aws_dynamodb_table.render_jobs.arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:PutItem",
+          "dynamodb:GetItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:DeleteItem",
+          "dynamodb:Query",
+          "dynamodb:DescribeTable"
+        ]
+        Resource = [
+          aws_dynamodb_table.assets.arn,
+          "${aws_dynamodb_table.assets.arn}/index/*"
+        ]
       }
     ]
   })
@@ -628,7 +789,7 @@ resource "aws_lb_target_group" "backend" {
   target_type = "ip"
 
   health_check {
-    path                = "/health"
+    path                = "/readyz"
     healthy_threshold   = 2
     unhealthy_threshold = 10
     timeout             = 60
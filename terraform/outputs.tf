@@ -3,6 +3,16 @@ output "sqs_queue_url" {
   value       = aws_sqs_queue.render_queue.url
 }
 
+output "sqs_priority_queue_urls" {
+  description = "SQS queue URLs for high and low priority render jobs"
+  value       = { for priority, queue in aws_sqs_queue.render_queue_priority : priority => queue.url }
+}
+
+output "sqs_dlq_url" {
+  description = "SQS dead-letter queue URL for render jobs that kept failing"
+  value       = aws_sqs_queue.render_dlq.url
+}
+
 output "dynamodb_table_name" {
   description = "DynamoDB table name for job status"
   value       = aws_dynamodb_table.render_jobs.name
@@ -28,3 +28,15 @@ variable "render_api_key" {
   default     = "secure_key_12345"
   sensitive   = true
 }
+
+variable "render_max_receive_count" {
+  description = "Deliveries of a render job before it is moved to the dead-letter queue"
+  type        = number
+  default     = 3
+}
+
+variable "render_low_priority_concurrency" {
+  description = "Render worker Lambdas that may run low priority jobs at once (at least 2)"
+  type        = number
+  default     = 2
+}